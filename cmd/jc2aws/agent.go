@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/agent"
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/secrets"
+	"github.com/yousysadmin/jc2aws/internal/totp"
+)
+
+const (
+	keyTarget        = "target"
+	keySocket        = "socket"
+	keyRefreshMargin = "refresh-margin"
+)
+
+// credentialTarget is a target of the agent or batch mode with the request used to get its credentials.
+type credentialTarget struct {
+	agent.Target
+	req      credentialRequest
+	cacheKey cache.Key
+	account  config.Account
+}
+
+// newAgentCmd creates the command which keeps credentials of several targets fresh.
+func newAgentCmd(cfg *appConfig) *cobra.Command {
+	var (
+		targetSpecs   []string
+		socketPath    string
+		refreshMargin time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Keep AWS CLI profiles refreshed in the background",
+		Long: "Run in the foreground and refresh credentials of the targets before they expire.\n" +
+			"Credentials are written to the AWS CLI profile of each target. Targets are accounts from\n" +
+			"the config file: account[/role[/region]][=profile]. Accounts must use an MFA secret.",
+		Example: "  jc2aws agent --target my-prod/admin/us-east-1 --target my-stage/read-only=stage-ro",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targets, err := parseAgentTargets(cfg.config, targetSpecs)
+			if err != nil {
+				return err
+			}
+			if socketPath == "" {
+				if socketPath, err = defaultAgentSocket(); err != nil {
+					return err
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			a := newAgent(targets)
+			a.RefreshMargin = refreshMargin
+
+			l, err := agent.Listen(socketPath)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := a.Serve(ctx, l); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: status socket failed: %v\n", err)
+				}
+			}()
+
+			fmt.Fprintf(os.Stderr, "Agent started with %d target(s), status socket %s\n", len(targets), socketPath)
+			return a.Run(ctx)
+		},
+	}
+	cmd.Flags().StringArrayVar(&targetSpecs, keyTarget, nil, "Target account[/role[/region]][=profile] (repeatable)")
+	cmd.Flags().StringVar(&socketPath, keySocket, "", "Status socket path (default in the cache directory)")
+	cmd.Flags().DurationVar(&refreshMargin, keyRefreshMargin, agent.DefaultRefreshMargin, "Refresh credentials this long before they expire")
+	cmd.MarkFlagRequired(keyTarget)
+
+	cmd.AddCommand(newAgentStatusCmd())
+	return cmd
+}
+
+func newAgentStatusCmd() *cobra.Command {
+	var (
+		socketPath string
+		asJSON     bool
+	)
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show targets of the running agent",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if socketPath == "" {
+				var err error
+				if socketPath, err = defaultAgentSocket(); err != nil {
+					return err
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
+			defer cancel()
+			statuses, err := agent.GetStatus(ctx, socketPath)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(statuses)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TARGET\tPROFILE\tEXPIRES\tNEXT REFRESH\tERROR")
+			for _, s := range statuses {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					s.Target, s.Profile, formatExpiration(s.Expiration), formatExpiration(s.NextRefresh), s.LastError)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&socketPath, keySocket, "", "Status socket path (default in the cache directory)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output as JSON")
+	return cmd
+}
+
+// defaultAgentSocket returns the status socket path in the cache directory.
+func defaultAgentSocket() (string, error) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, agent.SocketName), nil
+}
+
+// newAgent creates the agent which refreshes credentials with getCredentials
+// and writes them to the AWS CLI profile and the credential cache.
+func newAgent(targets []credentialTarget) *agent.Agent {
+	byName := make(map[string]credentialTarget, len(targets))
+	list := make([]agent.Target, 0, len(targets))
+	for _, t := range targets {
+		byName[t.Name] = t
+		list = append(list, t.Target)
+	}
+
+	fetch := agent.FetcherFunc(func(_ context.Context, t agent.Target) (aws.AwsSamlOutput, error) {
+		target := byName[t.Name]
+		req, err := target.req.withSecrets(&target.account)
+		if err != nil {
+			return aws.AwsSamlOutput{}, err
+		}
+		return getCredentials(req)
+	})
+
+	// Targets share ~/.aws files, write them one at a time
+	var mu sync.Mutex
+	write := func(t agent.Target, cred aws.AwsSamlOutput) error {
+		mu.Lock()
+		defer mu.Unlock()
+		target := byName[t.Name]
+		if err := writeAwsProfile(cred, t.Profile, &target.account); err != nil {
+			return err
+		}
+		if !viper.GetBool(keyNoCache) {
+			if c, err := newCredentialCache(); err == nil {
+				if err := c.Put(target.cacheKey, cred); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to cache credentials: %v\n", err)
+				}
+			}
+		}
+		return nil
+	}
+
+	a := agent.New(list, fetch, write)
+	a.OnRefresh = func(s agent.Status) {
+		ts := time.Now().Format(time.DateTime)
+		if s.LastError != "" {
+			fmt.Fprintf(os.Stderr, "%s %s: refresh failed: %s, retry at %s\n", ts, s.Target, s.LastError, formatExpiration(s.NextRefresh))
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: profile %q refreshed, expires at %s, next refresh at %s\n",
+			ts, s.Target, s.Profile, formatExpiration(s.Expiration), formatExpiration(s.NextRefresh))
+	}
+	return a
+}
+
+// parseAgentTargets resolves target specs of the agent against the accounts from the config file.
+func parseAgentTargets(cfg *config.Config, specs []string) ([]credentialTarget, error) {
+	return parseTargets(cfg, specs, parseAgentTarget)
+}
+
+// parseTargets resolves target specs with parse and checks that targets write different profiles.
+func parseTargets(cfg *config.Config, specs []string, parse func(*config.Config, string) (credentialTarget, error)) ([]credentialTarget, error) {
+	var targets []credentialTarget
+	profiles := map[string]string{}
+	for _, spec := range specs {
+		t, err := parse(cfg, spec)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", spec, err)
+		}
+		if other, ok := profiles[t.Profile]; ok {
+			return nil, fmt.Errorf("targets %q and %q write the same profile %q, set a profile with =name", other, spec, t.Profile)
+		}
+		profiles[t.Profile] = spec
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// parseAgentTarget resolves an account[/role[/region]][=profile] spec of the agent,
+// which needs the MFA secret to log in again.
+func parseAgentTarget(cfg *config.Config, spec string) (credentialTarget, error) {
+	t, err := parseTarget(cfg, spec)
+	if err != nil {
+		return t, err
+	}
+	if mfa := t.req.MFA; totp.IsCode(mfa) && !secrets.IsReference(mfa) {
+		// A TOTP code can be used only once, the agent needs the secret to log in again
+		return credentialTarget{}, fmt.Errorf("MFA token secret is required to refresh credentials")
+	}
+	// The agent runs in the background, a countdown would only clutter its log
+	t.req.OnTOTPWait = nil
+	return t, nil
+}
+
+// parseTarget resolves an account[/role[/region]][=profile] spec.
+func parseTarget(cfg *config.Config, spec string) (credentialTarget, error) {
+	spec, profile, _ := strings.Cut(spec, "=")
+	parts := strings.Split(spec, "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return credentialTarget{}, fmt.Errorf("expected account[/role[/region]][=profile]")
+	}
+	accountName := parts[0]
+	var roleName, region string
+	if len(parts) > 1 {
+		roleName = parts[1]
+	}
+	if len(parts) > 2 {
+		region = parts[2]
+	}
+
+	acc, err := cfg.FindAccountByName(accountName)
+	if err != nil {
+		return credentialTarget{}, fmt.Errorf("account %q not found in config", accountName)
+	}
+
+	req := credentialRequest{
+		Email:            resolveString(keyEmail, &acc),
+		Password:         resolveString(keyPassword, &acc),
+		IdpURL:           resolveString(keyIdpURL, &acc),
+		MFA:              resolveString(keyMFA, &acc),
+		MFAMethod:        resolveString(keyMFAMethod, &acc),
+		ConsoleURL:       resolveString(keyJCConsoleURL, &acc),
+		ReuseSession:     viper.GetBool(keyReuseSession),
+		OnPush:           printPushNotice,
+		OnTOTPWait:       printTOTPWait,
+		OnClockSkew:      printClockSkewWarning,
+		PrincipalARN:     acc.AWSPrincipalArn,
+		RoleName:         roleName,
+		Region:           firstNonEmpty(region, viper.GetString(keyRegion)),
+		Duration:         resolveDuration(&acc),
+		DurationFromSAML: durationFromSAML(&acc),
+	}
+	if roleName != "" {
+		if role, err := acc.FindAWSRoleArnByName(roleName); err == nil {
+			req.RoleARN = role.Arn
+			req.Chain = roleChain(role)
+		}
+	}
+	if req.Region == "" && len(acc.AWSRegions) > 0 {
+		req.Region = acc.AWSRegions[0]
+	}
+
+	switch {
+	case req.Email == "" || req.Password == "" || req.IdpURL == "":
+		return credentialTarget{}, fmt.Errorf("email, password and IDP URL are required")
+	case req.Region == "":
+		return credentialTarget{}, fmt.Errorf("region is required")
+	}
+
+	if profile == "" {
+		profile = firstNonEmpty(acc.AwsCliProfile, acc.Name)
+	}
+	name := strings.Join([]string{accountName, firstNonEmpty(roleName, "-"), req.Region}, "/")
+
+	return credentialTarget{
+		Target: agent.Target{
+			Name:    name,
+			Profile: profile,
+			User:    strings.ToLower(req.Email) + " " + req.ConsoleURL,
+		},
+		req:      req,
+		cacheKey: credentialCacheKey(&acc, req.IdpURL, req.targetRoleARN(), roleName, req.Region),
+		account:  acc,
+	}, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/agent"
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+)
+
+// agentTestConfig returns accounts with MFA secrets usable by the agent.
+func agentTestConfig() *config.Config {
+	accounts := testAccounts()
+	accounts[0].MFASecret = "JBSWY3DPEHPK3PXP"
+	accounts[1].Email = "staging@example.com"
+	accounts[1].Password = "stagingpass"
+	accounts[1].IdpURL = "https://sso.jumpcloud.com/saml2/staging"
+	accounts[1].MFASecret = "env:J2A_STAGING_MFA"
+	return &config.Config{Accounts: accounts}
+}
+
+func TestParseAgentTarget(t *testing.T) {
+	resetViper()
+	viper.Set(keyJCConsoleURL, "https://console.jumpcloud.com")
+
+	tests := []struct {
+		spec        string
+		wantName    string
+		wantProfile string
+		wantRoleARN string
+		wantRegion  string
+	}{
+		{"prod/admin/eu-west-1", "prod/admin/eu-west-1", "prod-profile", "arn:aws:iam::111:role/admin", "eu-west-1"},
+		{"prod/readonly=prod-ro", "prod/readonly/us-east-1", "prod-ro", "arn:aws:iam::111:role/readonly", "us-east-1"},
+		{"prod/discovered/us-east-1", "prod/discovered/us-east-1", "prod-profile", "", "us-east-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseAgentTarget(agentTestConfig(), tt.spec)
+			if err != nil {
+				t.Fatalf("parseAgentTarget() error = %v", err)
+			}
+			if got.Name != tt.wantName || got.Profile != tt.wantProfile {
+				t.Errorf("parseAgentTarget() got name %q profile %q, want %q %q", got.Name, got.Profile, tt.wantName, tt.wantProfile)
+			}
+			if got.req.RoleARN != tt.wantRoleARN || got.req.Region != tt.wantRegion {
+				t.Errorf("parseAgentTarget() got role %q region %q, want %q %q", got.req.RoleARN, got.req.Region, tt.wantRoleARN, tt.wantRegion)
+			}
+			if got.User != "prod@example.com https://console.jumpcloud.com" {
+				t.Errorf("parseAgentTarget() got user %q", got.User)
+			}
+		})
+	}
+}
+
+func TestParseAgentTarget_Errors(t *testing.T) {
+	resetViper()
+
+	cfg := agentTestConfig()
+	cfg.Accounts = append(cfg.Accounts, config.Account{
+		Name:       "code-only",
+		Email:      "code@example.com",
+		Password:   "pass",
+		IdpURL:     "https://sso.jumpcloud.com/saml2/code",
+		MFASecret:  "123456",
+		AWSRegions: []string{"us-east-1"},
+	})
+
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"empty", ""},
+		{"too many parts", "prod/admin/us-east-1/extra"},
+		{"unknown account", "missing/admin"},
+		{"no region", "staging/admin"},
+		{"TOTP code instead of secret", "code-only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseAgentTarget(cfg, tt.spec); err == nil {
+				t.Errorf("parseAgentTarget(%q) expected error", tt.spec)
+			}
+		})
+	}
+}
+
+func TestParseAgentTargets_DuplicateProfile(t *testing.T) {
+	resetViper()
+
+	if _, err := parseAgentTargets(agentTestConfig(), []string{"prod/admin", "prod/readonly"}); err == nil {
+		t.Error("parseAgentTargets() expected error for targets writing the same profile")
+	}
+
+	targets, err := parseAgentTargets(agentTestConfig(), []string{"prod/admin", "prod/readonly=prod-ro", "staging/admin/us-west-2"})
+	if err != nil {
+		t.Fatalf("parseAgentTargets() error = %v", err)
+	}
+	if len(targets) != 3 {
+		t.Errorf("parseAgentTargets() want 3 targets, got %d", len(targets))
+	}
+}
+
+// sameUserConfig returns two accounts of one JumpCloud user in different IdP applications.
+func sameUserConfig(consoleURL, prodIdp, stageIdp string) *config.Config {
+	acc := func(name, idp string) config.Account {
+		return config.Account{
+			Name:         name,
+			Email:        jumpcloudtest.DefaultEmail,
+			Password:     jumpcloudtest.DefaultPassword,
+			IdpURL:       idp,
+			JCConsoleURL: consoleURL,
+			AWSRegions:   []string{"us-east-1"},
+		}
+	}
+	return &config.Config{Accounts: []config.Account{acc("prod", prodIdp), acc("stage", stageIdp)}}
+}
+
+func TestParseAgentTargets_SameUserAcrossIdPs(t *testing.T) {
+	resetViper()
+
+	cfg := sameUserConfig("https://console.jumpcloud.com", "https://sso.jumpcloud.com/saml2/prod", "https://sso.jumpcloud.com/saml2/stage")
+	targets, err := parseAgentTargets(cfg, []string{"prod", "stage"})
+	if err != nil {
+		t.Fatalf("parseAgentTargets() error = %v", err)
+	}
+
+	// Fetch times of the targets, logins of the same user must be spaced
+	var mu sync.Mutex
+	fetched := map[string]time.Time{}
+	fetch := agent.FetcherFunc(func(_ context.Context, t agent.Target) (aws.AwsSamlOutput, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetched[t.Name] = time.Now()
+		exp := time.Now().Add(time.Hour)
+		return aws.AwsSamlOutput{Expiration: &exp}, nil
+	})
+	a := agent.New([]agent.Target{targets[0].Target, targets[1].Target}, fetch,
+		func(agent.Target, aws.AwsSamlOutput) error { return nil })
+	a.LoginInterval = 150 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := a.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(fetched) != 2 {
+		t.Fatalf("want one login per target, got %v", fetched)
+	}
+	if gap := fetched[targets[1].Name].Sub(fetched[targets[0].Name]).Abs(); gap < 140*time.Millisecond {
+		t.Errorf("logins of one user in different IdP applications should be spaced by the login interval, got %v", gap)
+	}
+}
+
+func TestAgent_Offline(t *testing.T) {
+	resetViper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv(aws.EnvSharedCredentialsFile, filepath.Join(dir, "credentials"))
+	t.Setenv(aws.EnvConfigFile, filepath.Join(dir, "config"))
+	viper.Set(keyNoCache, true)
+
+	jc := jumpcloudtest.NewServer()
+	defer jc.Close()
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+
+	targets, err := parseAgentTargets(sameUserConfig(jc.URL, jc.AppURL("prod"), jc.AppURL("stage")), []string{"prod", "stage"})
+	if err != nil {
+		t.Fatalf("parseAgentTargets() error = %v", err)
+	}
+	a := newAgent(targets)
+	a.LoginInterval = 200 * time.Millisecond
+
+	var mu sync.Mutex
+	var refreshed []time.Time
+	a.OnRefresh = func(s agent.Status) {
+		mu.Lock()
+		defer mu.Unlock()
+		if s.LastError != "" {
+			t.Errorf("%s: refresh failed: %s", s.Target, s.LastError)
+		}
+		refreshed = append(refreshed, time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := a.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(refreshed) != 2 || jc.IdpRequests("prod") != 1 || jc.IdpRequests("stage") != 1 || len(calls) != 2 {
+		t.Fatalf("want one login per target, got %d refreshes, %d STS calls", len(refreshed), len(calls))
+	}
+	if gap := refreshed[1].Sub(refreshed[0]); gap < 190*time.Millisecond {
+		t.Errorf("logins of the same user should be spaced by the login interval, got %v", gap)
+	}
+
+	creds, err := os.ReadFile(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []string{"[prod]", "[stage]"} {
+		if !strings.Contains(string(creds), profile) {
+			t.Errorf("credentials file does not contain %s, got:\n%s", profile, creds)
+		}
+	}
+}
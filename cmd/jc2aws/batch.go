@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+)
+
+const (
+	keyAll      = "all"
+	keyAccounts = "accounts"
+	keyGroup    = "group"
+	keyParallel = "parallel"
+
+	// defaultParallel is the default number of concurrent AWS STS requests in batch mode.
+	defaultParallel = 4
+)
+
+// batchResult is the outcome of a batch mode target.
+type batchResult struct {
+	target credentialTarget
+	cred   aws.AwsSamlOutput
+	cached bool
+	err    error
+}
+
+// samlResult is the SAML assertion of an IDP URL or the error getting it.
+type samlResult struct {
+	assertion string
+	err       error
+}
+
+// batchSpecs returns target specs selected by --all, --accounts and --group,
+// or nil if batch mode is not used. Bare account names get --role-name.
+func batchSpecs(cfg *config.Config) ([]string, error) {
+	var specs []string
+	if viper.GetBool(keyAll) {
+		if len(cfg.Accounts) == 0 {
+			return nil, errors.New("--all can't be used without any pre-configured account")
+		}
+		for _, acc := range cfg.Accounts {
+			specs = append(specs, acc.Name)
+		}
+	}
+	specs = append(specs, splitList(viper.GetStringSlice(keyAccounts))...)
+	for _, name := range splitList(viper.GetStringSlice(keyGroup)) {
+		group, err := cfg.FindGroupByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("group %q not found in config", name)
+		}
+		specs = append(specs, group.Targets...)
+	}
+
+	roleName := viper.GetString(keyRoleName)
+	var unique []string
+	for _, spec := range specs {
+		if target, profile, hasProfile := strings.Cut(spec, "="); roleName != "" && !strings.Contains(target, "/") {
+			spec = target + "/" + roleName
+			if hasProfile {
+				spec += "=" + profile
+			}
+		}
+		if !slices.Contains(unique, spec) {
+			unique = append(unique, spec)
+		}
+	}
+	return unique, nil
+}
+
+// splitList splits comma separated values, as env vars are not split by Viper.
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for item := range strings.SplitSeq(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// runBatch gets credentials of the targets, writes all profiles at once
+// and reports the result of each target.
+func runBatch(cfg *appConfig, specs []string) error {
+	if format := viper.GetString(keyOutputFormat); format != "cli" {
+		return fmt.Errorf("batch mode writes AWS CLI profiles, output format %q is not supported", format)
+	}
+	targets, err := parseTargets(cfg.config, specs, parseTarget)
+	if err != nil {
+		return err
+	}
+
+	results := fetchBatch(targets, viper.GetInt(keyParallel))
+
+	// Targets of accounts with the same AWS files are written with one update
+	var order []awsFiles
+	profiles := map[awsFiles][]aws.AwsProfile{}
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		files, err := resolveAwsFiles(&r.target.account)
+		if err != nil {
+			return err
+		}
+		if _, ok := profiles[files]; !ok {
+			order = append(order, files)
+		}
+		profiles[files] = append(profiles[files], awsProfile(r.target.Profile, r.cred, &r.target.account))
+	}
+	for _, files := range order {
+		if err := writeAwsProfiles(files, profiles[files]); err != nil {
+			return fmt.Errorf("failed to write AWS profiles: %w", err)
+		}
+	}
+
+	failed := printBatchReport(os.Stdout, results)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(results))
+	}
+	return nil
+}
+
+// fetchBatch gets credentials of the targets. Valid cached credentials are reused,
+// JumpCloud is logged in once per user, and the SAML assertion of each IDP URL
+// is exchanged for credentials with at most parallel concurrent STS requests.
+func fetchBatch(targets []credentialTarget, parallel int) []batchResult {
+	results := make([]batchResult, len(targets))
+	c := batchCache()
+
+	// Targets without valid cached credentials, by JumpCloud user
+	var users []string
+	pending := map[string][]int{}
+	for i, t := range targets {
+		results[i].target = t
+		if c != nil && !viper.GetBool(keyForceRefresh) {
+			if cred, ok, _ := c.Get(t.cacheKey); ok {
+				results[i].cred, results[i].cached = cred, true
+				continue
+			}
+		}
+		user := strings.ToLower(t.req.Email) + " " + t.req.ConsoleURL
+		if _, ok := pending[user]; !ok {
+			users = append(users, user)
+		}
+		pending[user] = append(pending[user], i)
+	}
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, user := range users {
+		var idpURLs []string
+		for _, i := range pending[user] {
+			if idp := targets[i].req.IdpURL; !slices.Contains(idpURLs, idp) {
+				idpURLs = append(idpURLs, idp)
+			}
+		}
+		first := targets[pending[user][0]]
+		assertions := samlAssertions(first.req, &first.account, idpURLs)
+
+		for _, i := range pending[user] {
+			saml := assertions[targets[i].req.IdpURL]
+			if saml.err != nil {
+				results[i].err = saml.err
+				continue
+			}
+			wg.Go(func() {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				results[i].cred, results[i].err = assumeSamlRole(targets[i].req, saml.assertion)
+			})
+		}
+	}
+	wg.Wait()
+
+	if c != nil {
+		for _, r := range results {
+			if r.err == nil && !r.cached {
+				if err := c.Put(r.target.cacheKey, r.cred); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to cache credentials: %v\n", err)
+				}
+			}
+		}
+	}
+	return results
+}
+
+// samlAssertions logs in to JumpCloud once and gets the SAML assertion
+// of each IDP URL with the same session.
+func samlAssertions(req credentialRequest, acc *config.Account, idpURLs []string) map[string]samlResult {
+	results := make(map[string]samlResult, len(idpURLs))
+	req, err := req.withSecrets(acc)
+	var jc jumpcloud.JumpCloud
+	if err == nil {
+		jc, err = newJumpCloudClient(req)
+	}
+	if err != nil {
+		for _, idp := range idpURLs {
+			results[idp] = samlResult{err: err}
+		}
+		return results
+	}
+
+	var session []*http.Cookie
+	var loginErr error
+	for _, idp := range idpURLs {
+		if loginErr != nil {
+			// Don't log in again with the same password and TOTP code
+			results[idp] = samlResult{err: loginErr}
+			continue
+		}
+		jc.IdpURL = idp
+		jc.Session = session
+		// Further IDP URLs use the session of the first login only, logging in again
+		// would send the already used TOTP code or a second push notification
+		jc.SessionOnly = session != nil
+		assertion, err := getSamlWithSession(&jc, req.ReuseSession && session == nil)
+		if err != nil {
+			if session == nil {
+				loginErr = err
+			}
+			results[idp] = samlResult{err: err}
+			continue
+		}
+		session = jc.Cookies()
+		results[idp] = samlResult{assertion: assertion}
+	}
+	return results
+}
+
+// batchCache returns the credential cache, or nil if it is disabled or unavailable.
+func batchCache() *cache.Cache {
+	if viper.GetBool(keyNoCache) {
+		return nil
+	}
+	c, err := newCredentialCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: credential cache disabled: %v\n", err)
+		return nil
+	}
+	return c
+}
+
+// printBatchReport prints the result of each target and returns the number of failed targets.
+func printBatchReport(out io.Writer, results []batchResult) int {
+	failed := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tPROFILE\tSTATUS\tEXPIRES\tERROR")
+	for _, r := range results {
+		status, expires, errMsg := "ok", formatExpiration(r.cred.Expiration), ""
+		switch {
+		case r.err != nil:
+			failed++
+			status, expires = "failed", "-"
+			// Keep the table readable with multi-line errors
+			errMsg = strings.ReplaceAll(r.err.Error(), "\n", " ")
+		case r.cached:
+			status = "cached"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.target.Name, r.target.Profile, status, expires, errMsg)
+	}
+	w.Flush()
+	return failed
+}
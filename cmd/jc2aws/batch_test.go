@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gopkg.in/ini.v1"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+)
+
+func TestBatchSpecs(t *testing.T) {
+	cfg := &config.Config{
+		Accounts: testAccounts(),
+		Groups: []config.Group{
+			{Name: "oncall", Targets: []string{"prod/admin", "staging=staging-ro"}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		set  map[string]any
+		want []string
+	}{
+		{"no batch", nil, nil},
+		{"all", map[string]any{keyAll: true}, []string{"prod", "staging"}},
+		{"all with role name", map[string]any{keyAll: true, keyRoleName: "admin"}, []string{"prod/admin", "staging/admin"}},
+		{"comma separated env var", map[string]any{keyAccounts: []string{"prod/admin,staging", "prod/admin"}}, []string{"prod/admin", "staging"}},
+		{"group", map[string]any{keyGroup: []string{"oncall"}, keyRoleName: "readonly"}, []string{"prod/admin", "staging/readonly=staging-ro"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetViper()
+			for k, v := range tt.set {
+				viper.Set(k, v)
+			}
+			got, err := batchSpecs(cfg)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchSpecs() got = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	resetViper()
+	viper.Set(keyGroup, []string{"missing"})
+	if _, err := batchSpecs(cfg); err == nil {
+		t.Error("batchSpecs() expected error for unknown group")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	resetViper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	viper.Set(keyOutputFormat, "cli")
+
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = "123456"
+	jc.Roles = append(jc.Roles, jumpcloudtest.Role{
+		RoleArn:      "arn:aws:iam::000000000000:role/jumpcloud-readonly",
+		PrincipalArn: jumpcloudtest.DefaultRole.PrincipalArn,
+	})
+	jc.Start()
+	defer jc.Close()
+
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+
+	account := func(name, app string) config.Account {
+		return config.Account{
+			Name:         name,
+			Email:        jumpcloudtest.DefaultEmail,
+			Password:     jumpcloudtest.DefaultPassword,
+			MFASecret:    "123456",
+			IdpURL:       jc.AppURL(app),
+			JCConsoleURL: jc.URL,
+			AWSRegions:   []string{"us-east-1"},
+			AWSRoleArns: []config.AWSRole{
+				{Name: "admin", Arn: jumpcloudtest.DefaultRole.RoleArn},
+				{Name: "readonly", Arn: "arn:aws:iam::000000000000:role/jumpcloud-readonly"},
+			},
+		}
+	}
+	broken := account("broken", "broken")
+	broken.Email = "other@example.com"
+	cfg := newTestConfig([]config.Account{account("prod", "prod"), account("stage", "stage"), broken})
+
+	specs := []string{"prod/admin", "prod/readonly=prod-ro", "stage/admin", "broken/admin"}
+	err := runBatch(cfg, specs)
+	if err == nil || err.Error() != "1 of 4 targets failed" {
+		t.Fatalf("runBatch() error = %v, want 1 failed target", err)
+	}
+
+	// One login for the user, one SAML request per IDP URL, one STS call per target
+	if jc.Logins() != 1 || jc.IdpRequests("prod") != 1 || jc.IdpRequests("stage") != 1 {
+		t.Errorf("runBatch() made %d logins, %d prod and %d stage IDP requests, want 1 each",
+			jc.Logins(), jc.IdpRequests("prod"), jc.IdpRequests("stage"))
+	}
+	if len(calls) != 3 {
+		t.Errorf("runBatch() made %d STS calls, want 3", len(calls))
+	}
+
+	creds, err := ini.Load(filepath.Join(home, ".aws", "credentials"))
+	if err != nil {
+		t.Fatalf("failed to read credentials file: %v", err)
+	}
+	for _, profile := range []string{"prod", "prod-ro", "stage"} {
+		if got := creds.Section(profile).Key("aws_access_key_id").String(); got != "AKIASAML" {
+			t.Errorf("profile %q aws_access_key_id = %q, want AKIASAML", profile, got)
+		}
+	}
+	if creds.HasSection("broken") {
+		t.Error("failed target should not be written")
+	}
+
+	// Cached credentials are reused without logging in again
+	err = runBatch(cfg, specs[:3])
+	if err != nil || jc.Logins() != 1 || len(calls) != 3 {
+		t.Errorf("runBatch() error = %v, %d logins, %d STS calls, want cached credentials", err, jc.Logins(), len(calls))
+	}
+
+	viper.Set(keyOutputFormat, "env")
+	if err := runBatch(cfg, specs[:1]); err == nil {
+		t.Error("runBatch() expected error for the env output format")
+	}
+}
+
+func TestSamlAssertions_SessionExpired(t *testing.T) {
+	resetViper()
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = "123456"
+	// The session ends after the SAML response of the first IDP
+	handler := jc.Config.Handler
+	jc.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		if r.URL.Path == "/saml2/prod" {
+			jc.ExpireSessions()
+		}
+	})
+	jc.Start()
+	defer jc.Close()
+
+	req := credentialRequest{
+		Email:      jumpcloudtest.DefaultEmail,
+		Password:   jumpcloudtest.DefaultPassword,
+		IdpURL:     jc.AppURL("prod"),
+		MFA:        "123456",
+		ConsoleURL: jc.URL,
+	}
+	results := samlAssertions(req, nil, []string{jc.AppURL("prod"), jc.AppURL("stage"), jc.AppURL("dev")})
+
+	if prod := results[jc.AppURL("prod")]; prod.err != nil || prod.assertion != jc.SAMLResponse() {
+		t.Errorf("prod assertion = %q, %v, want the SAML response", prod.assertion, prod.err)
+	}
+	for _, app := range []string{"stage", "dev"} {
+		if err := results[jc.AppURL(app)].err; !errors.Is(err, jumpcloud.ErrSessionExpired) {
+			t.Errorf("%s error = %v, want ErrSessionExpired", app, err)
+		}
+	}
+	// The used TOTP code isn't sent again
+	if jc.Logins() != 1 {
+		t.Errorf("samlAssertions() made %d logins, want 1", jc.Logins())
+	}
+}
+
+func TestPrintBatchReport(t *testing.T) {
+	target := func(name, profile string) credentialTarget {
+		var tgt credentialTarget
+		tgt.Name, tgt.Profile = name, profile
+		return tgt
+	}
+	results := []batchResult{
+		{target: target("prod/admin/us-east-1", "prod"), cred: aws.AwsSamlOutput{}},
+		{target: target("stage/admin/us-east-1", "stage"), cached: true},
+		{target: target("broken/admin/us-east-1", "broken"), err: errors.New("Authentication failed.\nretry")},
+	}
+
+	var out bytes.Buffer
+	if failed := printBatchReport(&out, results); failed != 1 {
+		t.Errorf("printBatchReport() failed = %d, want 1", failed)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[2], "cached") ||
+		!strings.Contains(lines[3], "failed") || !strings.Contains(lines[3], "Authentication failed. retry") {
+		t.Errorf("printBatchReport() got:\n%s", out.String())
+	}
+}
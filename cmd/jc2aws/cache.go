@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/config"
+)
+
+// newCredentialCache opens the credential cache in the default cache directory.
+func newCredentialCache() (*cache.Cache, error) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	c := cache.New(dir)
+	if viper.IsSet(keyCacheRefreshMargin) {
+		c.RefreshMargin = viper.GetDuration(keyCacheRefreshMargin)
+	}
+	c.Passphrase = viper.GetString(keyCacheKey)
+	return c, nil
+}
+
+// credentialCacheKey returns the cache key for the resolved request.
+// Without a config account the IDP URL identifies the account.
+func credentialCacheKey(acc *config.Account, idpURL, roleARN, roleName, region string) cache.Key {
+	key := cache.Key{
+		Account: idpURL,
+		Role:    firstNonEmpty(roleARN, roleName),
+		Region:  region,
+	}
+	if acc != nil {
+		key.Account = acc.Name
+	}
+	return key
+}
+
+// getCachedCredentials returns valid cached credentials for the key, otherwise
+// calls fetch and stores the result. Cache failures are reported as warnings
+// and never prevent obtaining credentials.
+func getCachedCredentials(key cache.Key, fetch func() (aws.AwsSamlOutput, error)) (aws.AwsSamlOutput, error) {
+	if viper.GetBool(keyNoCache) {
+		return fetch()
+	}
+
+	c, err := newCredentialCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: credential cache disabled: %v\n", err)
+		return fetch()
+	}
+
+	if !viper.GetBool(keyForceRefresh) {
+		cred, ok, err := c.Get(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read cached credentials: %v\n", err)
+		}
+		if ok {
+			return cred, nil
+		}
+	}
+
+	cred, err := fetch()
+	if err != nil {
+		return cred, err
+	}
+	if err := c.Put(key, cred); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache credentials: %v\n", err)
+	}
+	return cred, nil
+}
+
+// newCacheCmd creates the command group for managing the credential cache.
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local credential cache",
+	}
+	cmd.AddCommand(newCacheListCmd(), newCacheClearCmd())
+	return cmd
+}
+
+func newCacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List cached credentials",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newCredentialCache()
+			if err != nil {
+				return err
+			}
+			entries, err := c.List()
+			if err != nil {
+				return fmt.Errorf("failed to read credential cache: %w", err)
+			}
+			if len(entries) == 0 {
+				fmt.Fprintln(os.Stdout, "Credential cache is empty")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ACCOUNT\tROLE\tREGION\tEXPIRES\tSTATUS")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					e.Key.Account, e.Key.Role, e.Key.Region, formatExpiration(e.Expiration), cacheEntryStatus(c, e))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newCacheClearCmd() *cobra.Command {
+	var account string
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove cached credentials",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newCredentialCache()
+			if err != nil {
+				return err
+			}
+
+			var filter func(cache.Key) bool
+			if account != "" {
+				filter = func(k cache.Key) bool { return k.Account == account }
+			}
+			removed, err := c.Clear(filter)
+			if err != nil {
+				return fmt.Errorf("failed to clear credential cache: %w", err)
+			}
+			fmt.Fprintf(os.Stdout, "Removed %d cached credential(s)\n", removed)
+			return nil
+		},
+	}
+	// Local flag, shadows the persistent --account so clearing doesn't require a configured account
+	cmd.Flags().StringVarP(&account, keyAccount, "a", "", "Only remove credentials of the account (name from config or IDP URL)")
+	return cmd
+}
+
+// cacheEntryStatus describes the state of a cache entry for `cache list`.
+func cacheEntryStatus(c *cache.Cache, e cache.Entry) string {
+	status := "expired"
+	if c.Valid(e) {
+		status = "valid"
+	}
+	if e.Encrypted {
+		status += ", encrypted"
+	}
+	return status
+}
+
+// formatExpiration formats the expiration time in local time.
+func formatExpiration(exp *time.Time) string {
+	if exp == nil {
+		return "-"
+	}
+	return exp.Local().Format(time.DateTime)
+}
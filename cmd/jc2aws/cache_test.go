@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/config"
+)
+
+func TestCredentialCacheKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		acc      *config.Account
+		roleARN  string
+		roleName string
+		want     cache.Key
+	}{
+		{
+			name:    "account name and role ARN",
+			acc:     &config.Account{Name: "prod"},
+			roleARN: "arn:aws:iam::111:role/admin",
+			want:    cache.Key{Account: "prod", Role: "arn:aws:iam::111:role/admin", Region: "us-east-1"},
+		},
+		{
+			name:     "IDP URL and role name",
+			roleName: "admin",
+			want:     cache.Key{Account: "https://sso.jumpcloud.com/saml2/aws", Role: "admin", Region: "us-east-1"},
+		},
+		{
+			name: "role discovered from SAML",
+			acc:  &config.Account{Name: "prod"},
+			want: cache.Key{Account: "prod", Region: "us-east-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := credentialCacheKey(tt.acc, "https://sso.jumpcloud.com/saml2/aws", tt.roleARN, tt.roleName, "us-east-1")
+			if got != tt.want {
+				t.Errorf("credentialCacheKey() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// countingFetch returns a fetch func which counts calls and returns credentials valid for an hour.
+func countingFetch(calls *int) func() (aws.AwsSamlOutput, error) {
+	return func() (aws.AwsSamlOutput, error) {
+		*calls++
+		exp := time.Now().Add(time.Hour)
+		return aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET", Expiration: &exp}, nil
+	}
+}
+
+func TestGetCachedCredentials(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	key := cache.Key{Account: "prod", Role: "admin", Region: "us-east-1"}
+
+	calls := 0
+	for range 2 {
+		if _, err := getCachedCredentials(key, countingFetch(&calls)); err != nil {
+			t.Fatalf("getCachedCredentials() error = %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("cached credentials should be reused: want 1 fetch, got %d", calls)
+	}
+
+	viper.Set(keyForceRefresh, true)
+	if _, err := getCachedCredentials(key, countingFetch(&calls)); err != nil {
+		t.Fatalf("getCachedCredentials() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("--force-refresh should fetch credentials: want 2 fetches, got %d", calls)
+	}
+
+	resetViper()
+	viper.Set(keyNoCache, true)
+	if _, err := getCachedCredentials(key, countingFetch(&calls)); err != nil {
+		t.Fatalf("getCachedCredentials() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("--no-cache should fetch credentials: want 3 fetches, got %d", calls)
+	}
+}
+
+func TestGetCachedCredentials_FetchError(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	key := cache.Key{Account: "prod", Role: "admin", Region: "us-east-1"}
+
+	_, err := getCachedCredentials(key, func() (aws.AwsSamlOutput, error) {
+		return aws.AwsSamlOutput{}, errors.New("auth failed")
+	})
+	if err == nil {
+		t.Fatal("getCachedCredentials() expected error")
+	}
+
+	c, err := newCredentialCache()
+	if err != nil {
+		t.Fatalf("newCredentialCache() error = %v", err)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Errorf("failed fetch should not be cached, got %d entries", len(entries))
+	}
+}
+
+func TestCacheEntryStatus(t *testing.T) {
+	c := cache.New(t.TempDir())
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		entry cache.Entry
+		want  string
+	}{
+		{cache.Entry{Expiration: &future}, "valid"},
+		{cache.Entry{Expiration: &past}, "expired"},
+		{cache.Entry{Expiration: &future, Encrypted: true}, "valid, encrypted"},
+	}
+	for _, tt := range tests {
+		if got := cacheEntryStatus(c, tt.entry); got != tt.want {
+			t.Errorf("cacheEntryStatus() got = %v, want %v", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/config"
+)
+
+// newConfigCmd creates the command group for the config file.
+func newConfigCmd(cfg *appConfig) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Check the config file",
+	}
+	cmd.AddCommand(newConfigValidateCmd(cfg))
+	return cmd
+}
+
+// newConfigValidateCmd creates the command which reports issues of the config file
+// and fails if it has errors, e.g. to check a shared config in CI.
+func newConfigValidateCmd(cfg *appConfig) *cobra.Command {
+	var strict bool
+	cmd := &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Validate the config file",
+		Long: "Validate the config file (--config or the file argument) and report each issue as\n" +
+			"file:line:column: severity: message. Checked are YAML syntax and types, unknown params,\n" +
+			"duplicate account, role and group names, ARNs, regions, session durations, e-mails,\n" +
+			"MFA secrets and methods, output formats and group targets. Secret references are not resolved.\n" +
+			"Exits with code 1 if there are errors, or warnings with --strict.",
+		Example: "  jc2aws config validate\n" +
+			"  jc2aws config validate --strict team/jc2aws.yaml",
+		Args: cobra.MaximumNArgs(1),
+		// The config file is validated instead of loaded, so syntax errors are reported with their position
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cfg.configFilePath = viper.GetString(keyConfig)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := cfg.configFilePath
+			if len(args) == 1 {
+				path = args[0]
+			}
+
+			issues, err := config.Validate(path)
+			if err != nil {
+				return fmt.Errorf("failed to read config file: %w", err)
+			}
+			var errs, warnings int
+			for _, issue := range issues {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s:%s\n", path, issue)
+				if issue.Severity == config.SeverityError {
+					errs++
+				} else {
+					warnings++
+				}
+			}
+
+			if errs > 0 || (strict && warnings > 0) {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%s: %s, %s", path, plural(errs, "error"), plural(warnings, "warning"))
+			}
+			if warnings > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s\n", path, plural(warnings, "warning"))
+				return nil
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: OK\n", path)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail on warnings too")
+	return cmd
+}
+
+// plural formats the count with the noun, adding "s" unless the count is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
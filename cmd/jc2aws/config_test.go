@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// runConfigCmd runs the config command with the args and returns its stdout and stderr.
+func runConfigCmd(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	cmd := newConfigCmd(newTestConfig(nil))
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), errOut.String(), err
+}
+
+// writeConfigFile writes the config file and returns its path.
+func writeConfigFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigValidateCmd(t *testing.T) {
+	resetViper()
+	path := writeConfigFile(t, "accounts:\n  - name: prod\n    aws_regions: [us-east-1]\n")
+	viper.Set(keyConfig, path)
+
+	out, errOut, err := runConfigCmd(t, "validate")
+	if err != nil || out != "" || errOut != path+": OK\n" {
+		t.Errorf("config validate got %q, %q, %v", out, errOut, err)
+	}
+}
+
+func TestConfigValidateCmd_Errors(t *testing.T) {
+	resetViper()
+	path := writeConfigFile(t, "accounts:\n  - name: prod\n    aws_regions: [us-east-9]\n    session_timeout: 3600\n  - name: prod\n")
+
+	out, _, err := runConfigCmd(t, "validate", path)
+	if err == nil || err.Error() != path+": 2 errors, 1 warning" {
+		t.Errorf("config validate error = %v", err)
+	}
+	want := path + ":3:19: error: aws_regions: invalid region\n" +
+		path + ":4:22: warning: session_timeout is deprecated, use session_duration\n" +
+		path + `:5:11: error: duplicate account name "prod", first defined at line 2` + "\n"
+	if out != want {
+		t.Errorf("config validate output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestConfigValidateCmd_Warnings(t *testing.T) {
+	resetViper()
+	path := writeConfigFile(t, "accounts:\n  - name: prod\n    session_timeout: 3600\n")
+
+	if _, errOut, err := runConfigCmd(t, "validate", path); err != nil || !strings.Contains(errOut, "1 warning") {
+		t.Errorf("config validate got %q, %v, want success with a warning", errOut, err)
+	}
+	if _, _, err := runConfigCmd(t, "validate", "--strict", path); err == nil {
+		t.Error("config validate --strict succeeded with a warning")
+	}
+}
+
+func TestConfigValidateCmd_SyntaxError(t *testing.T) {
+	resetViper()
+	path := writeConfigFile(t, "accounts:\n  - name: prod\n  aws_regions: [us-east-1\n")
+
+	out, _, err := runConfigCmd(t, "validate", path)
+	if err == nil || !strings.HasPrefix(out, path+":") {
+		t.Errorf("config validate got %q, %v, want the syntax error with its line", out, err)
+	}
+}
+
+func TestConfigValidateCmd_MissingFile(t *testing.T) {
+	resetViper()
+
+	_, _, err := runConfigCmd(t, "validate", filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("config validate error = %v", err)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	for n, want := range map[int]string{0: "0 errors", 1: "1 error", 2: "2 errors"} {
+		if got := plural(n, "error"); got != want {
+			t.Errorf("plural(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
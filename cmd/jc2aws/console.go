@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/console"
+)
+
+const (
+	keyConsoleDestination = "console-destination"
+	keyConsoleIssuer      = "console-issuer"
+	keyFederationURL      = "federation-url"
+)
+
+// newConsoleCmd creates the command which signs in to the AWS Management Console.
+func newConsoleCmd(cfg *appConfig) *cobra.Command {
+	var open bool
+	cmd := &cobra.Command{
+		Use:   "console",
+		Short: "Print or open an AWS Management Console sign-in URL",
+		Long: "Get credentials and exchange them for an AWS Management Console sign-in URL.\n" +
+			"The URL is valid for 15 minutes and opens the console destination page.",
+		Example: "  jc2aws console --account my-prod --role-name admin --open\n" +
+			"  jc2aws console --account my-prod --role-name admin --console-destination s3/home",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cred, _, err := headlessCredentials(cfg)
+			if err != nil {
+				return err
+			}
+
+			u, err := consoleURL(cmd.Context(), cred)
+			if err != nil {
+				return err
+			}
+			if open {
+				err := openBrowser(u)
+				if err == nil {
+					return nil
+				}
+				// Fall back to printing the URL, e.g. on a headless machine
+				fmt.Fprintf(os.Stderr, "Warning: failed to open browser: %v\n", err)
+			}
+			fmt.Fprintln(os.Stdout, u)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&open, "open", false, "Open the URL in the default browser instead of printing it")
+	return cmd
+}
+
+// consoleURL returns the console sign-in URL for the credentials.
+func consoleURL(ctx context.Context, cred aws.AwsSamlOutput) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return console.LoginURL(ctx, cred, console.Options{
+		FederationURL: viper.GetString(keyFederationURL),
+		Destination:   viper.GetString(keyConsoleDestination),
+		Issuer:        viper.GetString(keyConsoleIssuer),
+	})
+}
+
+// openBrowser opens the URL in the default browser.
+func openBrowser(u string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", u)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		c = exec.Command("xdg-open", u)
+	}
+	return c.Start()
+}
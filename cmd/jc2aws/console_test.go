@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+func TestConsoleURL(t *testing.T) {
+	resetViper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"SigninToken":"signin-token"}`)
+	}))
+	defer srv.Close()
+
+	viper.Set(keyFederationURL, srv.URL)
+	viper.Set(keyConsoleDestination, "ec2/home")
+	viper.Set(keyConsoleIssuer, "my-issuer")
+
+	cred := aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET", SessionToken: "TOKEN", Region: "ca-central-1"}
+	got, err := consoleURL(context.Background(), cred)
+	if err != nil {
+		t.Fatalf("consoleURL() error = %v", err)
+	}
+
+	u, err := url.Parse(got)
+	if err != nil || u.Scheme+"://"+u.Host != srv.URL {
+		t.Fatalf("consoleURL() should use the configured federation endpoint, got %q", got)
+	}
+	q := u.Query()
+	if q.Get("Issuer") != "my-issuer" || q.Get("SigninToken") != "signin-token" ||
+		q.Get("Destination") != "https://console.aws.amazon.com/ec2/home?region=ca-central-1" {
+		t.Errorf("consoleURL() got unexpected query %v", q)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/secrets"
+	"github.com/yousysadmin/jc2aws/internal/totp"
+)
+
+// credentialProcessFlags are flags copied from the setup command to the
+// credential_process command line. Secrets (password, MFA) are never copied:
+// they must come from the config file or environment.
+var credentialProcessFlags = []string{
+	keyConfig,
+	keyAccount,
+	keyEmail,
+	keyIdpURL,
+	keyJCConsoleURL,
+	keyMFAMethod,
+	keyRoleName,
+	keyRoleARN,
+	keyPrincipalARN,
+	keyRegion,
+	keyDuration,
+	keySTSEndpoint,
+}
+
+// newSetupCredentialProcessCmd creates the command which configures an AWS CLI
+// profile that runs jc2aws as its credential_process.
+func newSetupCredentialProcessCmd(cfg *appConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "setup-credential-process",
+		Short: "Configure an AWS CLI profile that obtains credentials via jc2aws",
+		Long: "Write a credential_process entry into ~/.aws/config, so the AWS CLI and SDKs run jc2aws\n" +
+			"to obtain credentials for the profile. Credential flags passed to this command\n" +
+			"(except password and MFA) are added to the credential_process command line.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acc, err := resolveAccount(cfg)
+			if err != nil {
+				return err
+			}
+
+			profileName := resolveString(keyAwsCliProfile, acc)
+			if profileName == "" {
+				return fmt.Errorf("--%s or --%s is required", keyAwsCliProfile, keyAccount)
+			}
+
+			// credential_process runs without a terminal, so a TOTP code can't be entered.
+			// Secret references are resolved at login time and not checked here.
+			if mfa := resolveString(keyMFA, acc); mfa != "" && !secrets.IsReference(mfa) && totp.IsCode(mfa) {
+				fmt.Fprintln(os.Stderr, "Warning: MFA is not a TOTP secret, credential_process will not be able to log in")
+			}
+
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to determine jc2aws executable path: %w", err)
+			}
+
+			command := credentialProcessCommand(exe, credentialProcessArgs(cmd.Flags()))
+
+			filePathConf, err := resolvePath(keyConfigFileOut, acc, aws.SharedConfigFile)
+			if err != nil {
+				return err
+			}
+			err = aws.UpdateSharedFile(filePathConf, func() ([]byte, error) {
+				return aws.ToAwsConfigCredentialProcess(profileName, resolveString(keyRegion, acc), command, filePathConf)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to write AWS config: %w", err)
+			}
+
+			fmt.Fprintf(os.Stdout, "Profile %q configured in %s\ncredential_process = %s\n", profileName, filePathConf, command)
+			return nil
+		},
+	}
+}
+
+// credentialProcessArgs returns the credentialProcessFlags set on the command line with their values.
+func credentialProcessArgs(flags *pflag.FlagSet) []string {
+	var args []string
+	for _, name := range credentialProcessFlags {
+		if f := flags.Lookup(name); f != nil && f.Changed {
+			args = append(args, "--"+name, f.Value.String())
+		}
+	}
+	return args
+}
+
+// credentialProcessCommand builds the credential_process command line.
+func credentialProcessCommand(exe string, args []string) string {
+	parts := []string{quoteArg(exe)}
+	for _, a := range args {
+		parts = append(parts, quoteArg(a))
+	}
+	parts = append(parts, "--"+keyOutputFormat, "credential-process")
+	return strings.Join(parts, " ")
+}
+
+// quoteArg quotes a command line argument if it contains spaces or quotes.
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestCredentialProcessCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		exe  string
+		args []string
+		want string
+	}{
+		{
+			name: "no flags",
+			exe:  "/usr/local/bin/jc2aws",
+			want: "/usr/local/bin/jc2aws --output-format credential-process",
+		},
+		{
+			name: "account and role",
+			exe:  "/usr/local/bin/jc2aws",
+			args: []string{"--account", "prod", "--role-name", "admin"},
+			want: "/usr/local/bin/jc2aws --account prod --role-name admin --output-format credential-process",
+		},
+		{
+			name: "paths with spaces are quoted",
+			exe:  "/Applications/My Tools/jc2aws",
+			args: []string{"--config", "/home/user/my config.yaml"},
+			want: `"/Applications/My Tools/jc2aws" --config "/home/user/my config.yaml" --output-format credential-process`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := credentialProcessCommand(tt.exe, tt.args); got != tt.want {
+				t.Errorf("credentialProcessCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialProcessArgs(t *testing.T) {
+	flags := pflag.NewFlagSet("setup-credential-process", pflag.ContinueOnError)
+	for _, name := range append([]string{keyPassword, keyMFA}, credentialProcessFlags...) {
+		flags.String(name, "", "")
+	}
+	err := flags.Parse([]string{
+		"--account", "prod",
+		"--password", "secret",
+		"--mfa", "JBSWY3DPEHPK3PXP",
+		"--mfa-method", "push",
+		"--jc-console-url", "https://console.eu.jumpcloud.com",
+		"--sts-endpoint", "https://sts.eu-west-1.amazonaws.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"--account", "prod",
+		"--jc-console-url", "https://console.eu.jumpcloud.com",
+		"--mfa-method", "push",
+		"--sts-endpoint", "https://sts.eu-west-1.amazonaws.com",
+	}
+	if got := credentialProcessArgs(flags); !slices.Equal(got, want) {
+		t.Errorf("credentialProcessArgs() = %q, want %q (password and MFA must not be copied)", got, want)
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"", `""`},
+		{"with space", `"with space"`},
+		{`with"quote`, `"with\"quote"`},
+	}
+	for _, tt := range tests {
+		if got := quoteArg(tt.in); got != tt.want {
+			t.Errorf("quoteArg(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsStdoutFormat(t *testing.T) {
+	for _, f := range []string{"cli-stdout", "env-stdout", "json-stdout", "export", "credential-process"} {
+		if !isStdoutFormat(f) {
+			t.Errorf("isStdoutFormat(%q): want true", f)
+		}
+	}
+	for _, f := range []string{"cli", "env", "json", "shell", ""} {
+		if isStdoutFormat(f) {
+			t.Errorf("isStdoutFormat(%q): want false", f)
+		}
+	}
+}
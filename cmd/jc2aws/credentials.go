@@ -1,86 +1,347 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
 
 	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/config"
 	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/saml"
+	"github.com/yousysadmin/jc2aws/internal/secrets"
+	"github.com/yousysadmin/jc2aws/internal/shellenv"
 	"github.com/yousysadmin/jc2aws/internal/totp"
+	"github.com/yousysadmin/jc2aws/internal/utils"
 )
 
-// getCredentials authenticates via JumpCloud and retrieves temporary AWS credentials.
-func getCredentials(email, password, idpURL, mfa, principalARN, roleARN, region string, duration int) (aws.AwsSamlOutput, error) {
+// credentialRequest holds the resolved values used to obtain credentials.
+type credentialRequest struct {
+	Email    string
+	Password string
+	IdpURL   string
+	MFA      string
+	// ConsoleURL is the JumpCloud console URL, the default one if empty.
+	ConsoleURL string
+	// ReuseSession saves the JumpCloud session and reuses it until it expires.
+	ReuseSession bool
+	// MFAMethod is the JumpCloud MFA factor (auto, totp, push or duo).
+	MFAMethod string
+	// OnPush is called with the MFA method when a JumpCloud Protect or Duo push notification was sent.
+	OnPush func(method string)
+	// OnTOTPWait is called every second while waiting for a new TOTP code
+	// with the remaining time, and with 0 when the wait is over.
+	OnTOTPWait func(remaining time.Duration)
+	// OnClockSkew is called when the local clock is off from the JumpCloud server
+	// clock and the TOTP code is generated with the server time.
+	OnClockSkew func(skew time.Duration)
+	// PrincipalARN and RoleARN are optional, missing values are
+	// discovered from the SAML assertion.
+	PrincipalARN string
+	RoleARN      string
+	// RoleName is matched against roles from the SAML assertion
+	// when RoleARN is not set.
+	RoleName string
+	Region   string
+	Duration int
+	// DurationFromSAML allows the SessionDuration SAML attribute
+	// to replace Duration (Duration was not set explicitly).
+	DurationFromSAML bool
+	// Chain roles assumed after the SAML login, credentials of the last one are returned.
+	Chain []aws.AssumeRoleInput
+}
+
+// withSecrets returns the request with secret references (cmd:, env:, file:, keyring:) in the
+// password and MFA resolved. Only values set by flag, env var or config of the account are
+// references, values typed in the TUI are used as they are. It is called right before
+// logging in, so commands and keyring lookups don't run when cached credentials are used.
+func (req credentialRequest) withSecrets(acc *config.Account) (credentialRequest, error) {
 	var err error
+	if resolveString(keyPassword, acc) != "" {
+		if req.Password, err = secrets.Resolve(req.Password); err != nil {
+			return req, fmt.Errorf("password: %w", err)
+		}
+	}
+	if resolveString(keyMFA, acc) != "" {
+		if req.MFA, err = secrets.Resolve(req.MFA); err != nil {
+			return req, fmt.Errorf("MFA: %w", err)
+		}
+	}
+	return req, nil
+}
+
+// samlRolesError is returned when the SAML assertion contains several roles
+// and the request doesn't say which one to assume.
+type samlRolesError struct {
+	roles []saml.Role
+}
+
+func (e *samlRolesError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SAML assertion contains %d roles, use --role-arn or --role-name to pick one:", len(e.roles))
+	for _, r := range e.roles {
+		b.WriteString("\n  " + r.RoleArn)
+	}
+	return b.String()
+}
+
+// getCredentials authenticates via JumpCloud and retrieves temporary AWS credentials.
+func getCredentials(req credentialRequest) (aws.AwsSamlOutput, error) {
+	assertion, err := getSamlAssertion(req)
+	if err != nil {
+		return aws.AwsSamlOutput{}, err
+	}
+	return assumeSamlRole(req, assertion)
+}
 
-	// If MFA value length > 6, treat as secret and derive TOTP
-	if len(mfa) > 6 {
-		mfa, err = totp.GetToken(mfa)
+// getSamlAssertion authenticates via JumpCloud and returns the SAMLResponse.
+func getSamlAssertion(req credentialRequest) (string, error) {
+	jc, err := newJumpCloudClient(req)
+	if err != nil {
+		return "", err
+	}
+	return getSamlWithSession(&jc, req.ReuseSession)
+}
+
+// newJumpCloudClient creates the JumpCloud client for the request.
+// Secret references must be resolved with withSecrets first.
+func newJumpCloudClient(req credentialRequest) (jumpcloud.JumpCloud, error) {
+	mfa := req.MFA
+
+	// A value which is not a one-time code is a TOTP secret or otpauth:// URI. The code is
+	// derived when logging in, with the JumpCloud server time if the local clock is off.
+	var mfaTokenFunc func(skew time.Duration) (string, error)
+	if mfa != "" && !totp.IsCode(mfa) {
+		key, err := totp.ParseKey(mfa)
 		if err != nil {
-			return aws.AwsSamlOutput{}, err
+			return jumpcloud.JumpCloud{}, err
+		}
+		mfa = ""
+		mfaTokenFunc = func(skew time.Duration) (string, error) {
+			if skew != 0 && req.OnClockSkew != nil {
+				req.OnClockSkew(skew)
+			}
+			return totpCode(key, skew, req.OnTOTPWait)
 		}
 	}
 
-	jc, err := jumpcloud.New(email, password, idpURL, mfa)
+	return jumpcloud.NewWithConfig(jumpcloud.JumpCloud{
+		Email:        req.Email,
+		Password:     req.Password,
+		IdpURL:       req.IdpURL,
+		MFAToken:     mfa,
+		MFATokenFunc: mfaTokenFunc,
+		MFAMethod:    req.MFAMethod,
+		ConsoleURL:   req.ConsoleURL,
+		OnPush:       req.OnPush,
+	})
+}
+
+// totpCode generates the code of the TOTP key for a time step no previous login used,
+// at the local time shifted by the clock skew to the JumpCloud server.
+// JumpCloud rejects a code used twice, so the next time step is awaited unless --no-wait is set.
+// Used time steps are saved in the cache directory, shared by concurrent jc2aws processes.
+func totpCode(key totp.Key, skew time.Duration, onWait func(time.Duration)) (string, error) {
+	clock := func() time.Time { return time.Now().Add(skew) }
+
+	dir, err := cache.DefaultDir()
 	if err != nil {
-		return aws.AwsSamlOutput{}, err
+		fmt.Fprintf(os.Stderr, "Warning: TOTP reuse check disabled: %v\n", err)
+		return key.Generate(clock())
+	}
+	g := totp.NewGuard(filepath.Join(dir, "totp"))
+	g.NoWait = viper.GetBool(keyNoWait)
+	g.OnWait = onWait
+	g.Clock = clock
+
+	code, err := g.Code(context.Background(), key)
+	if _, ok := errors.AsType[*totp.CodeUsedError](err); ok {
+		return "", fmt.Errorf("%w (--%s is set)", err, keyNoWait)
+	}
+	return code, err
+}
+
+// printTOTPWait shows the countdown until a new TOTP code is available.
+func printTOTPWait(remaining time.Duration) {
+	if remaining == 0 {
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\rTOTP code already used, waiting %2ds for the next one...", int(remaining.Round(time.Second).Seconds()))
+}
+
+// clockSkewWarning describes the clock skew to the JumpCloud server.
+func clockSkewWarning(skew time.Duration) string {
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead of"
 	}
-	saml, err := jc.GetSaml()
+	return fmt.Sprintf("the local clock is %s %s JumpCloud, TOTP codes are generated with the JumpCloud time. "+
+		"Synchronize the system clock (e.g. enable NTP)", skew.Abs().Round(time.Second), direction)
+}
+
+// printClockSkewWarning warns that the local clock is off.
+func printClockSkewWarning(skew time.Duration) {
+	fmt.Fprintln(os.Stderr, "Warning: "+clockSkewWarning(skew))
+}
+
+// printPushNotice asks the user to approve the push notification of the MFA method.
+func printPushNotice(method string) {
+	fmt.Fprintln(os.Stderr, pushNotice(method)+" to continue...")
+}
+
+// pushNotice returns the request to approve the push notification of the MFA method.
+func pushNotice(method string) string {
+	if method == jumpcloud.MFAMethodDuo {
+		return "Approve the Duo push notification"
+	}
+	return "Approve the push notification in JumpCloud Protect"
+}
+
+// assumeSamlRole exchanges the SAML assertion for temporary AWS credentials.
+func assumeSamlRole(req credentialRequest, assertion string) (aws.AwsSamlOutput, error) {
+	req, err := resolveSamlRole(req, assertion)
 	if err != nil {
 		return aws.AwsSamlOutput{}, err
 	}
 
 	cred, err := aws.GetCredentials(aws.AwsSamlInput{
-		PrincipalArn:    principalARN,
-		RoleArn:         roleARN,
-		SAMLAssertion:   saml,
-		DurationSeconds: int32(duration),
-		Region:          region,
+		PrincipalArn:    req.PrincipalARN,
+		RoleArn:         req.RoleARN,
+		SAMLAssertion:   assertion,
+		DurationSeconds: int32(req.Duration),
+		Region:          req.Region,
 	})
-	if err != nil {
-		return aws.AwsSamlOutput{}, err
+	if err != nil || len(req.Chain) == 0 {
+		return cred, err
 	}
-	return cred, nil
+	return aws.AssumeRoleChain(cred, req.Chain)
 }
 
-// outputCredentials writes credentials in the selected format.
-func outputCredentials(cred aws.AwsSamlOutput, format, profileName string) error {
-	homeDir, err := os.UserHomeDir()
+// targetRoleARN returns the ARN of the role credentials are issued for,
+// the last role of the chain if there is one.
+func (r credentialRequest) targetRoleARN() string {
+	if len(r.Chain) > 0 {
+		return r.Chain[len(r.Chain)-1].RoleArn
+	}
+	return r.RoleARN
+}
+
+// roleChain converts the chain of a configured role to AssumeRole inputs.
+func roleChain(role config.AWSRole) []aws.AssumeRoleInput {
+	var chain []aws.AssumeRoleInput
+	for _, hop := range role.Chain {
+		chain = append(chain, aws.AssumeRoleInput{
+			RoleArn:         hop.AssumeRoleArn,
+			ExternalID:      hop.ExternalID,
+			SessionName:     hop.SessionName,
+			SourceIdentity:  hop.SourceIdentity,
+			DurationSeconds: int32(hop.Duration),
+		})
+	}
+	return chain
+}
+
+// resolveSamlRole fills the role, principal and duration missing from the
+// request using attributes of the SAML assertion.
+func resolveSamlRole(req credentialRequest, assertion string) (credentialRequest, error) {
+	complete := req.RoleARN != "" && req.PrincipalARN != ""
+	if complete && !req.DurationFromSAML {
+		return req, nil
+	}
+
+	a, err := saml.Parse(assertion)
+	if err != nil {
+		if complete {
+			// Attributes are only a nice-to-have when both ARNs are known
+			return req, nil
+		}
+		return req, err
+	}
+
+	if req.DurationFromSAML && a.SessionDuration > 0 {
+		req.Duration = a.SessionDuration
+	}
+	if complete {
+		return req, nil
+	}
+
+	role, err := selectSamlRole(a, req.RoleARN, req.RoleName)
 	if err != nil {
-		return fmt.Errorf("failed to determine home directory: %w", err)
+		return req, err
 	}
+	req.RoleARN = role.RoleArn
+	req.PrincipalARN = role.PrincipalArn
+
+	return req, nil
+}
+
+// selectSamlRole picks a role from the SAML assertion by ARN, by name,
+// or the only available one.
+func selectSamlRole(a *saml.Assertion, roleARN, roleName string) (saml.Role, error) {
+	switch {
+	case roleARN != "":
+		return a.FindRole(roleARN)
+	case roleName != "":
+		return a.FindRoleByName(roleName)
+	}
+
+	switch len(a.Roles) {
+	case 0:
+		return saml.Role{}, errors.New("SAML assertion doesn't contain any AWS roles")
+	case 1:
+		return a.Roles[0], nil
+	default:
+		return saml.Role{}, &samlRolesError{roles: a.Roles}
+	}
+}
+
+// stdoutFormats are output formats that print credentials to stdout.
+var stdoutFormats = []string{"cli-stdout", "env-stdout", "json-stdout", "export", "credential-process", "console"}
+
+// isStdoutFormat reports whether the output format prints credentials to stdout.
+func isStdoutFormat(format string) bool {
+	return slices.Contains(stdoutFormats, format)
+}
 
+// outputCredentials writes credentials in the selected format.
+// The account (nil if not set) provides profile settings and the account name of the json formats.
+func outputCredentials(cred aws.AwsSamlOutput, format, profileName string, acc *config.Account) error {
 	switch format {
 	case "cli":
-		awsDir := filepath.Join(homeDir, ".aws")
-		if err := os.MkdirAll(awsDir, 0700); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", awsDir, err)
+		if err := writeAwsProfile(cred, profileName, acc); err != nil {
+			return err
 		}
 
-		filePathCreds := filepath.Join(awsDir, "credentials")
-		creds, err := cred.ToAwsCredentials(profileName, filePathCreds)
+	case "env":
+		filePath, err := resolveEnvFile(acc)
 		if err != nil {
-			return fmt.Errorf("failed to prepare AWS credentials: %w", err)
+			return err
 		}
-		if err := os.WriteFile(filePathCreds, creds, 0600); err != nil {
+		if err := os.WriteFile(filePath, []byte(cred.ToEnvFile()), 0600); err != nil {
 			return err
 		}
 
-		filePathConf := filepath.Join(awsDir, "config")
-		conf, err := cred.ToAwsConfig(profileName, filePathConf)
+	case "json":
+		c, err := cred.ToJSON(accountName(acc), viper.GetBool(keyJSONOmitSecrets))
 		if err != nil {
-			return fmt.Errorf("failed to prepare AWS config: %w", err)
+			return fmt.Errorf("failed to prepare JSON output: %w", err)
 		}
-		if err := os.WriteFile(filePathConf, conf, 0600); err != nil {
+		filePath, err := resolveJSONFile(acc)
+		if err != nil {
 			return err
 		}
-
-	case "env":
-		filePath := filepath.Join(homeDir, ".jc2aws.env")
-		if err := os.WriteFile(filePath, []byte(cred.PrintEnv()), 0600); err != nil {
+		if err := utils.WriteFileAtomic(filePath, append(c, '\n'), 0600); err != nil {
 			return err
 		}
 
@@ -95,6 +356,42 @@ func outputCredentials(cred aws.AwsSamlOutput, format, profileName string) error
 			return err
 		}
 
+	case "export":
+		c, err := shellenv.Export(viper.GetString(keyShellSyntax), shellenv.ParseEnv(cred.ToEnv()))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(os.Stdout, c); err != nil {
+			return err
+		}
+
+	case "json-stdout":
+		c, err := cred.ToJSON(accountName(acc), viper.GetBool(keyJSONOmitSecrets))
+		if err != nil {
+			return fmt.Errorf("failed to prepare JSON output: %w", err)
+		}
+		if _, err := os.Stdout.Write(append(c, '\n')); err != nil {
+			return err
+		}
+
+	case "credential-process":
+		c, err := cred.ToCredentialProcess()
+		if err != nil {
+			return fmt.Errorf("failed to prepare credential process output: %w", err)
+		}
+		if _, err := os.Stdout.Write(append(c, '\n')); err != nil {
+			return err
+		}
+
+	case "console":
+		u, err := consoleURL(context.Background(), cred)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(os.Stdout, u); err != nil {
+			return err
+		}
+
 	default:
 		return fmt.Errorf("unsupported output format: %s", format)
 	}
@@ -102,10 +399,128 @@ func outputCredentials(cred aws.AwsSamlOutput, format, profileName string) error
 	return nil
 }
 
-// launchShell starts an interactive shell with AWS credential env vars injected.
-func launchShell(cred aws.AwsSamlOutput, scriptName string) error {
-	env := cred.ToEnv()
-	sysEnv := os.Environ()
+// writeAwsProfile writes credentials as the profile into the AWS credentials file
+// and the region and settings of the account into the AWS config file.
+func writeAwsProfile(cred aws.AwsSamlOutput, profileName string, acc *config.Account) error {
+	files, err := resolveAwsFiles(acc)
+	if err != nil {
+		return err
+	}
+	return writeAwsProfiles(files, []aws.AwsProfile{awsProfile(profileName, cred, acc)})
+}
+
+// awsProfile returns the profile with the AWS config file settings of the account (nil if not set).
+func awsProfile(name string, cred aws.AwsSamlOutput, acc *config.Account) aws.AwsProfile {
+	p := aws.AwsProfile{Name: name, Credentials: cred}
+	if acc == nil {
+		return p
+	}
+	p.Config = acc.AWSConfig.Settings()
+	if acc.AWSConfig.Metadata {
+		p.Config["jc2aws_account"] = acc.Name
+		if cred.Expiration != nil {
+			p.Config["jc2aws_expiration"] = cred.Expiration.UTC().Format(time.RFC3339)
+		}
+	}
+	return p
+}
+
+// awsFiles holds paths of the AWS credentials and config files written by the cli format.
+type awsFiles struct {
+	credentials string
+	config      string
+}
+
+// resolveAwsFiles returns paths of the AWS files of the account: --credentials-file and
+// --config-file-out (or the config file params), then AWS_SHARED_CREDENTIALS_FILE and
+// AWS_CONFIG_FILE like in the AWS CLI, then the files in ~/.aws.
+func resolveAwsFiles(acc *config.Account) (awsFiles, error) {
+	credentials, err := resolvePath(keyCredentialsFile, acc, aws.SharedCredentialsFile)
+	if err != nil {
+		return awsFiles{}, err
+	}
+	conf, err := resolvePath(keyConfigFileOut, acc, aws.SharedConfigFile)
+	if err != nil {
+		return awsFiles{}, err
+	}
+	return awsFiles{credentials: credentials, config: conf}, nil
+}
+
+// resolveEnvFile returns the path of the file written by the env format.
+func resolveEnvFile(acc *config.Account) (string, error) {
+	return resolvePath(keyEnvFile, acc, func() (string, error) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine home directory: %w", err)
+		}
+		return filepath.Join(homeDir, ".jc2aws.env"), nil
+	})
+}
+
+// resolveJSONFile returns the path of the file written by the json format.
+func resolveJSONFile(acc *config.Account) (string, error) {
+	return resolvePath(keyJSONFile, acc, func() (string, error) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine home directory: %w", err)
+		}
+		return filepath.Join(homeDir, ".jc2aws.json"), nil
+	})
+}
+
+// resolvePath returns the path set by the flag, env var or config file with ~ and
+// environment variables expanded, or the path returned by fallback if not set.
+func resolvePath(key string, acc *config.Account, fallback func() (string, error)) (string, error) {
+	if path := resolveString(key, acc); path != "" {
+		return utils.ExpandPath(path)
+	}
+	return fallback()
+}
+
+// writeAwsProfiles writes several profiles with one locked update of each file,
+// keeping comments and other profiles of the files.
+func writeAwsProfiles(files awsFiles, profiles []aws.AwsProfile) error {
+	err := aws.UpdateSharedFile(files.credentials, func() ([]byte, error) {
+		return aws.ProfilesToAwsCredentials(profiles, files.credentials)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write AWS credentials: %w", err)
+	}
+
+	err = aws.UpdateSharedFile(files.config, func() ([]byte, error) {
+		return aws.ProfilesToAwsConfig(profiles, files.config)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write AWS config: %w", err)
+	}
+	return nil
+}
+
+// verifyCredentials checks the credentials with sts:GetCallerIdentity if --verify is set
+// and returns their identity, nil if not set.
+func verifyCredentials(ctx context.Context, cred aws.AwsSamlOutput) (*aws.CallerIdentity, error) {
+	if !viper.GetBool(keyVerify) {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	identity, err := aws.GetCallerIdentity(ctx, cred)
+	if err != nil {
+		return nil, fmt.Errorf("credentials verification failed: %w", err)
+	}
+	return &identity, nil
+}
+
+// printIdentity prints the account ID, ARN and session name of the identity.
+func printIdentity(w io.Writer, identity aws.CallerIdentity) {
+	fmt.Fprintf(w, "Account: %s\nARN:     %s\n", identity.Account, identity.Arn)
+	if identity.SessionName != "" {
+		fmt.Fprintf(w, "Session: %s\n", identity.SessionName)
+	}
+}
+
+// launchShell starts an interactive shell (or runs the script with it) with the environment.
+func launchShell(env []string, scriptName string) error {
 	curShell := os.Getenv("SHELL")
 	if curShell == "" {
 		curShell = "/bin/sh"
@@ -117,7 +532,7 @@ func launchShell(cred aws.AwsSamlOutput, scriptName string) error {
 	} else {
 		cmd = exec.Command(curShell, "-i")
 	}
-	cmd.Env = append(sysEnv, env...)
+	cmd.Env = env
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
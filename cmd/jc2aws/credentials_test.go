@@ -4,3 +4,590 @@ package main
 // real stdout). The outputCredentials function is exercised through the
 // headless and TUI integration paths. The formatCredentials helper that
 // previously lived here was removed as part of the stdout-output refactor.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+	"github.com/yousysadmin/jc2aws/internal/saml"
+	"github.com/yousysadmin/jc2aws/internal/totp"
+)
+
+// testSamlAssertion returns a base64 encoded SAMLResponse with given
+// "role,principal" values and optional SessionDuration (0 to omit).
+func testSamlAssertion(duration int, roles ...string) string {
+	var b strings.Builder
+	b.WriteString(`<Response><Assertion><AttributeStatement>`)
+	b.WriteString(`<Attribute Name="` + saml.AttributeRole + `">`)
+	for _, r := range roles {
+		b.WriteString(`<AttributeValue>` + r + `</AttributeValue>`)
+	}
+	b.WriteString(`</Attribute>`)
+	if duration > 0 {
+		fmt.Fprintf(&b, `<Attribute Name="%s"><AttributeValue>%d</AttributeValue></Attribute>`, saml.AttributeSessionDuration, duration)
+	}
+	b.WriteString(`</AttributeStatement></Assertion></Response>`)
+	return base64.StdEncoding.EncodeToString([]byte(b.String()))
+}
+
+const (
+	testRoleAdmin    = "arn:aws:iam::111:role/admin,arn:aws:iam::111:saml-provider/jc"
+	testRoleReadOnly = "arn:aws:iam::111:role/readonly,arn:aws:iam::111:saml-provider/jc"
+)
+
+// ---------------------------------------------------------------------------
+// resolveSamlRole tests
+// ---------------------------------------------------------------------------
+
+func TestResolveSamlRole_SingleRoleDiscovered(t *testing.T) {
+	req, err := resolveSamlRole(credentialRequest{}, testSamlAssertion(0, testRoleAdmin))
+	if err != nil {
+		t.Fatalf("resolveSamlRole: unexpected error: %v", err)
+	}
+	if req.RoleARN != "arn:aws:iam::111:role/admin" {
+		t.Errorf("RoleARN: want admin role, got %q", req.RoleARN)
+	}
+	if req.PrincipalARN != "arn:aws:iam::111:saml-provider/jc" {
+		t.Errorf("PrincipalARN: want jc provider, got %q", req.PrincipalARN)
+	}
+}
+
+func TestResolveSamlRole_MultipleRolesFails(t *testing.T) {
+	_, err := resolveSamlRole(credentialRequest{}, testSamlAssertion(0, testRoleAdmin, testRoleReadOnly))
+
+	rolesErr, ok := errors.AsType[*samlRolesError](err)
+	if !ok {
+		t.Fatalf("resolveSamlRole: want *samlRolesError, got %v", err)
+	}
+	if len(rolesErr.roles) != 2 {
+		t.Errorf("want 2 roles in error, got %d", len(rolesErr.roles))
+	}
+	if !strings.Contains(err.Error(), "arn:aws:iam::111:role/readonly") {
+		t.Errorf("error should list available roles, got %q", err.Error())
+	}
+}
+
+func TestResolveSamlRole_ByRoleName(t *testing.T) {
+	req, err := resolveSamlRole(credentialRequest{RoleName: "readonly"}, testSamlAssertion(0, testRoleAdmin, testRoleReadOnly))
+	if err != nil {
+		t.Fatalf("resolveSamlRole: unexpected error: %v", err)
+	}
+	if req.RoleARN != "arn:aws:iam::111:role/readonly" {
+		t.Errorf("RoleARN: want readonly role, got %q", req.RoleARN)
+	}
+}
+
+func TestResolveSamlRole_RoleARNWithoutPrincipal(t *testing.T) {
+	req, err := resolveSamlRole(credentialRequest{RoleARN: "arn:aws:iam::111:role/admin"}, testSamlAssertion(0, testRoleAdmin, testRoleReadOnly))
+	if err != nil {
+		t.Fatalf("resolveSamlRole: unexpected error: %v", err)
+	}
+	if req.PrincipalARN != "arn:aws:iam::111:saml-provider/jc" {
+		t.Errorf("PrincipalARN: want principal from assertion, got %q", req.PrincipalARN)
+	}
+}
+
+func TestResolveSamlRole_UnknownRoleARN(t *testing.T) {
+	_, err := resolveSamlRole(credentialRequest{RoleARN: "arn:aws:iam::222:role/admin"}, testSamlAssertion(0, testRoleAdmin))
+	if err == nil {
+		t.Error("resolveSamlRole: want error for role not in assertion")
+	}
+}
+
+func TestResolveSamlRole_NoRoles(t *testing.T) {
+	_, err := resolveSamlRole(credentialRequest{}, testSamlAssertion(0))
+	if err == nil {
+		t.Error("resolveSamlRole: want error for assertion without roles")
+	}
+}
+
+func TestResolveSamlRole_CompleteRequestIgnoresInvalidAssertion(t *testing.T) {
+	in := credentialRequest{RoleARN: "role", PrincipalARN: "principal", Duration: 3600, DurationFromSAML: true}
+	req, err := resolveSamlRole(in, "not-a-saml-response")
+	if err != nil {
+		t.Fatalf("resolveSamlRole: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(req, in) {
+		t.Errorf("request should be unchanged, got %+v", req)
+	}
+}
+
+func TestResolveSamlRole_SessionDuration(t *testing.T) {
+	assertion := testSamlAssertion(7200, testRoleAdmin)
+
+	req, err := resolveSamlRole(credentialRequest{Duration: 3600, DurationFromSAML: true}, assertion)
+	if err != nil {
+		t.Fatalf("resolveSamlRole: unexpected error: %v", err)
+	}
+	if req.Duration != 7200 {
+		t.Errorf("Duration: want 7200 from SAML, got %d", req.Duration)
+	}
+
+	req, err = resolveSamlRole(credentialRequest{Duration: 1800}, assertion)
+	if err != nil {
+		t.Fatalf("resolveSamlRole: unexpected error: %v", err)
+	}
+	if req.Duration != 1800 {
+		t.Errorf("Duration: want explicit 1800, got %d", req.Duration)
+	}
+}
+
+func TestWithSecrets(t *testing.T) {
+	resetViper()
+	t.Setenv("J2A_TEST_PASSWORD", "resolved")
+	viper.Set(keyPassword, "env:J2A_TEST_PASSWORD")
+	acc := &config.Account{MFASecret: "plain:123456"}
+
+	req, err := credentialRequest{Password: "env:J2A_TEST_PASSWORD", MFA: "plain:123456"}.withSecrets(acc)
+	if err != nil || req.Password != "resolved" || req.MFA != "123456" {
+		t.Errorf("withSecrets() = %q, %q, %v, want the flag and account references resolved", req.Password, req.MFA, err)
+	}
+}
+
+func TestWithSecrets_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		req  credentialRequest
+		want string
+	}{
+		{"password", keyPassword, credentialRequest{Password: "env:J2A_TEST_MISSING_PASSWORD"}, "password:"},
+		{"mfa", keyMFA, credentialRequest{Password: "secret", MFA: "env:J2A_TEST_MISSING_MFA"}, "MFA:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetViper()
+			viper.Set(tt.key, "env:J2A_TEST_MISSING")
+			_, err := tt.req.withSecrets(nil)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("withSecrets: want %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestNewJumpCloudClient_MFA(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name   string
+		mfa    string
+		digits int
+		code   bool
+	}{
+		{"code", "123456", 6, true},
+		{"8-digit code", "12345678", 8, true},
+		{"secret", "JBSWY3DPEHPK3PXP", 6, false},
+		{"otpauth uri", "otpauth://totp/JumpCloud:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA256&digits=8", 8, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jc, err := newJumpCloudClient(credentialRequest{Email: "user@example.com", Password: "secret", IdpURL: "https://sso.jumpcloud.com/saml2/aws", MFA: tt.mfa})
+			if err != nil {
+				t.Fatalf("newJumpCloudClient: %v", err)
+			}
+			// Codes of secrets are generated when logging in
+			if (jc.MFATokenFunc == nil) != tt.code {
+				t.Fatalf("MFATokenFunc set = %v for MFA %q", jc.MFATokenFunc != nil, tt.mfa)
+			}
+			token := jc.MFAToken
+			if jc.MFATokenFunc != nil {
+				if token, err = jc.MFATokenFunc(0); err != nil {
+					t.Fatalf("MFATokenFunc: %v", err)
+				}
+			}
+			if len(token) != tt.digits || (token == tt.mfa) != tt.code {
+				t.Errorf("MFA token = %q for MFA %q", token, tt.mfa)
+			}
+		})
+	}
+
+	if _, err := newJumpCloudClient(credentialRequest{Password: "secret", MFA: "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP"}); err == nil {
+		t.Error("newJumpCloudClient: want error for hotp URI")
+	}
+}
+
+func TestTotpCode_NoWait(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	viper.Set(keyNoWait, true)
+
+	key, _ := totp.ParseKey("JBSWY3DPEHPK3PXP")
+	if _, err := totpCode(key, 0, nil); err != nil {
+		t.Fatalf("totpCode: %v", err)
+	}
+	// The code of the current time step was used by the first login
+	_, err := totpCode(key, 0, nil)
+	if _, ok := errors.AsType[*totp.CodeUsedError](err); !ok || !strings.Contains(err.Error(), "--no-wait") {
+		t.Errorf("totpCode: want CodeUsedError mentioning --no-wait, got %v", err)
+	}
+}
+
+func TestGetCredentials_ClockSkew(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	const skew = -3 * time.Minute
+	key, _ := totp.ParseKey("JBSWY3DPEHPK3PXP")
+	code, _ := key.Generate(time.Now().Add(skew))
+
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = code
+	jc.ClockSkew = skew
+	jc.Start()
+	defer jc.Close()
+
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+
+	var reported time.Duration
+	_, err := getCredentials(credentialRequest{
+		Email:       jumpcloudtest.DefaultEmail,
+		Password:    jumpcloudtest.DefaultPassword,
+		IdpURL:      jc.IdpURL(),
+		ConsoleURL:  jc.URL,
+		MFA:         "JBSWY3DPEHPK3PXP",
+		OnClockSkew: func(s time.Duration) { reported = s },
+		Region:      "eu-west-1",
+		Duration:    3600,
+	})
+	if err != nil {
+		t.Fatalf("getCredentials() error = %v, want a code generated with the JumpCloud time", err)
+	}
+	if (reported - skew).Abs() > 2*time.Second {
+		t.Errorf("OnClockSkew got %s, want about %s", reported, skew)
+	}
+}
+
+func TestClockSkewWarning(t *testing.T) {
+	if got := clockSkewWarning(42 * time.Second); !strings.HasPrefix(got, "the local clock is 42s behind JumpCloud") {
+		t.Errorf("clockSkewWarning(42s) = %q", got)
+	}
+	if got := clockSkewWarning(-2 * time.Minute); !strings.HasPrefix(got, "the local clock is 2m0s ahead of JumpCloud") {
+		t.Errorf("clockSkewWarning(-2m) = %q", got)
+	}
+}
+
+// stubSTSWithSAML fake AWS STS answering AssumeRoleWithSAML, received requests are stored in calls.
+// GetCallerIdentity returns the identity of the assumed role and is not stored.
+func stubSTSWithSAML(t *testing.T, calls *[]url.Values) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err == nil && r.Form.Get("Action") == "GetCallerIdentity" {
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:sts::111:assumed-role/admin/user@example.com</Arn>
+    <UserId>AROAEXAMPLE:user@example.com</UserId>
+    <Account>111</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "AssumeRoleWithSAML" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		*calls = append(*calls, r.Form)
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<AssumeRoleWithSAMLResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithSAMLResult>
+    <Credentials>
+      <AccessKeyId>AKIASAML</AccessKeyId>
+      <SecretAccessKey>SECRETSAML</SecretAccessKey>
+      <SessionToken>TOKENSAML</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithSAMLResult>
+</AssumeRoleWithSAMLResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+
+	aws.STSEndpoint = srv.URL
+	t.Cleanup(func() { aws.STSEndpoint = "" })
+}
+
+func TestGetCredentials_Offline(t *testing.T) {
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = "123456"
+	jc.SessionDuration = 7200
+	jc.Start()
+	defer jc.Close()
+
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+
+	cred, err := getCredentials(credentialRequest{
+		Email:            jumpcloudtest.DefaultEmail,
+		Password:         jumpcloudtest.DefaultPassword,
+		IdpURL:           jc.IdpURL(),
+		ConsoleURL:       jc.URL,
+		MFA:              "123456",
+		Region:           "eu-west-1",
+		Duration:         3600,
+		DurationFromSAML: true,
+	})
+	if err != nil {
+		t.Fatalf("getCredentials() error = %v", err)
+	}
+	if cred.AccessKeyID != "AKIASAML" || cred.Region != "eu-west-1" {
+		t.Errorf("getCredentials() got = %+v, want STS credentials in eu-west-1", cred)
+	}
+	if cred.RoleArn != jumpcloudtest.DefaultRole.RoleArn || cred.PrincipalArn != jumpcloudtest.DefaultRole.PrincipalArn {
+		t.Errorf("getCredentials() got role %q, principal %q, want the discovered role", cred.RoleArn, cred.PrincipalArn)
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("getCredentials() made %d STS calls, want 1", len(calls))
+	}
+	want := map[string]string{
+		"RoleArn":         jumpcloudtest.DefaultRole.RoleArn,
+		"PrincipalArn":    jumpcloudtest.DefaultRole.PrincipalArn,
+		"SAMLAssertion":   jc.SAMLResponse(),
+		"DurationSeconds": "7200",
+	}
+	for k, v := range want {
+		if got := calls[0].Get(k); got != v {
+			t.Errorf("AssumeRoleWithSAML %s got = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestOutputCredentials_JSON(t *testing.T) {
+	resetViper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	cred := aws.AwsSamlOutput{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Region:          "us-east-1",
+		RoleArn:         "arn:aws:iam::111:role/admin",
+	}
+	viper.Set(keyJSONOmitSecrets, true)
+	if err := outputCredentials(cred, "json", "", &config.Account{Name: "prod"}); err != nil {
+		t.Fatalf("outputCredentials() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".jc2aws.json"))
+	if err != nil {
+		t.Fatalf("failed to read JSON file: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON file: %v", err)
+	}
+	if got["account"] != "prod" || got["role_arn"] != cred.RoleArn || got["access_key_id"] != "AKIA" {
+		t.Errorf("JSON file got = %v", got)
+	}
+	if _, ok := got["secret_access_key"]; ok {
+		t.Errorf("JSON file contains the secret access key with %s", keyJSONOmitSecrets)
+	}
+}
+
+func TestGetCredentials_OfflineErrors(t *testing.T) {
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = "123456"
+	jc.Roles = []jumpcloudtest.Role{
+		jumpcloudtest.DefaultRole,
+		{RoleArn: "arn:aws:iam::000000000000:role/jumpcloud-readonly", PrincipalArn: jumpcloudtest.DefaultRole.PrincipalArn},
+	}
+	jc.Start()
+	defer jc.Close()
+
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+
+	req := credentialRequest{
+		Email:      jumpcloudtest.DefaultEmail,
+		Password:   jumpcloudtest.DefaultPassword,
+		IdpURL:     jc.IdpURL(),
+		ConsoleURL: jc.URL,
+		MFA:        "123456",
+		Region:     "us-east-1",
+		Duration:   3600,
+	}
+
+	wrongPassword := req
+	wrongPassword.Password = "wrong"
+	if _, err := getCredentials(wrongPassword); err == nil || !strings.Contains(err.Error(), "Authentication failed.") {
+		t.Errorf("getCredentials() error = %v, want authentication failure", err)
+	}
+
+	missingMFA := req
+	missingMFA.MFA = ""
+	if _, err := getCredentials(missingMFA); err == nil || !strings.Contains(err.Error(), "MFA required") {
+		t.Errorf("getCredentials() error = %v, want MFA required", err)
+	}
+
+	_, err := getCredentials(req)
+	rolesErr, ok := errors.AsType[*samlRolesError](err)
+	if !ok || len(rolesErr.roles) != 2 {
+		t.Fatalf("getCredentials() error = %v, want samlRolesError with 2 roles", err)
+	}
+
+	req.RoleName = "jumpcloud-readonly"
+	if _, err := getCredentials(req); err != nil {
+		t.Fatalf("getCredentials() error = %v", err)
+	}
+	if got := calls[len(calls)-1].Get("RoleArn"); got != "arn:aws:iam::000000000000:role/jumpcloud-readonly" {
+		t.Errorf("AssumeRoleWithSAML RoleArn got = %q, want the role picked by name", got)
+	}
+	if len(calls) != 1 {
+		t.Errorf("getCredentials() made %d STS calls, want 1", len(calls))
+	}
+}
+
+func TestWriteAwsProfile_Settings(t *testing.T) {
+	resetViper()
+	dir := t.TempDir()
+	credsFile := filepath.Join(dir, "creds")
+	confFile := filepath.Join(dir, "conf")
+	t.Setenv(aws.EnvSharedCredentialsFile, credsFile)
+	t.Setenv(aws.EnvConfigFile, confFile)
+
+	expiration := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cred := aws.AwsSamlOutput{AccessKeyID: "AKIA", Region: "us-east-1", Expiration: &expiration}
+	acc := &config.Account{Name: "prod", AWSConfig: config.AWSProfileConfig{
+		Output:            "json",
+		S3AddressingStyle: "path",
+		Metadata:          true,
+	}}
+	if err := writeAwsProfile(cred, "prod-admin", acc); err != nil {
+		t.Fatalf("writeAwsProfile() error = %v", err)
+	}
+
+	creds, err := os.ReadFile(credsFile)
+	if err != nil {
+		t.Fatalf("credentials file not written to %s: %v", aws.EnvSharedCredentialsFile, err)
+	}
+	if !strings.Contains(string(creds), "[prod-admin]") {
+		t.Errorf("credentials file got:\n%s", creds)
+	}
+
+	conf, err := os.ReadFile(confFile)
+	if err != nil {
+		t.Fatalf("config file not written to %s: %v", aws.EnvConfigFile, err)
+	}
+	for _, want := range []string{
+		"[profile prod-admin]",
+		"jc2aws_account    = prod",
+		"jc2aws_expiration = 2026-01-02T03:04:05Z",
+		"output            = json",
+		"region            = us-east-1",
+		"s3 =\n  addressing_style = path",
+	} {
+		if !strings.Contains(string(conf), want) {
+			t.Errorf("config file does not contain %q, got:\n%s", want, conf)
+		}
+	}
+}
+
+func TestResolveAwsFiles(t *testing.T) {
+	resetViper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(aws.EnvSharedCredentialsFile, "/env/credentials")
+	t.Setenv(aws.EnvConfigFile, "")
+	t.Setenv("J2A_TEST_MOUNT", "/mnt/aws")
+
+	files, err := resolveAwsFiles(nil)
+	if err != nil {
+		t.Fatalf("resolveAwsFiles() error = %v", err)
+	}
+	if want := (awsFiles{credentials: "/env/credentials", config: filepath.Join(home, ".aws", "config")}); files != want {
+		t.Errorf("resolveAwsFiles() without paths got = %+v, want %+v", files, want)
+	}
+
+	acc := &config.Account{Name: "prod", CredentialsFile: "$J2A_TEST_MOUNT/credentials", ConfigFileOut: "~/aws/config"}
+	files, err = resolveAwsFiles(acc)
+	if err != nil {
+		t.Fatalf("resolveAwsFiles() error = %v", err)
+	}
+	if want := (awsFiles{credentials: "/mnt/aws/credentials", config: filepath.Join(home, "aws", "config")}); files != want {
+		t.Errorf("resolveAwsFiles() of the account got = %+v, want %+v", files, want)
+	}
+
+	// Flags and config file params win over the account
+	viper.Set(keyCredentialsFile, "/flag/credentials")
+	files, err = resolveAwsFiles(acc)
+	if err != nil {
+		t.Fatalf("resolveAwsFiles() error = %v", err)
+	}
+	if files.credentials != "/flag/credentials" || files.config != filepath.Join(home, "aws", "config") {
+		t.Errorf("resolveAwsFiles() with the flag got = %+v", files)
+	}
+}
+
+func TestOutputCredentials_EnvFile(t *testing.T) {
+	resetViper()
+	dir := t.TempDir()
+	viper.Set(keyEnvFile, filepath.Join(dir, "aws.env"))
+
+	cred := aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET", SessionToken: "TOKEN", Region: "us-east-1"}
+	if err := outputCredentials(cred, "env", "", nil); err != nil {
+		t.Fatalf("outputCredentials() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "aws.env"))
+	if err != nil {
+		t.Fatalf("env file not written to --%s: %v", keyEnvFile, err)
+	}
+	if !strings.Contains(string(data), "AKIA") {
+		t.Errorf("env file got:\n%s", data)
+	}
+}
+
+func TestOutputCredentials_JSONFile(t *testing.T) {
+	resetViper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	cred := aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET", SessionToken: "TOKEN", Region: "us-east-1"}
+
+	// Account path with ~ expanded
+	if err := outputCredentials(cred, "json", "", &config.Account{Name: "prod", JSONFile: "~/prod.json"}); err != nil {
+		t.Fatalf("outputCredentials() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(home, "prod.json")); err != nil || !strings.Contains(string(data), "AKIA") {
+		t.Errorf("json file of the account got %q, %v", data, err)
+	}
+
+	// The flag takes priority over the account
+	viper.Set(keyJSONFile, filepath.Join(home, "flag.json"))
+	if err := outputCredentials(cred, "json", "", &config.Account{Name: "prod", JSONFile: "~/prod.json"}); err != nil {
+		t.Fatalf("outputCredentials() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "flag.json")); err != nil {
+		t.Errorf("json file not written to --%s: %v", keyJSONFile, err)
+	}
+}
+
+func TestPushNotice(t *testing.T) {
+	if got := pushNotice(jumpcloud.MFAMethodDuo); !strings.Contains(got, "Duo") {
+		t.Errorf("pushNotice(duo) = %q, want the Duo push", got)
+	}
+	if got := pushNotice(jumpcloud.MFAMethodPush); !strings.Contains(got, "JumpCloud Protect") {
+		t.Errorf("pushNotice(push) = %q, want the JumpCloud Protect push", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+const keyStripAwsEnv = "strip-aws-env"
+
+// forwardedSignals are passed from jc2aws to the executed command.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// exitCodeError is returned when the executed command exits with a non-zero code,
+// jc2aws exits with the same code.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.code)
+}
+
+// newExecCmd creates the command which runs a program with AWS credentials in its environment.
+func newExecCmd(cfg *appConfig) *cobra.Command {
+	var stripAwsEnv bool
+	cmd := &cobra.Command{
+		Use:   "exec [flags] -- command [args...]",
+		Short: "Run a command with AWS credentials as environment variables",
+		Long: "Run a command directly (without a shell) with AWS credentials as environment variables.\n" +
+			"Signals are forwarded to the command and jc2aws exits with its exit code.",
+		Example: "  jc2aws exec --account my-prod --role-name admin -- terraform plan",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cred, _, err := headlessCredentials(cfg)
+			if err != nil {
+				return err
+			}
+
+			env := execEnv(os.Environ(), cred.ToEnv(), stripAwsEnv)
+			err = runCommand(args, env)
+
+			if _, ok := errors.AsType[*exitCodeError](err); ok {
+				// The command reported its own error, just pass the exit code through
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+			}
+			return err
+		},
+	}
+	// Flags after the command name belong to the command
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().BoolVar(&stripAwsEnv, keyStripAwsEnv, false, "Remove existing AWS_* environment variables (e.g. AWS_PROFILE)")
+	return cmd
+}
+
+// execEnv returns environ with credential variables added. Existing variables
+// with the same names are replaced, and all AWS_* variables are removed if stripAws is set.
+func execEnv(environ, credEnv []string, stripAws bool) []string {
+	replaced := make(map[string]bool, len(credEnv))
+	for _, kv := range credEnv {
+		name, _, _ := strings.Cut(kv, "=")
+		replaced[name] = true
+	}
+
+	env := make([]string, 0, len(environ)+len(credEnv))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if replaced[name] || (stripAws && strings.HasPrefix(name, "AWS_")) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env, credEnv...)
+}
+
+// runCommand runs argv with the environment, forwarding signals to it.
+// A non-zero exit code is returned as *exitCodeError.
+func runCommand(argv []string, env []string) error {
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Catch signals before starting, so none terminates jc2aws instead of the command
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	if exitErr, ok := errors.AsType[*exec.ExitError](err); ok {
+		return &exitCodeError{code: exitCode(exitErr.ProcessState)}
+	}
+	return err
+}
+
+// exitCode returns the process exit code, or 128+signal (shell convention)
+// if the process was terminated by a signal.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if code := state.ExitCode(); code > 0 {
+		return code
+	}
+	return 1
+}
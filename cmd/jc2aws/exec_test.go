@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestExecEnv(t *testing.T) {
+	environ := []string{
+		"HOME=/home/user",
+		"AWS_PROFILE=prod",
+		"AWS_REGION=eu-west-1",
+		"PATH=/usr/bin",
+	}
+	credEnv := []string{"AWS_ACCESS_KEY_ID=AKIA", "AWS_REGION=us-east-1"}
+
+	tests := []struct {
+		name     string
+		stripAws bool
+		want     []string
+	}{
+		{
+			name: "replace credential variables",
+			want: []string{"HOME=/home/user", "AWS_PROFILE=prod", "PATH=/usr/bin", "AWS_ACCESS_KEY_ID=AKIA", "AWS_REGION=us-east-1"},
+		},
+		{
+			name:     "strip AWS variables",
+			stripAws: true,
+			want:     []string{"HOME=/home/user", "PATH=/usr/bin", "AWS_ACCESS_KEY_ID=AKIA", "AWS_REGION=us-east-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := execEnv(environ, credEnv, tt.stripAws)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("execEnv() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	env := []string{"J2A_TEST_VALUE=from-env", "OUT=" + out}
+	if err := runCommand([]string{"sh", "-c", `printf %s "$J2A_TEST_VALUE" > "$OUT"`}, env); err != nil {
+		t.Fatalf("runCommand() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || string(data) != "from-env" {
+		t.Errorf("command environment: got %q, err = %v", data, err)
+	}
+
+	err = runCommand([]string{"sh", "-c", "exit 3"}, nil)
+	exitErr, ok := errors.AsType[*exitCodeError](err)
+	if !ok || exitErr.code != 3 {
+		t.Errorf("runCommand() want exit code 3, got %v", err)
+	}
+
+	err = runCommand([]string{"sh", "-c", "kill -TERM $$"}, nil)
+	exitErr, ok = errors.AsType[*exitCodeError](err)
+	if !ok || exitErr.code != 128+15 {
+		t.Errorf("runCommand() want exit code 143, got %v", err)
+	}
+
+	if err := runCommand([]string{"j2a-test-missing-command"}, nil); err == nil {
+		t.Error("runCommand() expected error for missing command")
+	}
+}
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
 	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/console"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/shellenv"
 	"github.com/yousysadmin/jc2aws/pkg"
 	"github.com/yousysadmin/jc2aws/pkg/update"
 )
@@ -38,7 +45,9 @@ const (
 	keyEmail         = "email"
 	keyPassword      = "password"
 	keyMFA           = "mfa"
+	keyMFAMethod     = "mfa-method"
 	keyIdpURL        = "idp-url"
+	keyJCConsoleURL  = "jc-console-url"
 	keyRoleName      = "role-name"
 	keyRoleARN       = "role-arn"
 	keyPrincipalARN  = "principal-arn"
@@ -53,6 +62,24 @@ const (
 	keyInteractive   = "interactive"
 	keyConfig        = "config"
 	keyTUIDoneAction = "tui-done-action"
+
+	keyNoCache            = "no-cache"
+	keyForceRefresh       = "force-refresh"
+	keyCacheRefreshMargin = "cache-refresh-margin"
+	keyCacheKey           = "cache-key"
+	keyReuseSession       = "reuse-session"
+	keyNoWait             = "no-wait"
+
+	keyJSONOmitSecrets = "json-omit-secrets"
+	keyShellSyntax     = "shell-syntax"
+
+	keyCredentialsFile = "credentials-file"
+	keyConfigFileOut   = "config-file-out"
+	keyEnvFile         = "env-file"
+	keyJSONFile        = "json-file"
+
+	keyVerify      = "verify"
+	keySTSEndpoint = "sts-endpoint"
 )
 
 // ---------------------------------------------------------------------------
@@ -77,8 +104,12 @@ func resolveString(key string, acc *config.Account) string {
 		return acc.Password
 	case keyMFA:
 		return acc.MFASecret
+	case keyMFAMethod:
+		return acc.MFAMethod
 	case keyIdpURL:
 		return acc.IdpURL
+	case keyJCConsoleURL:
+		return acc.JCConsoleURL
 	case keyPrincipalARN:
 		return acc.AWSPrincipalArn
 	case keyAwsCliProfile:
@@ -86,6 +117,14 @@ func resolveString(key string, acc *config.Account) string {
 			return acc.AwsCliProfile
 		}
 		return acc.Name
+	case keyCredentialsFile:
+		return acc.CredentialsFile
+	case keyConfigFileOut:
+		return acc.ConfigFileOut
+	case keyEnvFile:
+		return acc.EnvFile
+	case keyJSONFile:
+		return acc.JSONFile
 	}
 	return ""
 }
@@ -108,6 +147,12 @@ func resolveDuration(acc *config.Account) int {
 	return defaultDuration
 }
 
+// durationFromSAML reports whether the duration was left at its default,
+// so the SessionDuration attribute of the SAML assertion may replace it.
+func durationFromSAML(acc *config.Account) bool {
+	return !viper.IsSet(keyDuration) && (acc == nil || acc.Duration == 0)
+}
+
 // ---------------------------------------------------------------------------
 // CLI Entrypoint
 // ---------------------------------------------------------------------------
@@ -140,6 +185,9 @@ func main() {
 		Long:    "Obtaining temporary AWS credentials via JumpCloud SAML authentication.",
 		Version: pkg.Version,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Set after the config file is read, also when it doesn't exist
+			defer func() { aws.STSEndpoint = viper.GetString(keySTSEndpoint) }()
+
 			// Get config file path from Viper
 			cfg.configFilePath = viper.GetString(keyConfig)
 
@@ -152,6 +200,9 @@ func main() {
 				return fmt.Errorf("failed to load config file %s: %w", cfg.configFilePath, err)
 			}
 			cfg.config = cfgFile
+			for _, issue := range cfgFile.Issues {
+				fmt.Fprintf(os.Stderr, "Warning: %s:%s: %s\n", cfg.configFilePath, issue.Position(), issue.Message)
+			}
 
 			// NOTE: Do NOT use `viper.SetDefault` for `output-format` and `duration`.
 			// Cobra flag defaults (set via `flags.StringP` / `flags.IntP`) are
@@ -170,6 +221,12 @@ func main() {
 			if cfgFile.DefaultMFATokenSecret != "" && !viper.IsSet(keyMFA) {
 				viper.Set(keyMFA, cfgFile.DefaultMFATokenSecret)
 			}
+			if cfgFile.DefaultMFAMethod != "" && !viper.IsSet(keyMFAMethod) {
+				viper.Set(keyMFAMethod, cfgFile.DefaultMFAMethod)
+			}
+			if cfgFile.JCConsoleURL != "" && !viper.IsSet(keyJCConsoleURL) {
+				viper.Set(keyJCConsoleURL, cfgFile.JCConsoleURL)
+			}
 			if cfgFile.NoUpdateCheck && !viper.IsSet(keyNoUpdateCheck) {
 				viper.Set(keyNoUpdateCheck, true)
 			}
@@ -179,6 +236,46 @@ func main() {
 			if cfgFile.TUIDoneAction != "" && !viper.IsSet(keyTUIDoneAction) {
 				viper.Set(keyTUIDoneAction, cfgFile.TUIDoneAction)
 			}
+			if cfgFile.NoCache && !viper.IsSet(keyNoCache) {
+				viper.Set(keyNoCache, true)
+			}
+			if cfgFile.ReuseSession && !viper.IsSet(keyReuseSession) {
+				viper.Set(keyReuseSession, true)
+			}
+			if cfgFile.CacheRefreshMargin != "" && !viper.IsSet(keyCacheRefreshMargin) {
+				margin, err := time.ParseDuration(cfgFile.CacheRefreshMargin)
+				if err != nil {
+					return fmt.Errorf("invalid cache_refresh_margin in config file: %w", err)
+				}
+				viper.Set(keyCacheRefreshMargin, margin)
+			}
+			if cfgFile.CacheKey != "" && !viper.IsSet(keyCacheKey) {
+				viper.Set(keyCacheKey, cfgFile.CacheKey)
+			}
+			if cfgFile.ConsoleDestination != "" && !viper.IsSet(keyConsoleDestination) {
+				viper.Set(keyConsoleDestination, cfgFile.ConsoleDestination)
+			}
+			if cfgFile.ConsoleIssuer != "" && !viper.IsSet(keyConsoleIssuer) {
+				viper.Set(keyConsoleIssuer, cfgFile.ConsoleIssuer)
+			}
+			if cfgFile.FederationURL != "" && !viper.IsSet(keyFederationURL) {
+				viper.Set(keyFederationURL, cfgFile.FederationURL)
+			}
+			if cfgFile.CredentialsFile != "" && !viper.IsSet(keyCredentialsFile) {
+				viper.Set(keyCredentialsFile, cfgFile.CredentialsFile)
+			}
+			if cfgFile.ConfigFileOut != "" && !viper.IsSet(keyConfigFileOut) {
+				viper.Set(keyConfigFileOut, cfgFile.ConfigFileOut)
+			}
+			if cfgFile.EnvFile != "" && !viper.IsSet(keyEnvFile) {
+				viper.Set(keyEnvFile, cfgFile.EnvFile)
+			}
+			if cfgFile.JSONFile != "" && !viper.IsSet(keyJSONFile) {
+				viper.Set(keyJSONFile, cfgFile.JSONFile)
+			}
+			if cfgFile.STSEndpoint != "" && !viper.IsSet(keySTSEndpoint) {
+				viper.Set(keySTSEndpoint, cfgFile.STSEndpoint)
+			}
 
 			return nil
 		},
@@ -211,6 +308,17 @@ func main() {
 
 			cfg.interactive = viper.GetBool(keyInteractive)
 
+			specs, err := batchSpecs(cfg.config)
+			if err != nil {
+				return err
+			}
+			if len(specs) > 0 {
+				if cfg.interactive {
+					return errors.New("--all, --accounts and --group can't be used in interactive mode")
+				}
+				return runBatch(cfg, specs)
+			}
+
 			if cfg.interactive {
 				return runInteractive(cfg)
 			}
@@ -218,32 +326,75 @@ func main() {
 		},
 	}
 
-	flags := rootCmd.Flags()
-	flags.StringVarP(&cfg.configFilePath, keyConfig, "c", cfg.configFilePath, "Path to config file")
-	flags.StringP(keyEmail, "e", "", "JumpCloud user email")
-	flags.StringP(keyPassword, "p", "", "JumpCloud user password")
-	flags.StringP(keyMFA, "m", "", "JumpCloud MFA token or secret")
-	flags.String(keyIdpURL, "", "JumpCloud IDP URL")
-	flags.String(keyRoleName, "", "AWS Role name (from config)")
-	flags.String(keyRoleARN, "", "AWS Role ARN")
-	flags.String(keyPrincipalARN, "", "AWS Identity provider ARN")
-	flags.StringP(keyRegion, "r", "", "AWS region")
-	flags.IntP(keyDuration, "d", 3600, "AWS credential expiration time in seconds")
-	flags.StringP(keyAccount, "a", "", "Account name from config")
-	flags.StringP(keyOutputFormat, "f", "cli", "Credential output format (cli, env, cli-stdout, env-stdout, shell)")
-	flags.String(keyAwsCliProfile, "", "AWS CLI profile name")
+	// Flags used to resolve credentials are persistent so that subcommands share them.
+	pflags := rootCmd.PersistentFlags()
+	pflags.StringVarP(&cfg.configFilePath, keyConfig, "c", cfg.configFilePath, "Path to config file")
+	pflags.StringP(keyEmail, "e", "", "JumpCloud user email")
+	pflags.StringP(keyPassword, "p", "", "JumpCloud user password")
+	pflags.StringP(keyMFA, "m", "", "JumpCloud MFA token or secret")
+	pflags.String(keyMFAMethod, jumpcloud.MFAMethodAuto, "JumpCloud MFA method (auto, totp, push, duo)")
+	pflags.String(keyIdpURL, "", "JumpCloud IDP URL")
+	pflags.String(keyJCConsoleURL, "", "JumpCloud console URL (default "+jumpcloud.DefaultConsoleURL+")")
+	pflags.String(keyRoleName, "", "AWS Role name (from config or SAML assertion)")
+	pflags.String(keyRoleARN, "", "AWS Role ARN (discovered from SAML assertion if not set)")
+	pflags.String(keyPrincipalARN, "", "AWS Identity provider ARN (discovered from SAML assertion if not set)")
+	pflags.StringP(keyRegion, "r", "", "AWS region")
+	pflags.IntP(keyDuration, "d", 3600, "AWS credential expiration time in seconds")
+	pflags.StringP(keyAccount, "a", "", "Account name from config")
+	pflags.StringP(keyOutputFormat, "f", "cli", "Credential output format (cli, env, cli-stdout, env-stdout, json, json-stdout, export, shell, credential-process, console)")
+	pflags.String(keyAwsCliProfile, "", "AWS CLI profile name")
+	pflags.String(keyShellSyntax, shellenv.SyntaxAuto, "Shell syntax of the export format and unset command (auto, posix, fish, powershell, nushell)")
+	pflags.String(keyCredentialsFile, "", "AWS credentials file written by the cli format (default $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials)")
+	pflags.String(keyConfigFileOut, "", "AWS config file written by the cli format (default $AWS_CONFIG_FILE or ~/.aws/config)")
+	pflags.String(keyEnvFile, "", "File written by the env format (default ~/.jc2aws.env)")
+	pflags.String(keyJSONFile, "", "File written by the json format (default ~/.jc2aws.json)")
+	pflags.Bool(keyVerify, false, "Check credentials with sts:GetCallerIdentity and print the identity")
+	pflags.String(keySTSEndpoint, "", "AWS STS endpoint URL (e.g. a VPC endpoint or a local stub)")
+	pflags.Bool(keyJSONOmitSecrets, false, "Leave the secret access key and session token out of the json formats")
+	pflags.Bool(keyNoUpdateCheck, false, "Disable automatic update check")
+	pflags.Bool(keyNoCache, false, "Don't read or write the local credential cache")
+	pflags.Bool(keyForceRefresh, false, "Ignore cached credentials and fetch new ones")
+	pflags.Bool(keyReuseSession, false, "Save the JumpCloud session and reuse it until it expires")
+	pflags.Bool(keyNoWait, false, "Fail instead of waiting for a new TOTP code when the current one was already used")
+	pflags.Duration(keyCacheRefreshMargin, cache.DefaultRefreshMargin, "Refresh cached credentials expiring within this time")
+	pflags.String(keyConsoleDestination, "", "AWS console page opened after sign-in (URL or path, e.g. s3/home)")
+	pflags.String(keyConsoleIssuer, console.DefaultIssuer, "Issuer shown by the AWS console")
+	pflags.String(keyFederationURL, console.DefaultFederationURL, "AWS federation endpoint used for console sign-in")
 
+	flags := rootCmd.Flags()
 	// -s / --shell is a convenience alias for --output-format=shell (backward compat).
 	flags.BoolP(keyShell, "s", false, "Launch a shell with AWS credentials (alias for -f shell)")
 	flags.String(keyShellScript, "", "Path to shell script to run with AWS credentials (implies -s)")
 	flags.BoolP(keyInteractive, "i", false, "Launch interactive TUI wizard")
+	flags.Bool(keyAll, false, "Get credentials of all accounts from config (batch mode)")
+	flags.StringSlice(keyAccounts, nil, "Get credentials of the targets account[/role[/region]][=profile] (batch mode)")
+	flags.StringSlice(keyGroup, nil, "Get credentials of the targets of the group from config (batch mode)")
+	flags.Int(keyParallel, defaultParallel, "Maximum concurrent AWS STS requests in batch mode")
 	flags.BoolVar(&cfg.update, "update", false, "Download and install the latest release")
-	flags.Bool(keyNoUpdateCheck, false, "Disable automatic update check")
 
 	// Bind all flags to Viper
+	viper.BindPFlags(pflags)
 	viper.BindPFlags(flags)
 
+	rootCmd.AddCommand(
+		newSetupCredentialProcessCmd(cfg),
+		newCacheCmd(),
+		newSessionCmd(),
+		newExecCmd(cfg),
+		newAgentCmd(cfg),
+		newServeCmd(cfg),
+		newConsoleCmd(cfg),
+		newUnsetCmd(),
+		newStatusCmd(cfg),
+		newWhoamiCmd(cfg),
+		newMfaCmd(cfg),
+		newConfigCmd(cfg),
+	)
+
 	if err := rootCmd.Execute(); err != nil {
+		if exitErr, ok := errors.AsType[*exitCodeError](err); ok {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -285,88 +436,145 @@ func runInteractive(cfg *appConfig) error {
 
 	// Shell: launch interactive shell with credential env vars
 	if format == "shell" {
-		return launchShell(*fm.credResult, cfg.shellScript)
+		return launchShell(execEnv(os.Environ(), fm.credResult.ToEnv(), false), cfg.shellScript)
 	}
 
 	// Stdout formats: output was deferred to post-TUI for real stdout
-	if format == "cli-stdout" || format == "env-stdout" {
-		return outputCredentials(*fm.credResult, format, profileName)
+	if isStdoutFormat(format) {
+		return outputCredentials(*fm.credResult, format, profileName, fm.account)
 	}
 
 	return nil
 }
 
+// resolveAccount returns the account selected with --account, or nil if not set.
+func resolveAccount(cfg *appConfig) (*config.Account, error) {
+	accountName := viper.GetString(keyAccount)
+	if accountName == "" {
+		return nil, nil
+	}
+	if len(cfg.config.Accounts) == 0 {
+		return nil, fmt.Errorf("--account flag can't be used without any pre-configured account")
+	}
+	found, err := cfg.config.FindAccountByName(accountName)
+	if err != nil {
+		return nil, fmt.Errorf("account %q not found in config", accountName)
+	}
+	return &found, nil
+}
+
 // runHeadless use CLI without launching the TUI.
 // Values must be provided via flags, env vars or config file.
 func runHeadless(cfg *appConfig) error {
-	var acc *config.Account
+	cred, acc, err := headlessCredentials(cfg)
+	if err != nil {
+		return err
+	}
 
-	// Resolve account if --account is set
-	accountName := viper.GetString(keyAccount)
-	if accountName != "" {
-		if len(cfg.config.Accounts) == 0 {
-			return fmt.Errorf("--account flag can't be used without any pre-configured account")
-		}
-		found, err := cfg.config.FindAccountByName(accountName)
+	identity, err := verifyCredentials(context.Background(), cred)
+	if err != nil {
+		return err
+	}
+	if identity != nil {
+		// stderr, stdout formats print only credentials
+		printIdentity(os.Stderr, *identity)
+	}
+
+	// Handle output
+	format := viper.GetString(keyOutputFormat)
+
+	if format == "shell" {
+		return launchShell(execEnv(os.Environ(), cred.ToEnv(), false), cfg.shellScript)
+	}
+
+	return outputCredentials(cred, format, resolveString(keyAwsCliProfile, acc), acc)
+}
+
+// accountName returns the name of the account, or an empty string if not set.
+func accountName(acc *config.Account) string {
+	if acc == nil {
+		return ""
+	}
+	return acc.Name
+}
+
+// headlessCredentials obtains credentials from values provided via flags,
+// env vars or config file, and returns them with the selected account (nil if not set).
+func headlessCredentials(cfg *appConfig) (aws.AwsSamlOutput, *config.Account, error) {
+	req, acc, key, err := headlessRequest(cfg)
+	if err != nil {
+		return aws.AwsSamlOutput{}, acc, err
+	}
+
+	// Fetch credentials, reusing cached ones while they are valid
+	cred, err := getCachedCredentials(key, func() (aws.AwsSamlOutput, error) {
+		req, err := req.withSecrets(acc)
 		if err != nil {
-			return fmt.Errorf("account %q not found in config", accountName)
+			return aws.AwsSamlOutput{}, err
 		}
-		acc = &found
+		return getCredentials(req)
+	})
+	if err != nil {
+		return aws.AwsSamlOutput{}, acc, fmt.Errorf("credential error: %w", err)
+	}
+
+	return cred, acc, nil
+}
+
+// headlessRequest resolves the credential request and its cache key from values
+// provided via flags, env vars or config file.
+func headlessRequest(cfg *appConfig) (credentialRequest, *config.Account, cache.Key, error) {
+	acc, err := resolveAccount(cfg)
+	if err != nil {
+		return credentialRequest{}, nil, cache.Key{}, err
 	}
 
 	// Resolve all values (Viper flags/env take priority, then account defaults)
-	email := resolveString(keyEmail, acc)
-	password := resolveString(keyPassword, acc)
-	idpURL := resolveString(keyIdpURL, acc)
-	mfaToken := resolveString(keyMFA, acc)
-	principalARN := resolveString(keyPrincipalARN, acc)
-	roleARN := resolveString(keyRoleARN, acc)
-	region := resolveString(keyRegion, acc)
-	duration := resolveDuration(acc)
-	awsCliProfile := resolveString(keyAwsCliProfile, acc)
-
-	// Resolve --role-name to ARN if needed
-	if roleARN == "" {
-		roleName := viper.GetString(keyRoleName)
-		if roleName != "" && acc != nil {
-			role, err := acc.FindAWSRoleArnByName(roleName)
-			if err != nil {
-				return fmt.Errorf("role %q not found in account %q", roleName, accountName)
-			}
-			roleARN = role.Arn
+	req := credentialRequest{
+		Email:            resolveString(keyEmail, acc),
+		Password:         resolveString(keyPassword, acc),
+		IdpURL:           resolveString(keyIdpURL, acc),
+		MFA:              resolveString(keyMFA, acc),
+		MFAMethod:        resolveString(keyMFAMethod, acc),
+		ConsoleURL:       resolveString(keyJCConsoleURL, acc),
+		ReuseSession:     viper.GetBool(keyReuseSession),
+		OnPush:           printPushNotice,
+		OnTOTPWait:       printTOTPWait,
+		OnClockSkew:      printClockSkewWarning,
+		PrincipalARN:     resolveString(keyPrincipalARN, acc),
+		RoleARN:          resolveString(keyRoleARN, acc),
+		RoleName:         viper.GetString(keyRoleName),
+		Region:           resolveString(keyRegion, acc),
+		Duration:         resolveDuration(acc),
+		DurationFromSAML: durationFromSAML(acc),
+	}
+
+	// Resolve --role-name to ARN if the role is configured for the account,
+	// otherwise it is matched against roles from the SAML assertion.
+	if req.RoleARN == "" && req.RoleName != "" && acc != nil {
+		if role, err := acc.FindAWSRoleArnByName(req.RoleName); err == nil {
+			req.RoleARN = role.Arn
+			req.Chain = roleChain(role)
 		}
 	}
 
 	// Validate required fields
+	// Role and principal ARNs are optional: they are discovered from the SAML assertion.
 	required := []struct {
 		value string
 		flag  string
 	}{
-		{email, "--email"},
-		{password, "--password"},
-		{idpURL, "--idp-url"},
-		{principalARN, "--principal-arn"},
-		{roleARN, "--role-arn"},
-		{region, "--region"},
+		{req.Email, "--email"},
+		{req.Password, "--password"},
+		{req.IdpURL, "--idp-url"},
+		{req.Region, "--region"},
 	}
 	for _, r := range required {
 		if r.value == "" {
-			return fmt.Errorf("%s is required (use -i for interactive mode)", r.flag)
+			return credentialRequest{}, acc, cache.Key{}, fmt.Errorf("%s is required (use -i for interactive mode)", r.flag)
 		}
 	}
 
-	// Fetch credentials
-	cred, err := getCredentials(email, password, idpURL, mfaToken, principalARN, roleARN, region, duration)
-	if err != nil {
-		return fmt.Errorf("credential error: %w", err)
-	}
-
-	// Handle output
-	format := viper.GetString(keyOutputFormat)
-
-	if format == "shell" {
-		return launchShell(cred, cfg.shellScript)
-	}
-
-	return outputCredentials(cred, format, awsCliProfile)
+	key := credentialCacheKey(acc, req.IdpURL, req.targetRoleARN(), req.RoleName, req.Region)
+	return req, acc, key, nil
 }
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/spf13/viper"
 
+	"github.com/yousysadmin/jc2aws/internal/aws"
 	"github.com/yousysadmin/jc2aws/internal/config"
 )
 
@@ -59,6 +61,7 @@ func TestResolveString_AllAccountFields(t *testing.T) {
 		Password:        "p",
 		MFASecret:       "m",
 		IdpURL:          "u",
+		JCConsoleURL:    "j",
 		AWSPrincipalArn: "a",
 		AwsCliProfile:   "c",
 		Name:            "myacc",
@@ -72,6 +75,7 @@ func TestResolveString_AllAccountFields(t *testing.T) {
 		{keyPassword, "p"},
 		{keyMFA, "m"},
 		{keyIdpURL, "u"},
+		{keyJCConsoleURL, "j"},
 		{keyPrincipalARN, "a"},
 		{keyAwsCliProfile, "c"},
 	}
@@ -176,3 +180,87 @@ func TestAppConfigDefaults(t *testing.T) {
 		t.Error("update should be false by default")
 	}
 }
+
+func TestDurationFromSAML(t *testing.T) {
+	resetViper()
+	if !durationFromSAML(nil) {
+		t.Error("durationFromSAML: want true when nothing is set")
+	}
+	if durationFromSAML(&config.Account{Duration: 7200}) {
+		t.Error("durationFromSAML: want false when account duration is set")
+	}
+
+	viper.Set(keyDuration, 1800)
+	if durationFromSAML(nil) {
+		t.Error("durationFromSAML: want false when duration flag is set")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// headlessRequest tests
+// ---------------------------------------------------------------------------
+
+func TestHeadlessRequest(t *testing.T) {
+	resetViper()
+	viper.Set(keyAccount, "prod")
+	viper.Set(keyRoleName, "readonly")
+	viper.Set(keyRegion, "eu-west-1")
+
+	req, acc, key, err := headlessRequest(newTestConfig(testAccounts()))
+	if err != nil {
+		t.Fatalf("headlessRequest: unexpected error: %v", err)
+	}
+	if acc == nil || acc.Name != "prod" {
+		t.Fatalf("headlessRequest: want account prod, got %+v", acc)
+	}
+	if req.RoleARN != "arn:aws:iam::111:role/readonly" {
+		t.Errorf("RoleARN: want resolved from role name, got %q", req.RoleARN)
+	}
+	if req.Email != "prod@example.com" || req.Duration != 7200 || req.DurationFromSAML {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if key.Account != "prod" || key.Role != req.RoleARN || key.Region != "eu-west-1" {
+		t.Errorf("unexpected cache key: %+v", key)
+	}
+}
+
+func TestHeadlessRequest_ChainedRole(t *testing.T) {
+	resetViper()
+	viper.Set(keyAccount, "prod")
+	viper.Set(keyRoleName, "target")
+	viper.Set(keyRegion, "us-east-1")
+
+	accounts := testAccounts()
+	accounts[0].AWSRoleArns = append(accounts[0].AWSRoleArns, config.AWSRole{
+		Name: "target",
+		Arn:  "arn:aws:iam::111:role/hub",
+		Chain: []config.RoleHop{
+			{AssumeRoleArn: "arn:aws:iam::222:role/target", ExternalID: "ext", Duration: 900},
+		},
+	})
+
+	req, _, key, err := headlessRequest(newTestConfig(accounts))
+	if err != nil {
+		t.Fatalf("headlessRequest: unexpected error: %v", err)
+	}
+	if req.RoleARN != "arn:aws:iam::111:role/hub" {
+		t.Errorf("RoleARN: want the SAML role, got %q", req.RoleARN)
+	}
+	want := []aws.AssumeRoleInput{{RoleArn: "arn:aws:iam::222:role/target", ExternalID: "ext", DurationSeconds: 900}}
+	if !reflect.DeepEqual(req.Chain, want) {
+		t.Errorf("Chain got = %+v, want %+v", req.Chain, want)
+	}
+	if key.Role != "arn:aws:iam::222:role/target" {
+		t.Errorf("cache key should use the last role of the chain, got %+v", key)
+	}
+}
+
+func TestHeadlessRequest_MissingRequired(t *testing.T) {
+	resetViper()
+	viper.Set(keyEmail, "user@example.com")
+
+	_, _, _, err := headlessRequest(newTestConfig(nil))
+	if err == nil || err.Error() != "--password is required (use -i for interactive mode)" {
+		t.Errorf("headlessRequest: want --password error, got %v", err)
+	}
+}
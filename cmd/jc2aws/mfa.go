@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/qrcode"
+	"github.com/yousysadmin/jc2aws/internal/secrets"
+	"github.com/yousysadmin/jc2aws/internal/totp"
+)
+
+// newMfaCmd creates the command group for TOTP MFA secrets.
+func newMfaCmd(cfg *appConfig) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mfa",
+		Short: "Show TOTP codes and import MFA secrets",
+		Long: "Show the current TOTP code of the MFA secret and import the secret\n" +
+			"of a JumpCloud TOTP enrollment QR code into the config file.",
+	}
+	cmd.AddCommand(newMfaCodeCmd(cfg), newMfaImportCmd(cfg))
+	return cmd
+}
+
+// newMfaCodeCmd creates the command which prints the current TOTP code of the MFA secret.
+func newMfaCodeCmd(cfg *appConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "code",
+		Short: "Print the current TOTP code of the MFA secret",
+		Long: "Print the current TOTP code of the MFA secret (--mfa or mfa_token_secret of the account)\n" +
+			"and the seconds it remains valid, e.g. to log in to the JumpCloud console.\n" +
+			"The code is printed to stdout and the remaining time to stderr.\n" +
+			"JumpCloud accepts a code only once, so the code is marked as used and a new code is awaited\n" +
+			"if the current one was already used by jc2aws (--no-wait fails instead).",
+		Example: "  jc2aws mfa code --account my-prod\n" +
+			"  jc2aws mfa code --account my-prod | pbcopy",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acc, err := resolveAccount(cfg)
+			if err != nil {
+				return err
+			}
+			key, err := mfaKey(resolveString(keyMFA, acc))
+			if err != nil {
+				return err
+			}
+
+			code, err := totpCode(key, 0, printTOTPWait)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), code)
+			fmt.Fprintf(cmd.ErrOrStderr(), "Valid for %ds\n", int(key.Remaining(time.Now()).Seconds()))
+			return nil
+		},
+	}
+}
+
+// mfaKey parses the MFA secret, secret references are resolved first.
+func mfaKey(mfa string) (totp.Key, error) {
+	mfa, err := secrets.Resolve(mfa)
+	if err != nil {
+		return totp.Key{}, fmt.Errorf("MFA: %w", err)
+	}
+	switch {
+	case mfa == "":
+		return totp.Key{}, fmt.Errorf("MFA secret is not set, use --%s or mfa_token_secret of the account", keyMFA)
+	case totp.IsCode(mfa):
+		return totp.Key{}, errors.New("MFA is a TOTP code, not a secret")
+	}
+	return totp.ParseKey(mfa)
+}
+
+// newMfaImportCmd creates the command which stores the secret of an enrollment QR code in the config file.
+func newMfaImportCmd(cfg *appConfig) *cobra.Command {
+	var printOnly bool
+	cmd := &cobra.Command{
+		Use:   "import <image>",
+		Short: "Import the MFA secret of a TOTP enrollment QR code",
+		Long: "Decode the TOTP enrollment QR code of a PNG, JPEG or GIF image (e.g. a screenshot of the\n" +
+			"JumpCloud MFA setup page) and store its otpauth:// URI as mfa_token_secret of the account\n" +
+			"selected with --account. Comments of the config file are kept.",
+		Example: "  jc2aws mfa import --account my-prod ~/Downloads/jumpcloud-totp.png\n" +
+			"  jc2aws mfa import --print ~/Downloads/jumpcloud-totp.png",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			uri, key, err := readEnrollmentQR(args[0])
+			if err != nil {
+				return err
+			}
+			if printOnly {
+				fmt.Fprintln(cmd.OutOrStdout(), uri)
+				return nil
+			}
+
+			if viper.GetString(keyAccount) == "" {
+				return fmt.Errorf("--%s is required to store the MFA secret (or use --print)", keyAccount)
+			}
+			acc, err := resolveAccount(cfg)
+			if err != nil {
+				return err
+			}
+			if err := config.SetAccountValue(cfg.configFilePath, acc.Name, "mfa_token_secret", uri); err != nil {
+				return fmt.Errorf("failed to store the MFA secret: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored the MFA secret of %s as mfa_token_secret of account %q in %s\n",
+				keyLabel(key), acc.Name, cfg.configFilePath)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&printOnly, "print", false, "Print the otpauth:// URI instead of storing it")
+	return cmd
+}
+
+// readEnrollmentQR decodes the QR code of the image and returns its otpauth:// URI.
+func readEnrollmentQR(path string) (string, totp.Key, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", totp.Key{}, err
+	}
+	defer f.Close()
+
+	uri, err := qrcode.Decode(f)
+	if err != nil {
+		return "", totp.Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if !totp.IsURI(uri) {
+		return "", totp.Key{}, fmt.Errorf("%s: QR code doesn't contain an otpauth:// URI", path)
+	}
+	key, err := totp.ParseKey(uri)
+	if err != nil {
+		return "", totp.Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return uri, key, nil
+}
+
+// keyLabel returns the issuer and account name of the key.
+func keyLabel(key totp.Key) string {
+	switch {
+	case key.Issuer != "" && key.Account != "":
+		return key.Issuer + " (" + key.Account + ")"
+	case key.Account != "":
+		return key.Account
+	case key.Issuer != "":
+		return key.Issuer
+	}
+	return "the QR code"
+}
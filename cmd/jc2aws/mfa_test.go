@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/totp"
+)
+
+const testEnrollmentURI = "otpauth://totp/JumpCloud:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=JumpCloud"
+
+// runMfaCmd runs the mfa command with the args and returns its stdout and stderr.
+func runMfaCmd(t *testing.T, cfg *appConfig, args ...string) (string, string, error) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	cmd := newMfaCmd(cfg)
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), errOut.String(), err
+}
+
+// writeQRImage writes a PNG image of the QR code of the text.
+func writeQRImage(t *testing.T, text string) string {
+	t.Helper()
+	matrix, err := zxingqr.NewQRCodeWriter().EncodeWithoutHint(text, gozxing.BarcodeFormat_QR_CODE, 300, 300)
+	if err != nil {
+		t.Fatalf("encode QR code: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "qr.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, matrix); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMfaCodeCmd(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	viper.Set(keyAccount, "prod")
+
+	cfg := newTestConfig([]config.Account{{Name: "prod", MFASecret: "JBSWY3DPEHPK3PXP"}})
+	out, errOut, err := runMfaCmd(t, cfg, "code")
+	if err != nil {
+		t.Fatalf("mfa code error = %v", err)
+	}
+
+	key, _ := totp.ParseKey("JBSWY3DPEHPK3PXP")
+	if want, _ := key.Generate(time.Now()); out != want+"\n" {
+		t.Errorf("mfa code got %q, want %q", out, want)
+	}
+	if !strings.HasPrefix(errOut, "Valid for ") {
+		t.Errorf("mfa code stderr = %q, want the remaining time", errOut)
+	}
+}
+
+func TestMfaCodeCmd_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		mfa  string
+		want string
+	}{
+		{"no secret", "", "MFA secret is not set"},
+		{"code", "123456", "MFA is a TOTP code, not a secret"},
+		{"invalid secret", "not a secret!", "invalid base32 secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetViper()
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			viper.Set(keyAccount, "prod")
+
+			cfg := newTestConfig([]config.Account{{Name: "prod", MFASecret: tt.mfa}})
+			if _, _, err := runMfaCmd(t, cfg, "code"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("mfa code error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMfaImportCmd(t *testing.T) {
+	resetViper()
+	viper.Set(keyAccount, "prod")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configData := "accounts:\n  # Production\n  - name: prod\n    mfa_token_secret: \"OLD\"\n"
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig([]config.Account{{Name: "prod"}})
+	cfg.configFilePath = configPath
+
+	out, _, err := runMfaCmd(t, cfg, "import", writeQRImage(t, testEnrollmentURI))
+	if err != nil {
+		t.Fatalf("mfa import error = %v", err)
+	}
+	if !strings.Contains(out, "JumpCloud (user@example.com)") || !strings.Contains(out, `account "prod"`) {
+		t.Errorf("mfa import output = %q", out)
+	}
+
+	conf, err := config.NewConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Accounts[0].MFASecret != testEnrollmentURI {
+		t.Errorf("mfa_token_secret = %q, want %q", conf.Accounts[0].MFASecret, testEnrollmentURI)
+	}
+	if data, _ := os.ReadFile(configPath); !strings.Contains(string(data), "# Production") {
+		t.Errorf("config comments lost:\n%s", data)
+	}
+}
+
+func TestMfaImportCmd_Print(t *testing.T) {
+	resetViper()
+
+	out, _, err := runMfaCmd(t, newTestConfig(nil), "import", "--print", writeQRImage(t, testEnrollmentURI))
+	if err != nil || out != testEnrollmentURI+"\n" {
+		t.Errorf("mfa import --print got %q, %v", out, err)
+	}
+}
+
+func TestMfaImportCmd_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		image   func(t *testing.T) string
+		want    string
+	}{
+		{"not otpauth", "prod", func(t *testing.T) string { return writeQRImage(t, "https://example.com") }, "doesn't contain an otpauth:// URI"},
+		{"hotp", "prod", func(t *testing.T) string { return writeQRImage(t, "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP") }, "only totp is supported"},
+		{"missing image", "prod", func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing.png") }, "no such file"},
+		{"no account", "", func(t *testing.T) string { return writeQRImage(t, testEnrollmentURI) }, "--account is required"},
+		{"unknown account", "dev", func(t *testing.T) string { return writeQRImage(t, testEnrollmentURI) }, `account "dev" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetViper()
+			viper.Set(keyAccount, tt.account)
+
+			cfg := newTestConfig([]config.Account{{Name: "prod"}})
+			if _, _, err := runMfaCmd(t, cfg, "import", tt.image(t)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("mfa import error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
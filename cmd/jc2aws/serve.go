@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/credserver"
+	"github.com/yousysadmin/jc2aws/internal/secrets"
+	"github.com/yousysadmin/jc2aws/internal/totp"
+)
+
+const keyListen = "listen"
+
+// shadowingEnv are variables which take priority over container credentials in AWS SDKs.
+var shadowingEnv = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+}
+
+// newServeCmd creates the command which serves credentials to AWS SDKs over HTTP.
+func newServeCmd(cfg *appConfig) *cobra.Command {
+	var (
+		listen      string
+		shell       bool
+		shellScript string
+	)
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve credentials over HTTP for AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		Long: "Serve credentials over HTTP in the format of the AWS container credentials provider.\n" +
+			"AWS SDKs and the AWS CLI configured with AWS_CONTAINER_CREDENTIALS_FULL_URI and\n" +
+			"AWS_CONTAINER_AUTHORIZATION_TOKEN get credentials refreshed before they expire.\n\n" +
+			"AWS SDKs accept plain http endpoints only on loopback addresses (and the ECS/EKS link-local\n" +
+			"addresses), so keep the default 127.0.0.1 listen address. Containers on a bridge network can't\n" +
+			"reach the loopback address of the host, run them with --network host.\n\n" +
+			"A TOTP code can't be used again to refresh credentials, set the MFA token secret instead.",
+		Example: "  jc2aws serve --account my-prod --role-name admin --listen 127.0.0.1:9911\n" +
+			"  docker run --network host -e AWS_CONTAINER_CREDENTIALS_FULL_URI -e AWS_CONTAINER_AUTHORIZATION_TOKEN amazon/aws-cli sts get-caller-identity\n" +
+			"  jc2aws serve --account my-prod --role-name admin --shell",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req, acc, key, err := headlessRequest(cfg)
+			if err != nil {
+				return err
+			}
+			if mfa := req.MFA; totp.IsCode(mfa) && !secrets.IsReference(mfa) {
+				// A TOTP code can be used only once, the server needs the secret to log in again
+				return errors.New("MFA token secret is required to refresh credentials")
+			}
+
+			token, err := credserver.NewToken()
+			if err != nil {
+				return fmt.Errorf("failed to generate authorization token: %w", err)
+			}
+
+			srv := credserver.New(token, func(context.Context) (aws.AwsSamlOutput, error) {
+				return getCachedCredentials(key, func() (aws.AwsSamlOutput, error) {
+					req, err := req.withSecrets(acc)
+					if err != nil {
+						return aws.AwsSamlOutput{}, err
+					}
+					return getCredentials(req)
+				})
+			})
+			// Refresh together with the cache, so refreshes don't get cached credentials back
+			srv.RefreshMargin = cache.DefaultRefreshMargin
+			if viper.IsSet(keyCacheRefreshMargin) {
+				srv.RefreshMargin = viper.GetDuration(keyCacheRefreshMargin)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// Log in before listening, so errors are reported right away
+			if _, err := srv.Credentials(ctx); err != nil {
+				return fmt.Errorf("credential error: %w", err)
+			}
+
+			l, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+			baseURL := "http://" + l.Addr().String()
+			env := credserver.Env(baseURL, token)
+
+			httpSrv := &http.Server{Handler: srv, ReadHeaderTimeout: 5 * time.Second}
+			go func() {
+				if err := httpSrv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					fmt.Fprintf(os.Stderr, "Error: credentials server failed: %v\n", err)
+					stop()
+				}
+			}()
+			defer httpSrv.Close()
+			go srv.Run(ctx)
+
+			if shell || shellScript != "" {
+				regionEnv := []string{"AWS_REGION=" + req.Region, "AWS_DEFAULT_REGION=" + req.Region}
+				shellEnv := execEnv(withoutEnv(os.Environ(), shadowingEnv...), append(env, regionEnv...), false)
+				return launchShell(shellEnv, shellScript)
+			}
+
+			fmt.Fprintf(os.Stderr, "Serving credentials on %s%s, press Ctrl+C to stop\n", baseURL, credserver.Path)
+			fmt.Fprintln(os.Stdout, strings.Join(env, "\n"))
+			<-ctx.Done()
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&listen, keyListen, "127.0.0.1:0", "Address to listen on (random port by default)")
+	cmd.Flags().BoolVarP(&shell, keyShell, "s", false, "Launch a shell using the endpoint instead of static credentials")
+	cmd.Flags().StringVar(&shellScript, keyShellScript, "", "Path to shell script to run using the endpoint (implies -s)")
+	return cmd
+}
+
+// withoutEnv returns environ without the named variables.
+func withoutEnv(environ []string, names ...string) []string {
+	env := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(names, name) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
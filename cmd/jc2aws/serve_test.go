@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWithoutEnv(t *testing.T) {
+	environ := []string{"HOME=/home/user", "AWS_PROFILE=prod", "AWS_ACCESS_KEY_ID=AKIA", "AWS_CONFIG_FILE=/tmp/config"}
+
+	got := withoutEnv(environ, shadowingEnv...)
+	want := []string{"HOME=/home/user", "AWS_CONFIG_FILE=/tmp/config"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutEnv() got = %v, want %v", got, want)
+	}
+}
+
+func TestServeCmd_MFACode(t *testing.T) {
+	resetViper()
+	viper.Set(keyEmail, "user@example.com")
+	viper.Set(keyPassword, "password")
+	viper.Set(keyIdpURL, "https://sso.jumpcloud.com/saml2/aws")
+	viper.Set(keyRegion, "us-east-1")
+	viper.Set(keyMFA, "123456")
+
+	cmd := newServeCmd(newTestConfig(nil))
+	cmd.SetArgs(nil)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "MFA token secret is required") {
+		t.Errorf("serve error = %v, want the MFA token secret required", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+)
+
+// newSessionJar opens the JumpCloud session jar in the default cache directory.
+// Sessions are encrypted with the cache key, or with a random key from the key file.
+func newSessionJar() (*cache.Cache, error) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	c := cache.New(dir)
+
+	c.Passphrase = viper.GetString(keyCacheKey)
+	if c.Passphrase == "" {
+		keyFile, err := cache.DefaultKeyFile()
+		if err != nil {
+			return nil, err
+		}
+		if c.Passphrase, err = cache.LoadOrCreateKey(keyFile); err != nil {
+			return nil, fmt.Errorf("failed to load session key: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// getSamlWithSession gets the SAML response, reusing the saved JumpCloud session
+// when reuse is enabled. Session jar failures are reported as warnings
+// and never prevent logging in.
+func getSamlWithSession(jc *jumpcloud.JumpCloud, reuse bool) (string, error) {
+	if !reuse {
+		return jc.GetSaml()
+	}
+
+	jar, err := newSessionJar()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: JumpCloud session jar disabled: %v\n", err)
+		return jc.GetSaml()
+	}
+
+	key := cache.SessionKey{Email: jc.Email, ConsoleURL: jc.ConsoleURL}
+	cookies, ok, err := jar.GetSession(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read the saved JumpCloud session: %v\n", err)
+	}
+	if ok {
+		jc.Session = cookies
+	}
+
+	assertion, err := jc.GetSaml()
+	if err != nil {
+		// The login failed, don't try the saved session again
+		if err := jar.DeleteSession(key); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove the JumpCloud session: %v\n", err)
+		}
+		return assertion, err
+	}
+	if jc.LoggedIn() {
+		if err := jar.PutSession(key, jc.Cookies()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save the JumpCloud session: %v\n", err)
+		}
+	}
+	return assertion, nil
+}
+
+// newSessionCmd creates the command group for managing saved JumpCloud sessions.
+func newSessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage saved JumpCloud sessions",
+		Long: "With --reuse-session, the JumpCloud session is saved encrypted in the cache directory\n" +
+			"and reused until it expires, so the password and MFA are not sent on every run.",
+	}
+	cmd.AddCommand(newSessionListCmd(), newSessionLogoutCmd())
+	return cmd
+}
+
+func newSessionListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List saved JumpCloud sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := cache.DefaultDir()
+			if err != nil {
+				return err
+			}
+			// Listing doesn't decrypt sessions, so it doesn't need the key
+			c := cache.New(dir)
+			entries, err := c.ListSessions()
+			if err != nil {
+				return fmt.Errorf("failed to read saved sessions: %w", err)
+			}
+			if len(entries) == 0 {
+				fmt.Fprintln(os.Stdout, "No saved JumpCloud sessions")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "EMAIL\tCONSOLE\tCREATED\tEXPIRES\tSTATUS")
+			for _, e := range entries {
+				status := "expired"
+				if c.SessionValid(e) {
+					status = "valid"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					e.Key.Email, e.Key.ConsoleURL, formatExpiration(&e.CreatedAt), formatExpiration(&e.Expiration), status)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newSessionLogoutCmd() *cobra.Command {
+	var email string
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Remove saved JumpCloud sessions",
+		Long:  "Remove saved JumpCloud sessions, the next run logs in with the password and MFA again.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := cache.DefaultDir()
+			if err != nil {
+				return err
+			}
+			c := cache.New(dir)
+
+			var filter func(cache.SessionKey) bool
+			if email != "" {
+				filter = func(k cache.SessionKey) bool { return k.Email == email }
+			}
+			removed, err := c.ClearSessions(filter)
+			if err != nil {
+				return fmt.Errorf("failed to remove saved sessions: %w", err)
+			}
+			fmt.Fprintf(os.Stdout, "Removed %d saved session(s)\n", removed)
+			return nil
+		},
+	}
+	// Local flag, shadows the persistent --email so logging out doesn't resolve credentials
+	cmd.Flags().StringVarP(&email, keyEmail, "e", "", "Only remove sessions of the JumpCloud user")
+	return cmd
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/cache"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+)
+
+func TestGetSamlAssertion_ReuseSession(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = "123456"
+	jc.Start()
+	defer jc.Close()
+
+	req := credentialRequest{
+		Email:        jumpcloudtest.DefaultEmail,
+		Password:     jumpcloudtest.DefaultPassword,
+		IdpURL:       jc.IdpURL(),
+		ConsoleURL:   jc.URL,
+		MFA:          "123456",
+		ReuseSession: true,
+	}
+	for range 2 {
+		if _, err := getSamlAssertion(req); err != nil {
+			t.Fatalf("getSamlAssertion() error = %v", err)
+		}
+	}
+	if jc.Logins() != 1 {
+		t.Errorf("getSamlAssertion() logged in %d times, want the saved session reused", jc.Logins())
+	}
+
+	jar, err := newSessionJar()
+	if err != nil {
+		t.Fatalf("newSessionJar() error = %v", err)
+	}
+	if entries, _ := jar.ListSessions(); len(entries) != 1 || entries[0].Key != (cache.SessionKey{Email: req.Email, ConsoleURL: jc.URL}) {
+		t.Errorf("ListSessions() got = %v, want the saved session", entries)
+	}
+
+	// Expired session: log in again and replace the saved session
+	jc.ExpireSessions()
+	if _, err := getSamlAssertion(req); err != nil || jc.Logins() != 2 {
+		t.Fatalf("getSamlAssertion() error = %v, %d logins, want a new login", err, jc.Logins())
+	}
+	if _, err := getSamlAssertion(req); err != nil || jc.Logins() != 2 {
+		t.Errorf("getSamlAssertion() error = %v, %d logins, want the new session reused", err, jc.Logins())
+	}
+
+	// Failed login removes the saved session
+	jc.ExpireSessions()
+	req.MFA = "000000"
+	if _, err := getSamlAssertion(req); err == nil {
+		t.Fatal("getSamlAssertion() expected error with a wrong TOTP")
+	}
+	if entries, _ := jar.ListSessions(); len(entries) != 0 {
+		t.Errorf("ListSessions() got = %v, want the session removed after a failed login", entries)
+	}
+
+	// Without --reuse-session nothing is saved
+	req.MFA = "123456"
+	req.ReuseSession = false
+	if _, err := getSamlAssertion(req); err != nil {
+		t.Fatalf("getSamlAssertion() error = %v", err)
+	}
+	if entries, _ := jar.ListSessions(); len(entries) != 0 {
+		t.Errorf("ListSessions() got = %v, want no session without reuse", entries)
+	}
+}
+
+func TestNewSessionJar_CacheKey(t *testing.T) {
+	resetViper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	viper.Set(keyCacheKey, "my-cache-key")
+	jar, err := newSessionJar()
+	if err != nil {
+		t.Fatalf("newSessionJar() error = %v", err)
+	}
+	if jar.Passphrase != "my-cache-key" {
+		t.Errorf("newSessionJar() passphrase = %q, want the cache key", jar.Passphrase)
+	}
+
+	resetViper()
+	jar, err = newSessionJar()
+	if err != nil || jar.Passphrase == "" {
+		t.Fatalf("newSessionJar() error = %v, want a key from the key file", err)
+	}
+	again, _ := newSessionJar()
+	if again.Passphrase != jar.Passphrase {
+		t.Error("newSessionJar() should reuse the key file")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/config"
+)
+
+// statusEntry describes credentials written by jc2aws to an AWS CLI profile or the env file.
+type statusEntry struct {
+	// Profile is empty for the env file
+	Profile          string              `json:"profile,omitempty"`
+	File             string              `json:"file"`
+	Account          string              `json:"account,omitempty"`
+	RoleArn          string              `json:"role_arn,omitempty"`
+	Region           string              `json:"region,omitempty"`
+	Expiration       *time.Time          `json:"expiration"`
+	RemainingSeconds int64               `json:"remaining_seconds"`
+	Expired          bool                `json:"expired"`
+	Identity         *aws.CallerIdentity `json:"identity,omitempty"`
+	VerifyError      string              `json:"verify_error,omitempty"`
+
+	cred aws.AwsSamlOutput
+}
+
+// newStatusCmd creates the command which shows credentials written by jc2aws and when they expire.
+func newStatusCmd(cfg *appConfig) *cobra.Command {
+	var asJSON, verify bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show credentials written by jc2aws and when they expire",
+		Long: "Read the AWS CLI profiles and the env file written by jc2aws and show the role, region\n" +
+			"and remaining lifetime of their credentials. Files of all accounts from the config file are read.\n" +
+			"--verify checks credentials that are not expired with sts:GetCallerIdentity.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := collectStatus(cfg.config, time.Now())
+			if err != nil {
+				return err
+			}
+			if verify {
+				verifyStatus(cmd.Context(), entries)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				if entries == nil {
+					entries = []statusEntry{}
+				}
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+			if len(entries) == 0 {
+				fmt.Fprintln(out, "No credentials written by jc2aws found")
+				return nil
+			}
+			return printStatus(out, entries, verify)
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output as JSON")
+	cmd.Flags().BoolVar(&verify, keyVerify, false, "Check credentials with sts:GetCallerIdentity")
+	return cmd
+}
+
+// collectStatus reads profiles and env files written for all accounts of the config
+// (and without an account), files shared by several accounts are read once.
+func collectStatus(cfg *config.Config, now time.Time) ([]statusEntry, error) {
+	accounts := []*config.Account{nil}
+	if cfg != nil {
+		for _, acc := range cfg.GetAccounts() {
+			accounts = append(accounts, &acc)
+		}
+	}
+
+	var entries []statusEntry
+	seen := map[string]bool{}
+	for _, acc := range accounts {
+		files, err := resolveAwsFiles(acc)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[files.credentials] {
+			seen[files.credentials] = true
+			profiles, err := aws.ReadProfiles(files.credentials, files.config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read AWS credentials %s: %w", files.credentials, err)
+			}
+			for _, p := range profiles {
+				e := newStatusEntry(p.Credentials, files.credentials, now)
+				e.Profile = p.Name
+				e.Account = firstNonEmpty(p.Config["jc2aws_account"], profileAccount(cfg, p.Name))
+				entries = append(entries, e)
+			}
+		}
+
+		envFile, err := resolveEnvFile(acc)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[envFile] {
+			seen[envFile] = true
+			cred, ok, err := aws.ReadEnvFile(envFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read env file %s: %w", envFile, err)
+			}
+			if ok {
+				entries = append(entries, newStatusEntry(cred, envFile, now))
+			}
+		}
+	}
+	return entries, nil
+}
+
+// newStatusEntry returns the entry of the credentials read from the file.
+func newStatusEntry(cred aws.AwsSamlOutput, file string, now time.Time) statusEntry {
+	e := statusEntry{
+		File:       file,
+		RoleArn:    cred.RoleArn,
+		Region:     cred.Region,
+		Expiration: cred.Expiration,
+		Expired:    true,
+		cred:       cred,
+	}
+	if cred.Expiration != nil && cred.Expiration.After(now) {
+		e.Expired = false
+		e.RemainingSeconds = int64(cred.Expiration.Sub(now).Seconds())
+	}
+	return e
+}
+
+// profileAccount returns the name of the config account writing the profile by default.
+func profileAccount(cfg *config.Config, profile string) string {
+	if cfg == nil {
+		return ""
+	}
+	for _, acc := range cfg.Accounts {
+		if firstNonEmpty(acc.AwsCliProfile, acc.Name) == profile {
+			return acc.Name
+		}
+	}
+	return ""
+}
+
+// verifyStatus checks credentials of entries that are not expired with sts:GetCallerIdentity.
+func verifyStatus(ctx context.Context, entries []statusEntry) {
+	for i := range entries {
+		e := &entries[i]
+		if e.Expired {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		identity, err := aws.GetCallerIdentity(ctx, e.cred)
+		cancel()
+		if err != nil {
+			e.VerifyError = err.Error()
+			continue
+		}
+		e.Identity = &identity
+	}
+}
+
+// printStatus prints entries as a table, with the identity column when credentials were verified.
+func printStatus(out io.Writer, entries []statusEntry, verified bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "PROFILE\tACCOUNT\tROLE\tREGION\tEXPIRES\tREMAINING\tSTATUS"
+	if verified {
+		header += "\tIDENTITY"
+	}
+	fmt.Fprintln(w, header)
+	for _, e := range entries {
+		remaining, status, identity := "-", "expired", "-"
+		if !e.Expired {
+			remaining = (time.Duration(e.RemainingSeconds) * time.Second).String()
+			status = "valid"
+		}
+		switch {
+		case e.Identity != nil:
+			identity = e.Identity.Arn
+		case e.VerifyError != "":
+			status, identity = "invalid", e.VerifyError
+		}
+
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			firstNonEmpty(e.Profile, e.File), firstNonEmpty(e.Account, "-"), firstNonEmpty(e.RoleArn, "-"),
+			firstNonEmpty(e.Region, "-"), formatExpiration(e.Expiration), remaining, status)
+		if verified {
+			line += "\t" + identity
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/config"
+)
+
+// writeStatusFixtures writes a valid and an expired profile and the env file into a temporary home.
+func writeStatusFixtures(t *testing.T) string {
+	t.Helper()
+	resetViper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(aws.EnvSharedCredentialsFile, "")
+	t.Setenv(aws.EnvConfigFile, "")
+
+	valid := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+	acc := &config.Account{Name: "prod"}
+	if err := writeAwsProfile(aws.AwsSamlOutput{AccessKeyID: "AKIAVALID", SecretAccessKey: "SECRET", Region: "us-east-1", Expiration: &valid,
+		RoleArn: "arn:aws:iam::111:role/admin"}, "prod-profile", acc); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAwsProfile(aws.AwsSamlOutput{AccessKeyID: "AKIAOLD", Region: "eu-west-1", Expiration: &expired}, "old", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := outputCredentials(aws.AwsSamlOutput{AccessKeyID: "AKIAENV", SecretAccessKey: "SECRET", Region: "ca-central-1", Expiration: &valid,
+		RoleArn: "arn:aws:iam::222:role/dev"}, "env", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+func TestStatusCmd_JSON(t *testing.T) {
+	home := writeStatusFixtures(t)
+
+	var out bytes.Buffer
+	cmd := newStatusCmd(newTestConfig(testAccounts()))
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("status error = %v", err)
+	}
+
+	var entries []statusEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(entries) != 3 {
+		t.Fatalf("status got %d entries, want 3:\n%s", len(entries), out.String())
+	}
+
+	prod := entries[0]
+	if prod.Profile != "prod-profile" || prod.Account != "prod" || prod.RoleArn != "arn:aws:iam::111:role/admin" ||
+		prod.Region != "us-east-1" || prod.Expired || prod.RemainingSeconds < 3500 {
+		t.Errorf("status got prod = %+v", prod)
+	}
+	if old := entries[1]; old.Profile != "old" || !old.Expired || old.RemainingSeconds != 0 {
+		t.Errorf("status got old = %+v", old)
+	}
+	env := entries[2]
+	if env.Profile != "" || env.File != filepath.Join(home, ".jc2aws.env") || env.RoleArn != "arn:aws:iam::222:role/dev" ||
+		env.Region != "ca-central-1" || env.Expired {
+		t.Errorf("status got env file = %+v", env)
+	}
+}
+
+func TestStatusCmd_Verify(t *testing.T) {
+	writeStatusFixtures(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/xml")
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=AKIAVALID/") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidClientTokenId</Code><Message>invalid token</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:sts::111:assumed-role/admin/alice</Arn>
+    <UserId>AROAEXAMPLE:alice</UserId>
+    <Account>111</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+	aws.STSEndpoint = srv.URL
+	t.Cleanup(func() { aws.STSEndpoint = "" })
+
+	var out bytes.Buffer
+	cmd := newStatusCmd(newTestConfig(testAccounts()))
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--verify"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("status error = %v", err)
+	}
+
+	// Expired credentials are not verified
+	if calls != 2 {
+		t.Errorf("want 2 GetCallerIdentity calls, got %d", calls)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], "IDENTITY") {
+		t.Fatalf("status got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[1], "valid") || !strings.HasSuffix(lines[1], "arn:aws:sts::111:assumed-role/admin/alice") {
+		t.Errorf("status got prod line %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "expired") {
+		t.Errorf("status got old line %q", lines[2])
+	}
+	if !strings.Contains(lines[3], "invalid") || !strings.Contains(lines[3], "InvalidClientTokenId") {
+		t.Errorf("status got env file line %q", lines[3])
+	}
+}
+
+func TestStatusCmd_Empty(t *testing.T) {
+	resetViper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(aws.EnvSharedCredentialsFile, "")
+	t.Setenv(aws.EnvConfigFile, "")
+
+	var out bytes.Buffer
+	cmd := newStatusCmd(&appConfig{})
+	cmd.SetOut(&out)
+	cmd.SetArgs(nil)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("status error = %v", err)
+	}
+	if !strings.Contains(out.String(), "No credentials written by jc2aws found") {
+		t.Errorf("status got %q", out.String())
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/yousysadmin/jc2aws/internal/aws"
 	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/saml"
 	"github.com/yousysadmin/jc2aws/internal/validators"
 )
 
@@ -23,11 +25,15 @@ const (
 	stepOutputFormat
 	stepAwsCliProfile
 	stepMFA
+	stepMFAMethod
 	stepConfirm
 	stepFetching // credential fetching in progress
 	stepDone     // all done
 )
 
+// discoveredValue is displayed for values left empty to be discovered from the SAML assertion.
+const discoveredValue = "(from SAML)"
+
 // Step value source constants.
 const (
 	sourceNone        = ""            // not yet set
@@ -55,6 +61,7 @@ func allStepMeta() []stepMeta {
 		{id: stepOutputFormat, title: "Output Format"},
 		{id: stepAwsCliProfile, title: "AWS CLI Profile"},
 		{id: stepMFA, title: "MFA"},
+		{id: stepMFAMethod, title: "MFA Method"},
 		{id: stepConfirm, title: "Confirm"},
 	}
 }
@@ -114,6 +121,9 @@ func buildRoleSelect(account config.Account) selectModel {
 		details := []detailPair{
 			{"ARN", r.Arn},
 		}
+		if len(r.Chain) > 0 {
+			details = append(details, detailPair{"Chained to", r.TargetArn()})
+		}
 		items = append(items, selectItem{
 			name:        r.Name,
 			description: r.Description,
@@ -123,6 +133,22 @@ func buildRoleSelect(account config.Account) selectModel {
 	return newSelectModel("Select role:", items)
 }
 
+// buildSamlRoleSelect creates a selectModel for roles discovered from the SAML assertion.
+func buildSamlRoleSelect(roles []saml.Role) selectModel {
+	var items []selectItem
+	for _, r := range roles {
+		details := []detailPair{
+			{"Name", r.Name()},
+			{"Principal ARN", r.PrincipalArn},
+		}
+		items = append(items, selectItem{
+			name:    r.RoleArn,
+			details: details,
+		})
+	}
+	return newSelectModel("Select role (from SAML assertion):", items)
+}
+
 // buildRegionSelect creates a selectModel for AWS region selection.
 func buildRegionSelect(regions []string) selectModel {
 	var items []selectItem
@@ -139,11 +165,30 @@ func buildOutputFormatSelect() selectModel {
 		{name: "env", description: "Write to ~/.jc2aws.env"},
 		{name: "cli-stdout", description: "Print AWS CLI credentials to stdout"},
 		{name: "env-stdout", description: "Print environment variables to stdout"},
+		{name: "json", description: "Write to ~/.jc2aws.json"},
+		{name: "json-stdout", description: "Print credentials as JSON to stdout"},
+		{name: "export", description: "Print shell export statements to stdout"},
 		{name: "shell", description: "Launch a shell with AWS credentials as env vars"},
+		{name: "console", description: "Print an AWS console sign-in URL to stdout"},
 	}
 	return newSelectModel("Select output format:", items)
 }
 
+// mfaMethodDescriptions describe MFA methods offered when a token is not set.
+var mfaMethodDescriptions = map[string]string{
+	jumpcloud.MFAMethodPush: "Approve a push notification in JumpCloud Protect",
+	jumpcloud.MFAMethodDuo:  "Approve a Duo push notification",
+}
+
+// buildMFAMethodSelect creates a selectModel for MFA methods available for the user.
+func buildMFAMethodSelect(methods []string) selectModel {
+	var items []selectItem
+	for _, method := range methods {
+		items = append(items, selectItem{name: method, description: mfaMethodDescriptions[method]})
+	}
+	return newSelectModel("Select MFA method:", items)
+}
+
 // Input builders use shared validators.
 
 func buildEmailInput() inputModel {
@@ -158,12 +203,20 @@ func buildIdpURLInput() inputModel {
 	return newInputModel("IDP URL", false, validators.Get("idp-url"))
 }
 
+// buildPrincipalARNInput creates the principal ARN input, which may be left empty
+// to discover the ARN from the SAML assertion.
 func buildPrincipalARNInput() inputModel {
-	return newInputModel("Principal ARN", false, validators.Get("principal-arn"))
+	m := newInputModel("Principal ARN", false, validators.Optional(validators.Get("principal-arn")))
+	m.input.Placeholder = "Principal ARN (empty to discover from SAML)"
+	return m
 }
 
+// buildRoleARNInput creates the role ARN input, which may be left empty
+// to discover the role from the SAML assertion.
 func buildRoleARNInput() inputModel {
-	return newInputModel("Role ARN", false, validators.Get("role-arn"))
+	m := newInputModel("Role ARN", false, validators.Optional(validators.Get("role-arn")))
+	m.input.Placeholder = "Role ARN (empty to discover from SAML)"
+	return m
 }
 
 func buildAwsCliProfileInput() inputModel {
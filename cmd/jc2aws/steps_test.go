@@ -17,7 +17,7 @@ func TestAllStepMetaOrder(t *testing.T) {
 	expectedIDs := []stepID{
 		stepAccount, stepRole, stepRegion, stepEmail,
 		stepPassword, stepIdpURL, stepPrincipalARN,
-		stepOutputFormat, stepAwsCliProfile, stepMFA, stepConfirm,
+		stepOutputFormat, stepAwsCliProfile, stepMFA, stepMFAMethod, stepConfirm,
 	}
 
 	if len(steps) != len(expectedIDs) {
@@ -164,15 +164,15 @@ func TestBuildOutputFormatSelect(t *testing.T) {
 	if m.label != "Select output format:" {
 		t.Errorf("expected label 'Select output format:', got %q", m.label)
 	}
-	if len(m.items) != 5 {
-		t.Fatalf("expected 5 output format items, got %d", len(m.items))
+	if len(m.items) != 9 {
+		t.Fatalf("expected 9 output format items, got %d", len(m.items))
 	}
 
 	names := make(map[string]bool)
 	for _, item := range m.items {
 		names[item.name] = true
 	}
-	for _, expected := range []string{"cli", "env", "cli-stdout", "env-stdout", "shell"} {
+	for _, expected := range []string{"cli", "env", "cli-stdout", "env-stdout", "json", "json-stdout", "export", "shell", "console"} {
 		if !names[expected] {
 			t.Errorf("expected output format %q in items", expected)
 		}
@@ -307,8 +307,8 @@ func TestStepIDValues(t *testing.T) {
 	if stepAccount != 0 {
 		t.Error("stepAccount should be 0")
 	}
-	if stepDone != 12 {
-		t.Errorf("stepDone should be 12, got %d", int(stepDone))
+	if stepDone != 13 {
+		t.Errorf("stepDone should be 13, got %d", int(stepDone))
 	}
 	// Verify ordering: Confirm < Fetching < Done
 	if stepConfirm >= stepFetching {
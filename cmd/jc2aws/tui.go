@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -11,6 +15,8 @@ import (
 
 	"github.com/yousysadmin/jc2aws/internal/aws"
 	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/saml"
 	"github.com/yousysadmin/jc2aws/pkg"
 	"github.com/yousysadmin/jc2aws/pkg/update"
 )
@@ -21,7 +27,22 @@ import (
 
 type credentialResultMsg struct {
 	cred aws.AwsSamlOutput
-	err  error
+	// identity of the credentials checked with --verify
+	identity *aws.CallerIdentity
+	err      error
+}
+
+// samlRolesMsg is sent when the SAML assertion contains several roles
+// and the user has to pick one.
+type samlRolesMsg struct {
+	assertion string
+	roles     []saml.Role
+}
+
+// mfaMethodsMsg is sent when JumpCloud requires MFA and the method can't be
+// picked automatically, methods are usable without a TOTP token.
+type mfaMethodsMsg struct {
+	methods []string
 }
 
 type outputResultMsg struct {
@@ -62,6 +83,25 @@ type tuiModel struct {
 	// Collected values
 	values map[stepID]string
 
+	// SAML assertion and roles discovered from it, set when the user
+	// has to pick a role after authentication.
+	samlAssertion string
+	samlRoles     []saml.Role
+
+	// MFA methods usable without a TOTP token, set when the user
+	// has to pick one after JumpCloud reported the available factors.
+	mfaMethods []string
+
+	// Roles chained after the SAML login, set by a configured role with a chain
+	roleChain []aws.AssumeRoleInput
+
+	// End of the wait for a new TOTP code (unix nanoseconds, 0 if not waiting),
+	// set by the credential fetch and shown by the spinner
+	totpWait *atomic.Int64
+	// Clock skew to the JumpCloud server (nanoseconds), set by the credential fetch
+	// when TOTP codes were generated with the server time
+	clockSkew *atomic.Int64
+
 	// Active component (only one at a time)
 	selectComp selectModel
 	inputComp  inputModel
@@ -73,6 +113,7 @@ type tuiModel struct {
 
 	// Result
 	credResult *aws.AwsSamlOutput
+	identity   *aws.CallerIdentity
 	credErr    error
 	outputErr  error
 	outputDone bool
@@ -96,13 +137,15 @@ func newTuiModel(cfg *appConfig) tuiModel {
 	sp.Style = spinnerStyle
 
 	m := tuiModel{
-		appCfg:  cfg,
-		steps:   allStepMeta(),
-		current: stepAccount,
-		values:  make(map[stepID]string),
-		spinner: sp,
-		width:   80,
-		height:  24,
+		appCfg:    cfg,
+		steps:     allStepMeta(),
+		current:   stepAccount,
+		values:    make(map[stepID]string),
+		spinner:   sp,
+		totpWait:  new(atomic.Int64),
+		clockSkew: new(atomic.Int64),
+		width:     80,
+		height:    24,
 	}
 
 	m.preResolveSteps()
@@ -159,19 +202,27 @@ func (m *tuiModel) initStep() {
 		m.compType = "select"
 
 	case stepRole:
+		if len(m.samlRoles) > 0 {
+			m.selectComp = buildSamlRoleSelect(m.samlRoles)
+			m.compType = "select"
+			return
+		}
 		if roleARN := viper.GetString(keyRoleARN); roleARN != "" {
 			m.setStepValueWithSource(stepRole, roleARN, sourcePreset)
 			m.advanceStep()
 			return
 		}
-		if roleName := viper.GetString(keyRoleName); roleName != "" && m.account != nil {
-			role, err := m.account.FindAWSRoleArnByName(roleName)
-			if err == nil {
-				m.values[stepRole] = role.Arn
-				m.setStepValueWithSource(stepRole, role.Name, sourcePreset)
-				m.advanceStep()
-				return
+		if roleName := viper.GetString(keyRoleName); roleName != "" {
+			if m.account != nil {
+				if role, err := m.account.FindAWSRoleArnByName(roleName); err == nil {
+					m.values[stepRole] = role.Arn
+					m.roleChain = roleChain(role)
+				}
 			}
+			// A role name not found in config is matched against the SAML assertion.
+			m.setStepValueWithSource(stepRole, roleName, sourcePreset)
+			m.advanceStep()
+			return
 		}
 		if m.account != nil && len(m.account.AWSRoleArns) > 0 {
 			m.selectComp = buildRoleSelect(*m.account)
@@ -266,6 +317,16 @@ func (m *tuiModel) initStep() {
 		m.inputComp = buildMFAInput()
 		m.compType = "input"
 
+	case stepMFAMethod:
+		if len(m.mfaMethods) > 0 {
+			m.selectComp = buildMFAMethodSelect(m.mfaMethods)
+			m.compType = "select"
+			return
+		}
+		// Factors are only known after logging in, auto picks the method then
+		m.setStepValueWithSource(stepMFAMethod, m.resolveMFAMethod(), sourcePreset)
+		m.advanceStep()
+
 	case stepConfirm:
 		m.choiceComp = newChoiceModel("Review and confirm", []string{"Confirm", "Restart"})
 		m.compType = "choice"
@@ -282,11 +343,11 @@ func (m *tuiModel) initStep() {
 		}
 
 		format := m.resolveOutputFormat()
-		switch format {
-		case "shell":
+		switch {
+		case format == "shell":
 			// Shell launches post-TUI; show result and wait for any key.
 			m.compType = "await-key"
-		case "cli-stdout", "env-stdout":
+		case isStdoutFormat(format):
 			// Stdout formats: immediately quit; output prints post-TUI.
 			m.done = true
 			m.compType = ""
@@ -337,10 +398,8 @@ func (m *tuiModel) preResolveSteps() {
 	// Role
 	if viper.GetString(keyRoleARN) != "" {
 		m.setStepValueWithSource(stepRole, viper.GetString(keyRoleARN), sourcePreset)
-	} else if roleName := viper.GetString(keyRoleName); roleName != "" && acc != nil {
-		if role, err := acc.FindAWSRoleArnByName(roleName); err == nil {
-			m.setStepValueWithSource(stepRole, role.Name, sourcePreset)
-		}
+	} else if roleName := viper.GetString(keyRoleName); roleName != "" {
+		m.setStepValueWithSource(stepRole, roleName, sourcePreset)
 	}
 
 	// Region
@@ -385,6 +444,15 @@ func (m *tuiModel) preResolveSteps() {
 	if firstNonEmpty(resolveString(keyMFA, acc), m.values[stepMFA]) != "" {
 		m.setStepValueWithSource(stepMFA, "(set)", sourcePreset)
 	}
+
+	// MFA Method
+	m.setStepValueWithSource(stepMFAMethod, m.resolveMFAMethod(), sourcePreset)
+}
+
+// resolveMFAMethod returns the effective MFA method: the one picked in the
+// TUI, then flag/env/config, then auto.
+func (m tuiModel) resolveMFAMethod() string {
+	return firstNonEmpty(m.values[stepMFAMethod], resolveString(keyMFAMethod, m.account), jumpcloud.MFAMethodAuto)
 }
 
 // resolveOutputFormat returns the effective output format.
@@ -441,9 +509,29 @@ func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.credResult = &msg.cred
+		m.identity = msg.identity
 		// Write output immediately inside the TUI
 		return m, m.writeOutput()
 
+	case mfaMethodsMsg:
+		if len(msg.methods) == 0 {
+			// Only TOTP is available: ask for the token and confirm again
+			m.current = stepMFA
+		} else {
+			m.mfaMethods = msg.methods
+			m.current = stepMFAMethod
+		}
+		m.initStep()
+		return m, m.initCmd()
+
+	case samlRolesMsg:
+		// Go back to the role step to pick one of the discovered roles
+		m.samlAssertion = msg.assertion
+		m.samlRoles = msg.roles
+		m.current = stepRole
+		m.initStep()
+		return m, m.initCmd()
+
 	case outputResultMsg:
 		m.outputDone = true
 		if msg.err != nil {
@@ -465,6 +553,9 @@ func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.selectComp, cmd = m.selectComp.Update(msg)
 		if item, ok := m.selectComp.Selected(); ok {
 			m.handleSelectResult(item)
+			if m.current == stepFetching {
+				return m, tea.Batch(m.spinner.Tick, m.fetchCredentials())
+			}
 			return m, m.initCmd()
 		}
 		return m, cmd
@@ -544,10 +635,26 @@ func (m *tuiModel) handleSelectResult(item selectItem) {
 		m.advanceStep()
 
 	case stepRole:
+		if len(m.samlRoles) > 0 {
+			// Role picked from the SAML assertion: fetch credentials right away,
+			// the assertion is only valid for a few minutes.
+			for _, r := range m.samlRoles {
+				if r.RoleArn == item.name {
+					m.values[stepRole] = r.RoleArn
+					m.values[stepPrincipalARN] = r.PrincipalArn
+					break
+				}
+			}
+			m.setStepValueWithSource(stepRole, truncateARN(item.name), sourceInteractive)
+			m.current = stepFetching
+			m.compType = "spinner"
+			return
+		}
 		if m.account != nil {
 			for _, r := range m.account.AWSRoleArns {
 				if r.Name == item.name {
 					m.values[stepRole] = r.Arn
+					m.roleChain = roleChain(r)
 					break
 				}
 			}
@@ -564,6 +671,13 @@ func (m *tuiModel) handleSelectResult(item selectItem) {
 		m.values[stepOutputFormat] = item.name
 		m.setStepValueWithSource(stepOutputFormat, item.name, sourceInteractive)
 		m.advanceStep()
+
+	case stepMFAMethod:
+		// Picked after the login was confirmed: fetch credentials right away
+		m.values[stepMFAMethod] = item.name
+		m.setStepValueWithSource(stepMFAMethod, item.name, sourceInteractive)
+		m.current = stepFetching
+		m.compType = "spinner"
 	}
 }
 
@@ -571,7 +685,7 @@ func (m *tuiModel) handleInputResult(val string) {
 	switch m.current {
 	case stepRole:
 		m.values[stepRole] = val
-		m.setStepValueWithSource(stepRole, truncateARN(val), sourceInteractive)
+		m.setStepValueWithSource(stepRole, firstNonEmpty(truncateARN(val), discoveredValue), sourceInteractive)
 	case stepEmail:
 		m.values[stepEmail] = val
 		m.setStepValueWithSource(stepEmail, val, sourceInteractive)
@@ -583,7 +697,7 @@ func (m *tuiModel) handleInputResult(val string) {
 		m.setStepValueWithSource(stepIdpURL, val, sourceInteractive)
 	case stepPrincipalARN:
 		m.values[stepPrincipalARN] = val
-		m.setStepValueWithSource(stepPrincipalARN, truncateARN(val), sourceInteractive)
+		m.setStepValueWithSource(stepPrincipalARN, firstNonEmpty(truncateARN(val), discoveredValue), sourceInteractive)
 	case stepAwsCliProfile:
 		m.values[stepAwsCliProfile] = val
 		m.setStepValueWithSource(stepAwsCliProfile, val, sourceInteractive)
@@ -606,18 +720,106 @@ func (m tuiModel) restart() tuiModel {
 
 func (m tuiModel) fetchCredentials() tea.Cmd {
 	return func() tea.Msg {
-		email := firstNonEmpty(resolveString(keyEmail, m.account), m.values[stepEmail])
-		password := firstNonEmpty(resolveString(keyPassword, m.account), m.values[stepPassword])
-		idpURL := firstNonEmpty(resolveString(keyIdpURL, m.account), m.values[stepIdpURL])
-		mfa := firstNonEmpty(resolveString(keyMFA, m.account), m.values[stepMFA])
-		principalARN := firstNonEmpty(resolveString(keyPrincipalARN, m.account), m.values[stepPrincipalARN])
-		roleARN := firstNonEmpty(viper.GetString(keyRoleARN), m.values[stepRole])
-		region := firstNonEmpty(resolveString(keyRegion, m.account), m.values[stepRegion])
-		duration := resolveDuration(m.account)
+		req := m.credentialRequest()
+
+		// Role was picked from an already obtained SAML assertion,
+		// reuse it instead of authenticating again.
+		if m.samlAssertion != "" {
+			cred, err := assumeSamlRole(req, m.samlAssertion)
+			return credentialResult(cred, err)
+		}
+
+		req, err := req.withSecrets(m.account)
+		if err != nil {
+			return credentialResultMsg{err: err}
+		}
+		assertion, err := getSamlAssertion(req)
+		if mfaErr, ok := errors.AsType[*jumpcloud.MFARequiredError](err); ok {
+			return mfaMethodsMsg{methods: mfaErr.Methods()}
+		}
+		if err != nil {
+			return credentialResultMsg{err: err}
+		}
+
+		cred, err := assumeSamlRole(req, assertion)
+		if rolesErr, ok := errors.AsType[*samlRolesError](err); ok {
+			return samlRolesMsg{assertion: assertion, roles: rolesErr.roles}
+		}
+		return credentialResult(cred, err)
+	}
+}
 
-		cred, err := getCredentials(email, password, idpURL, mfa, principalARN, roleARN, region, duration)
-		return credentialResultMsg{cred: cred, err: err}
+// credentialResult returns the message with the obtained credentials, verified if --verify is set.
+func credentialResult(cred aws.AwsSamlOutput, err error) credentialResultMsg {
+	if err != nil {
+		return credentialResultMsg{err: err}
 	}
+	identity, err := verifyCredentials(context.Background(), cred)
+	return credentialResultMsg{cred: cred, identity: identity, err: err}
+}
+
+// setTOTPWait records the end of the wait for a new TOTP code, called by the credential fetch.
+func (m tuiModel) setTOTPWait(remaining time.Duration) {
+	if m.totpWait == nil {
+		return
+	}
+	if remaining == 0 {
+		m.totpWait.Store(0)
+		return
+	}
+	m.totpWait.Store(time.Now().Add(remaining).UnixNano())
+}
+
+// setClockSkew records the clock skew to the JumpCloud server, called by the credential fetch.
+func (m tuiModel) setClockSkew(skew time.Duration) {
+	if m.clockSkew != nil {
+		m.clockSkew.Store(int64(skew))
+	}
+}
+
+// viewClockSkew returns the clock skew warning, empty if the clock is in sync.
+func (m tuiModel) viewClockSkew() string {
+	if m.clockSkew == nil || m.clockSkew.Load() == 0 {
+		return ""
+	}
+	return warnStyle.Render("\u26a0 "+clockSkewWarning(time.Duration(m.clockSkew.Load()))) + "\n\n"
+}
+
+// totpWaitRemaining returns the time left until a new TOTP code is available, 0 if not waiting.
+func (m tuiModel) totpWaitRemaining() time.Duration {
+	if m.totpWait == nil || m.totpWait.Load() == 0 {
+		return 0
+	}
+	return max(time.Until(time.Unix(0, m.totpWait.Load())), 0)
+}
+
+// credentialRequest collects the values resolved by the wizard.
+func (m tuiModel) credentialRequest() credentialRequest {
+	req := credentialRequest{
+		Email:            firstNonEmpty(resolveString(keyEmail, m.account), m.values[stepEmail]),
+		Password:         firstNonEmpty(resolveString(keyPassword, m.account), m.values[stepPassword]),
+		IdpURL:           firstNonEmpty(resolveString(keyIdpURL, m.account), m.values[stepIdpURL]),
+		MFA:              firstNonEmpty(resolveString(keyMFA, m.account), m.values[stepMFA]),
+		MFAMethod:        m.resolveMFAMethod(),
+		ConsoleURL:       resolveString(keyJCConsoleURL, m.account),
+		ReuseSession:     viper.GetBool(keyReuseSession),
+		OnTOTPWait:       m.setTOTPWait,
+		OnClockSkew:      m.setClockSkew,
+		PrincipalARN:     firstNonEmpty(resolveString(keyPrincipalARN, m.account), m.values[stepPrincipalARN]),
+		RoleARN:          firstNonEmpty(viper.GetString(keyRoleARN), m.values[stepRole]),
+		RoleName:         viper.GetString(keyRoleName),
+		Region:           firstNonEmpty(resolveString(keyRegion, m.account), m.values[stepRegion]),
+		Duration:         resolveDuration(m.account),
+		DurationFromSAML: durationFromSAML(m.account),
+		Chain:            m.roleChain,
+	}
+
+	// A role picked from the SAML assertion comes with its own principal
+	if m.samlAssertion != "" {
+		req.PrincipalARN = m.values[stepPrincipalARN]
+	}
+
+	return req
 }
 
 func (m tuiModel) writeOutput() tea.Cmd {
@@ -631,13 +833,13 @@ func (m tuiModel) writeOutput() tea.Cmd {
 			// Shell launch happens after TUI exits; nothing to write now.
 			return outputResultMsg{}
 
-		case format == "cli-stdout" || format == "env-stdout":
+		case isStdoutFormat(format):
 			// Always defer stdout output to post-TUI (real stdout).
 			return outputResultMsg{}
 
 		default:
 			// File-based formats (cli, env): write immediately.
-			err := outputCredentials(*cred, format, profileName)
+			err := outputCredentials(*cred, format, profileName, m.account)
 			return outputResultMsg{err: err}
 		}
 	}
@@ -752,8 +954,17 @@ func (m tuiModel) viewContent() string {
 		// Done state: show result + summary + menu
 		return banner + m.viewDoneResult() + "\n" + m.viewSummary() + "\n" + m.choiceComp.View()
 	case "spinner":
+		hint := "This may take a few seconds"
+		if method := m.resolveMFAMethod(); method == jumpcloud.MFAMethodPush || method == jumpcloud.MFAMethodDuo {
+			hint = pushNotice(method)
+		}
+		if remaining := m.totpWaitRemaining(); remaining > 0 {
+			return banner + "\n" + m.spinner.View() +
+				fmt.Sprintf(" Waiting %ds for a new TOTP code...\n\n", int(remaining.Round(time.Second).Seconds())) +
+				hintStyle.Render("The current code was already used, JumpCloud accepts a code only once")
+		}
 		return banner + "\n" + m.spinner.View() + " Authenticating with JumpCloud...\n\n" +
-			hintStyle.Render("This may take a few seconds")
+			hintStyle.Render(hint)
 	case "await-key":
 		return banner + m.viewDoneResult() + "\n" + m.viewSummary() + "\n" +
 			hintStyle.Render("press any key to continue  esc restart")
@@ -809,7 +1020,7 @@ func (m tuiModel) viewSummary() string {
 func (m tuiModel) viewDoneResult() string {
 	if m.credErr != nil {
 		return errorBannerStyle.Render("\u2717 Failed to obtain credentials") + "\n\n" +
-			errorStyle.Render(m.credErr.Error()) + "\n"
+			m.viewClockSkew() + errorStyle.Render(m.credErr.Error()) + "\n"
 	}
 	if m.outputErr != nil {
 		return successBannerStyle.Render("\u2713 Credentials obtained") + "\n\n" +
@@ -827,10 +1038,18 @@ func (m tuiModel) viewDoneResult() string {
 			details.WriteString(detailLabelStyle.Render("Format:") + " " + highlightStyle.Render(format) + "\n")
 		}
 
+		details.WriteString(m.viewClockSkew())
 		details.WriteString(detailLabelStyle.Render("Region:") + " " + highlightStyle.Render(m.credResult.Region) + "\n")
 		if m.credResult.Expiration != nil {
 			details.WriteString(detailLabelStyle.Render("Expires:") + " " + highlightStyle.Render(m.credResult.Expiration.Local().Format("15:04:05 MST")) + "\n")
 		}
+		if m.identity != nil {
+			details.WriteString(detailLabelStyle.Render("Account:") + " " + highlightStyle.Render(m.identity.Account) + "\n")
+			details.WriteString(detailLabelStyle.Render("Identity:") + " " + highlightStyle.Render(m.identity.Arn) + "\n")
+			if m.identity.SessionName != "" {
+				details.WriteString(detailLabelStyle.Render("Session:") + " " + highlightStyle.Render(m.identity.SessionName) + "\n")
+			}
+		}
 		return details.String()
 	}
 	return ""
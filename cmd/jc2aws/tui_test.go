@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,6 +12,8 @@ import (
 
 	"github.com/yousysadmin/jc2aws/internal/aws"
 	"github.com/yousysadmin/jc2aws/internal/config"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+	"github.com/yousysadmin/jc2aws/internal/saml"
 )
 
 // ---------------------------------------------------------------------------
@@ -1329,6 +1334,28 @@ func TestUpdate_CredentialResultSuccess(t *testing.T) {
 	}
 }
 
+func TestViewDoneResult_Identity(t *testing.T) {
+	resetViper()
+	m := tuiModel{
+		appCfg:     newTestConfig(nil),
+		values:     map[stepID]string{stepOutputFormat: "cli"},
+		credResult: &aws.AwsSamlOutput{Region: "us-east-1"},
+		identity:   &aws.CallerIdentity{Account: "111", Arn: "arn:aws:sts::111:assumed-role/admin/alice", SessionName: "alice"},
+		outputDone: true,
+	}
+	view := m.viewDoneResult()
+	for _, want := range []string{"111", "arn:aws:sts::111:assumed-role/admin/alice", "alice"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("viewDoneResult() does not contain %q:\n%s", want, view)
+		}
+	}
+
+	m.identity = nil
+	if view := m.viewDoneResult(); strings.Contains(view, "Identity") {
+		t.Errorf("viewDoneResult() without --verify shows the identity:\n%s", view)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // outputResultMsg handling
 // ---------------------------------------------------------------------------
@@ -1575,6 +1602,10 @@ func TestPreResolveSteps_NoAccount(t *testing.T) {
 		if s.id == stepAwsCliProfile {
 			continue
 		}
+		// MFA Method is picked only when JumpCloud reports several factors, "auto" until then
+		if s.id == stepMFAMethod {
+			continue
+		}
 		if s.source == sourcePreset {
 			t.Errorf("step %d (%s) should not be preset with no account and no Viper, got source=%q value=%q",
 				s.id, s.title, s.source, s.value)
@@ -2046,3 +2077,257 @@ func TestRestart_PreservesUpdateVersion(t *testing.T) {
 		t.Errorf("restart should preserve updateVersion: want %q, got %q", "2.0.0", nm.updateVersion)
 	}
 }
+
+// ---------------------------------------------------------------------------
+// SAML role discovery
+// ---------------------------------------------------------------------------
+
+func TestInitStep_RoleNameNotInConfigMatchedFromSAML(t *testing.T) {
+	resetViper()
+	viper.Set(keyRoleName, "poweruser")
+
+	cfg := newTestConfig(nil)
+	acc := testAccounts()[0]
+	m := tuiModel{
+		appCfg:  cfg,
+		steps:   allStepMeta(),
+		current: stepRole,
+		values:  make(map[stepID]string),
+		account: &acc,
+	}
+	m.initStep()
+
+	if m.current == stepRole {
+		t.Error("should advance past stepRole when role name is preset")
+	}
+	if stepValue(m, stepRole) != "poweruser" {
+		t.Errorf("role preset display: want %q, got %q", "poweruser", stepValue(m, stepRole))
+	}
+	if m.values[stepRole] != "" {
+		t.Errorf("role ARN should be left for SAML discovery, got %q", m.values[stepRole])
+	}
+}
+
+func TestHandleInputResult_EmptyRoleDiscoveredFromSAML(t *testing.T) {
+	resetViper()
+
+	cfg := newTestConfig(nil)
+	m := tuiModel{
+		appCfg:  cfg,
+		steps:   allStepMeta(),
+		current: stepRole,
+		values:  make(map[stepID]string),
+	}
+	m.handleInputResult("")
+
+	if m.values[stepRole] != "" {
+		t.Errorf("role ARN should be empty, got %q", m.values[stepRole])
+	}
+	if stepValue(m, stepRole) != discoveredValue {
+		t.Errorf("role display: want %q, got %q", discoveredValue, stepValue(m, stepRole))
+	}
+}
+
+func TestUpdate_SamlRolesMsgShowsRoleSelect(t *testing.T) {
+	resetViper()
+
+	cfg := newTestConfig(nil)
+	m := tuiModel{
+		appCfg:   cfg,
+		steps:    allStepMeta(),
+		current:  stepFetching,
+		values:   make(map[stepID]string),
+		compType: "spinner",
+	}
+
+	roles := []saml.Role{
+		{RoleArn: "arn:aws:iam::111:role/admin", PrincipalArn: "arn:aws:iam::111:saml-provider/jc"},
+		{RoleArn: "arn:aws:iam::222:role/admin", PrincipalArn: "arn:aws:iam::222:saml-provider/jc"},
+	}
+	result, _ := m.Update(samlRolesMsg{assertion: "ASSERTION", roles: roles})
+	rm := result.(tuiModel)
+
+	if rm.current != stepRole {
+		t.Errorf("should go back to stepRole, got %d", rm.current)
+	}
+	if rm.compType != "select" {
+		t.Errorf("compType should be 'select', got %q", rm.compType)
+	}
+	if len(rm.selectComp.items) != 2 {
+		t.Errorf("select should list 2 discovered roles, got %d", len(rm.selectComp.items))
+	}
+	if rm.samlAssertion != "ASSERTION" {
+		t.Errorf("SAML assertion should be kept for reuse, got %q", rm.samlAssertion)
+	}
+}
+
+func TestHandleSelectResult_SamlRoleStartsFetching(t *testing.T) {
+	resetViper()
+
+	cfg := newTestConfig(nil)
+	m := tuiModel{
+		appCfg:        cfg,
+		steps:         allStepMeta(),
+		current:       stepRole,
+		values:        make(map[stepID]string),
+		samlAssertion: "ASSERTION",
+		samlRoles: []saml.Role{
+			{RoleArn: "arn:aws:iam::111:role/admin", PrincipalArn: "arn:aws:iam::111:saml-provider/jc"},
+			{RoleArn: "arn:aws:iam::222:role/admin", PrincipalArn: "arn:aws:iam::222:saml-provider/jc2"},
+		},
+	}
+	m.initStep()
+	result, _ := m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = result.(tuiModel)
+	result, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	rm := result.(tuiModel)
+
+	if rm.current != stepFetching {
+		t.Errorf("should go straight to stepFetching, got %d", rm.current)
+	}
+	if cmd == nil {
+		t.Error("should return a command to fetch credentials")
+	}
+	if rm.values[stepRole] != "arn:aws:iam::222:role/admin" {
+		t.Errorf("role ARN: want second role, got %q", rm.values[stepRole])
+	}
+
+	req := rm.credentialRequest()
+	if req.PrincipalARN != "arn:aws:iam::222:saml-provider/jc2" {
+		t.Errorf("principal ARN should come from the picked role, got %q", req.PrincipalARN)
+	}
+}
+
+func TestUpdate_MFAMethodsMsgShowsMethodSelect(t *testing.T) {
+	resetViper()
+
+	cfg := newTestConfig(nil)
+	m := tuiModel{
+		appCfg:   cfg,
+		steps:    allStepMeta(),
+		current:  stepFetching,
+		values:   make(map[stepID]string),
+		compType: "spinner",
+	}
+
+	result, _ := m.Update(mfaMethodsMsg{methods: []string{"push"}})
+	rm := result.(tuiModel)
+
+	if rm.current != stepMFAMethod || rm.compType != "select" {
+		t.Fatalf("should show the MFA method select, got step %d comp %q", rm.current, rm.compType)
+	}
+	if len(rm.selectComp.items) != 1 || rm.selectComp.items[0].name != "push" {
+		t.Errorf("select should list the available methods, got %+v", rm.selectComp.items)
+	}
+
+	result, cmd := rm.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	rm = result.(tuiModel)
+	if rm.current != stepFetching || cmd == nil {
+		t.Errorf("picking a method should fetch credentials right away, got step %d", rm.current)
+	}
+	if req := rm.credentialRequest(); req.MFAMethod != "push" {
+		t.Errorf("MFA method: want push, got %q", req.MFAMethod)
+	}
+}
+
+func TestUpdate_MFAMethodsMsgWithoutMethodsAsksToken(t *testing.T) {
+	resetViper()
+
+	cfg := newTestConfig(nil)
+	m := tuiModel{
+		appCfg:   cfg,
+		steps:    allStepMeta(),
+		current:  stepFetching,
+		values:   make(map[stepID]string),
+		compType: "spinner",
+	}
+
+	result, _ := m.Update(mfaMethodsMsg{})
+	rm := result.(tuiModel)
+
+	if rm.current != stepMFA || rm.compType != "input" {
+		t.Errorf("should ask for the MFA token, got step %d comp %q", rm.current, rm.compType)
+	}
+}
+
+func TestInitStep_MFAMethodPreset(t *testing.T) {
+	resetViper()
+	viper.Set(keyMFAMethod, "push")
+
+	m := tuiModel{
+		appCfg:  newTestConfig(nil),
+		steps:   allStepMeta(),
+		current: stepMFAMethod,
+		values:  make(map[stepID]string),
+	}
+	m.initStep()
+
+	if m.current != stepConfirm {
+		t.Errorf("MFA method step should be skipped, got step %d", m.current)
+	}
+	if stepValue(m, stepMFAMethod) != "push" {
+		t.Errorf("MFA method display: want push, got %q", stepValue(m, stepMFAMethod))
+	}
+}
+
+func TestViewContent_TOTPWaitCountdown(t *testing.T) {
+	resetViper()
+
+	m := newTuiModel(newTestConfig(nil))
+	m.current = stepFetching
+	m.compType = "spinner"
+
+	req := m.credentialRequest()
+	req.OnTOTPWait(12 * time.Second)
+	if v := m.viewContent(); !strings.Contains(v, "s for a new TOTP code") {
+		t.Errorf("spinner should show the TOTP countdown, got:\n%s", v)
+	}
+
+	req.OnTOTPWait(0)
+	if v := m.viewContent(); strings.Contains(v, "TOTP code") || !strings.Contains(v, "Authenticating with JumpCloud") {
+		t.Errorf("spinner should not show the countdown after the wait, got:\n%s", v)
+	}
+}
+
+func TestViewDoneResult_ClockSkewWarning(t *testing.T) {
+	resetViper()
+
+	m := newTuiModel(newTestConfig(nil))
+	m.credErr = errors.New("Authentication failed.")
+	if strings.Contains(m.viewDoneResult(), "JumpCloud time") {
+		t.Error("no clock skew warning expected when the clock is in sync")
+	}
+
+	m.credentialRequest().OnClockSkew(-90 * time.Second)
+	if v := m.viewDoneResult(); !strings.Contains(v, "1m30s ahead of JumpCloud") {
+		t.Errorf("viewDoneResult should warn about the clock skew, got:\n%s", v)
+	}
+}
+
+func TestFetchCredentials_TypedPasswordNotResolved(t *testing.T) {
+	resetViper()
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.Password = "cmd:echo x"
+	jc.TOTP = "123456"
+	jc.Start()
+	defer jc.Close()
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+	viper.Set(keyJCConsoleURL, jc.URL)
+
+	// Values typed in the wizard aren't secret references
+	m := newTuiModel(newTestConfig(nil))
+	m.values[stepEmail] = jumpcloudtest.DefaultEmail
+	m.values[stepPassword] = "cmd:echo x"
+	m.values[stepIdpURL] = jc.IdpURL()
+	m.values[stepMFA] = "123456"
+	m.values[stepRegion] = "us-east-1"
+
+	msg, ok := m.fetchCredentials()().(credentialResultMsg)
+	if !ok || msg.err != nil {
+		t.Fatalf("fetchCredentials() = %#v, want credentials with the typed password", msg)
+	}
+	if len(calls) != 1 {
+		t.Errorf("fetchCredentials() made %d STS calls, want 1", len(calls))
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/shellenv"
+)
+
+// newUnsetCmd creates the command printing statements that clear credentials set by the export format.
+func newUnsetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unset",
+		Short: "Print shell statements removing AWS credential environment variables",
+		Long: "Print shell statements removing the environment variables set by the export output format,\n" +
+			"to be evaluated by the shell: eval \"$(jc2aws unset)\"",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := shellenv.Unset(viper.GetString(keyShellSyntax), aws.EnvVarNames)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(cmd.OutOrStdout(), out)
+			return err
+		},
+	}
+}
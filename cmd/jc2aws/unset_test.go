@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestUnsetCmd(t *testing.T) {
+	resetViper()
+	viper.Set(keyShellSyntax, "fish")
+
+	var out bytes.Buffer
+	cmd := newUnsetCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs(nil)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unset error = %v", err)
+	}
+	want := "set -e AWS_ACCESS_KEY_ID AWS_SECRET_ACCESS_KEY AWS_SESSION_TOKEN AWS_REGION AWS_DEFAULT_REGION AWS_CREDENTIAL_EXPIRATION\n"
+	if out.String() != want {
+		t.Errorf("unset got = %q, want %q", out.String(), want)
+	}
+
+	viper.Set(keyShellSyntax, "cmd")
+	if err := cmd.Execute(); err == nil {
+		t.Error("unset expected error for unsupported shell syntax")
+	}
+}
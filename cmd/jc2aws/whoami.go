@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+// newWhoamiCmd creates the command which shows the AWS identity of the obtained credentials.
+func newWhoamiCmd(cfg *appConfig) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Get credentials and show their AWS identity",
+		Long: "Get credentials and call sts:GetCallerIdentity to show the account ID,\n" +
+			"the assumed role ARN and the session name of the credentials.",
+		Example: "  jc2aws whoami --account my-prod --role-name admin",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cred, _, err := headlessCredentials(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Second)
+			defer cancel()
+			identity, err := aws.GetCallerIdentity(ctx, cred)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(identity)
+			}
+			printIdentity(cmd.OutOrStdout(), identity)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output as JSON")
+	return cmd
+}
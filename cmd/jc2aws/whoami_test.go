@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+)
+
+// setupWhoami starts a fake JumpCloud and STS and sets credential flags for them.
+func setupWhoami(t *testing.T) {
+	t.Helper()
+	resetViper()
+	t.Setenv("HOME", t.TempDir())
+	jc := jumpcloudtest.NewUnstartedServer()
+	jc.TOTP = "123456"
+	jc.Start()
+	t.Cleanup(jc.Close)
+
+	var calls []url.Values
+	stubSTSWithSAML(t, &calls)
+
+	viper.Set(keyEmail, jumpcloudtest.DefaultEmail)
+	viper.Set(keyPassword, jumpcloudtest.DefaultPassword)
+	viper.Set(keyIdpURL, jc.IdpURL())
+	viper.Set(keyJCConsoleURL, jc.URL)
+	viper.Set(keyMFA, "123456")
+	viper.Set(keyRegion, "eu-west-1")
+	viper.Set(keyNoCache, true)
+}
+
+func TestWhoamiCmd(t *testing.T) {
+	setupWhoami(t)
+
+	var out bytes.Buffer
+	cmd := newWhoamiCmd(newTestConfig(nil))
+	cmd.SetOut(&out)
+	cmd.SetArgs(nil)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("whoami error = %v", err)
+	}
+	want := "Account: 111\nARN:     arn:aws:sts::111:assumed-role/admin/user@example.com\nSession: user@example.com\n"
+	if out.String() != want {
+		t.Errorf("whoami got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWhoamiCmd_JSON(t *testing.T) {
+	setupWhoami(t)
+
+	var out bytes.Buffer
+	cmd := newWhoamiCmd(newTestConfig(nil))
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("whoami error = %v", err)
+	}
+	var got aws.CallerIdentity
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if got.Account != "111" || got.SessionName != "user@example.com" {
+		t.Errorf("whoami got = %+v", got)
+	}
+}
+
+func TestCredentialResult_Verify(t *testing.T) {
+	setupWhoami(t)
+	cred := aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET", Region: "eu-west-1"}
+
+	if msg := credentialResult(cred, nil); msg.err != nil || msg.identity != nil {
+		t.Errorf("credentialResult() without --verify got identity %v, error %v", msg.identity, msg.err)
+	}
+
+	viper.Set(keyVerify, true)
+	msg := credentialResult(cred, nil)
+	if msg.err != nil || msg.identity == nil || msg.identity.Account != "111" {
+		t.Errorf("credentialResult() with --verify got identity %v, error %v", msg.identity, msg.err)
+	}
+
+	aws.STSEndpoint = "http://127.0.0.1:1"
+	if msg := credentialResult(cred, nil); msg.err == nil || !strings.Contains(msg.err.Error(), "verification failed") {
+		t.Errorf("credentialResult() with unreachable STS error = %v", msg.err)
+	}
+}
@@ -0,0 +1,209 @@
+// Package agent keeps AWS credentials of several targets fresh by
+// re-authenticating before the credentials expire.
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+const (
+	// DefaultRefreshMargin credentials are refreshed this long before they expire
+	DefaultRefreshMargin = 10 * time.Minute
+	// DefaultRetryInterval delay before retrying a failed refresh
+	DefaultRetryInterval = time.Minute
+	// DefaultLoginInterval minimal interval between logins of the same JumpCloud user.
+	// JumpCloud refuses a TOTP code that was already used, a new code is generated every 30 seconds.
+	DefaultLoginInterval = 31 * time.Second
+)
+
+// Target credentials kept fresh by the agent
+type Target struct {
+	// Name unique name of the target (e.g. "account/role/region")
+	Name string
+	// Profile AWS CLI profile the credentials are written to
+	Profile string
+	// User JumpCloud user, logins of the same user are spaced by LoginInterval
+	User string
+}
+
+// Fetcher obtain new credentials for the target
+type Fetcher interface {
+	Fetch(ctx context.Context, t Target) (aws.AwsSamlOutput, error)
+}
+
+// FetcherFunc adapter to use a function as a Fetcher
+type FetcherFunc func(ctx context.Context, t Target) (aws.AwsSamlOutput, error)
+
+// Fetch call f(ctx, t)
+func (f FetcherFunc) Fetch(ctx context.Context, t Target) (aws.AwsSamlOutput, error) {
+	return f(ctx, t)
+}
+
+// WriterFunc store credentials of the target (e.g. rewrite the AWS CLI profile)
+type WriterFunc func(t Target, cred aws.AwsSamlOutput) error
+
+// Status state of a target
+type Status struct {
+	Target      string     `json:"target"`
+	Profile     string     `json:"profile"`
+	Expiration  *time.Time `json:"expiration,omitempty"`
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+	NextRefresh *time.Time `json:"next_refresh,omitempty"`
+	Refreshes   int        `json:"refreshes"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Agent refresh credentials of the targets before they expire
+type Agent struct {
+	Targets []Target
+	Fetcher Fetcher
+	Writer  WriterFunc
+
+	RefreshMargin time.Duration
+	RetryInterval time.Duration
+	LoginInterval time.Duration
+
+	// OnRefresh is called after each refresh attempt (optional)
+	OnRefresh func(s Status)
+
+	mu        sync.Mutex
+	status    map[string]*Status
+	nextLogin map[string]time.Time
+}
+
+// New Init new agent with default intervals
+func New(targets []Target, fetcher Fetcher, writer WriterFunc) *Agent {
+	return &Agent{
+		Targets:       targets,
+		Fetcher:       fetcher,
+		Writer:        writer,
+		RefreshMargin: DefaultRefreshMargin,
+		RetryInterval: DefaultRetryInterval,
+		LoginInterval: DefaultLoginInterval,
+	}
+}
+
+// Run refresh credentials of all targets until the context is cancelled
+func (a *Agent) Run(ctx context.Context) error {
+	if len(a.Targets) == 0 {
+		return errors.New("no targets")
+	}
+
+	a.mu.Lock()
+	a.status = make(map[string]*Status, len(a.Targets))
+	a.nextLogin = make(map[string]time.Time)
+	for _, t := range a.Targets {
+		a.status[t.Name] = &Status{Target: t.Name, Profile: t.Profile}
+	}
+	a.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range a.Targets {
+		wg.Go(func() { a.runTarget(ctx, t) })
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// Status return states of all targets sorted by name
+func (a *Agent) Status() []Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	statuses := make([]Status, 0, len(a.status))
+	for _, s := range a.status {
+		statuses = append(statuses, *s)
+	}
+	slices.SortFunc(statuses, func(x, y Status) int { return strings.Compare(x.Target, y.Target) })
+	return statuses
+}
+
+// runTarget refresh credentials of the target in a loop
+func (a *Agent) runTarget(ctx context.Context, t Target) {
+	for {
+		next := a.refresh(ctx, t)
+		if !sleep(ctx, time.Until(next)) {
+			return
+		}
+	}
+}
+
+// refresh obtain and store new credentials, return time of the next refresh
+func (a *Agent) refresh(ctx context.Context, t Target) time.Time {
+	if !a.waitLogin(ctx, t.User) {
+		return time.Now()
+	}
+
+	cred, err := a.Fetcher.Fetch(ctx, t)
+	if err == nil {
+		err = a.Writer(t, cred)
+	}
+
+	now := time.Now()
+	next := now.Add(a.RetryInterval)
+
+	a.mu.Lock()
+	s := a.status[t.Name]
+	if err != nil {
+		s.LastError = err.Error()
+	} else {
+		s.LastError = ""
+		s.Expiration = cred.Expiration
+		s.LastRefresh = &now
+		s.Refreshes++
+		if cred.Expiration != nil {
+			next = cred.Expiration.Add(-a.RefreshMargin)
+		}
+	}
+	// Don't refresh more often than retries (e.g. credentials shorter than the margin)
+	next = later(next, now.Add(a.RetryInterval))
+	s.NextRefresh = &next
+	status := *s
+	a.mu.Unlock()
+
+	if a.OnRefresh != nil {
+		a.OnRefresh(status)
+	}
+	return next
+}
+
+// waitLogin wait until the user can log in again, report false if the context was cancelled
+func (a *Agent) waitLogin(ctx context.Context, user string) bool {
+	a.mu.Lock()
+	slot := later(time.Now(), a.nextLogin[user])
+	a.nextLogin[user] = slot.Add(a.LoginInterval)
+	a.mu.Unlock()
+
+	return sleep(ctx, time.Until(slot))
+}
+
+// sleep wait for the duration, report false if the context was cancelled
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// later return the later of two times
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
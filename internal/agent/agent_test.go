@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+// fakeFetcher returns credentials valid for ttl and records fetch times per target
+type fakeFetcher struct {
+	ttl time.Duration
+	err error
+
+	mu    sync.Mutex
+	calls map[string][]time.Time
+}
+
+func (f *fakeFetcher) Fetch(_ context.Context, t Target) (aws.AwsSamlOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = map[string][]time.Time{}
+	}
+	now := time.Now()
+	f.calls[t.Name] = append(f.calls[t.Name], now)
+	if f.err != nil {
+		return aws.AwsSamlOutput{}, f.err
+	}
+	exp := now.Add(f.ttl)
+	return aws.AwsSamlOutput{AccessKeyID: "AKIA-" + t.Name, Expiration: &exp}, nil
+}
+
+func (f *fakeFetcher) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls[name])
+}
+
+// recordingWriter records written credentials per profile
+type recordingWriter struct {
+	mu      sync.Mutex
+	written map[string]int
+}
+
+func (w *recordingWriter) write(t Target, _ aws.AwsSamlOutput) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.written == nil {
+		w.written = map[string]int{}
+	}
+	w.written[t.Profile]++
+	return nil
+}
+
+func newTestAgent(targets []Target, f *fakeFetcher, w *recordingWriter) *Agent {
+	a := New(targets, f, w.write)
+	a.RefreshMargin = 100 * time.Millisecond
+	a.RetryInterval = 50 * time.Millisecond
+	a.LoginInterval = 0
+	return a
+}
+
+func runFor(t *testing.T, a *Agent, d time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	if err := a.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestAgentRefreshesBeforeExpiration(t *testing.T) {
+	f := &fakeFetcher{ttl: 200 * time.Millisecond}
+	w := &recordingWriter{}
+	a := newTestAgent([]Target{{Name: "prod", Profile: "prod", User: "user"}}, f, w)
+
+	// Refresh at 0, ~100ms, ~200ms, ~300ms
+	runFor(t, a, 350*time.Millisecond)
+
+	if got := f.count("prod"); got < 3 || got > 5 {
+		t.Errorf("want 3-5 refreshes, got %d", got)
+	}
+	if w.written["prod"] != f.count("prod") {
+		t.Errorf("every refresh should be written: fetched %d, written %d", f.count("prod"), w.written["prod"])
+	}
+
+	status := a.Status()
+	if len(status) != 1 || status[0].Expiration == nil || status[0].NextRefresh == nil || status[0].LastError != "" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestAgentRetriesOnError(t *testing.T) {
+	f := &fakeFetcher{err: errors.New("auth failed")}
+	w := &recordingWriter{}
+	a := newTestAgent([]Target{{Name: "prod", Profile: "prod", User: "user"}}, f, w)
+
+	runFor(t, a, 130*time.Millisecond)
+
+	if got := f.count("prod"); got < 2 {
+		t.Errorf("failed refresh should be retried, got %d attempts", got)
+	}
+	if len(w.written) != 0 {
+		t.Errorf("failed refresh should not be written: %v", w.written)
+	}
+	if status := a.Status(); status[0].LastError != "auth failed" {
+		t.Errorf("LastError: got %q", status[0].LastError)
+	}
+}
+
+func TestAgentSpacesLoginsOfSameUser(t *testing.T) {
+	f := &fakeFetcher{ttl: time.Hour}
+	w := &recordingWriter{}
+	targets := []Target{
+		{Name: "prod", Profile: "prod", User: "alice"},
+		{Name: "stage", Profile: "stage", User: "alice"},
+		{Name: "dev", Profile: "dev", User: "bob"},
+	}
+	a := newTestAgent(targets, f, w)
+	a.LoginInterval = 150 * time.Millisecond
+
+	runFor(t, a, 250*time.Millisecond)
+
+	prod, stage := f.calls["prod"], f.calls["stage"]
+	if len(prod) != 1 || len(stage) != 1 || f.count("dev") != 1 {
+		t.Fatalf("want one login per target, got %v", f.calls)
+	}
+	gap := stage[0].Sub(prod[0]).Abs()
+	if gap < 140*time.Millisecond {
+		t.Errorf("logins of the same user should be spaced by the login interval, got %v", gap)
+	}
+	first := prod[0]
+	if stage[0].Before(first) {
+		first = stage[0]
+	}
+	if wait := f.calls["dev"][0].Sub(first); wait > 100*time.Millisecond {
+		t.Errorf("logins of different users should not wait, got %v", wait)
+	}
+}
+
+func TestAgentRunWithoutTargets(t *testing.T) {
+	a := New(nil, &fakeFetcher{}, (&recordingWriter{}).write)
+	if err := a.Run(context.Background()); err == nil {
+		t.Error("Run() expected error without targets")
+	}
+}
+
+func TestAgentStatusSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), SocketName)
+	f := &fakeFetcher{ttl: time.Hour}
+	a := newTestAgent([]Target{{Name: "prod", Profile: "prod", User: "user"}}, f, &recordingWriter{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- a.Serve(ctx, l) }()
+	go func() { _ = a.Run(ctx) }()
+
+	// Wait for the first refresh
+	deadline := time.Now().Add(time.Second)
+	for f.count("prod") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := Listen(socketPath); err == nil {
+		t.Error("Listen() should fail while the agent is running")
+	}
+
+	status, err := GetStatus(ctx, socketPath)
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if len(status) != 1 || status[0].Target != "prod" || status[0].Profile != "prod" {
+		t.Errorf("GetStatus() got = %+v", status)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+
+	if _, err := GetStatus(context.Background(), filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Error("GetStatus() expected error without agent")
+	}
+}
@@ -1,16 +1,20 @@
 package aws
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/aws-sdk-go-v2/service/sts/types"
-	"gopkg.in/ini.v1"
+
+	"github.com/yousysadmin/jc2aws/internal/inifile"
 )
 
 // RegionsList Available AWS Regions
@@ -30,6 +34,37 @@ type AwsSamlOutput struct {
 	SessionToken    string
 	Region          string
 	Expiration      *time.Time
+	// RoleArn and PrincipalArn of the assumed role, the last role of the chain for chained roles
+	RoleArn      string
+	PrincipalArn string
+}
+
+// CredentialProcessVersion version of the credential_process output format
+const CredentialProcessVersion = 1
+
+// credentialProcessOutput JSON document expected by AWS SDKs from a credential_process
+type credentialProcessOutput struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+// JSONVersion version of the json output format, changed only on incompatible changes
+const JSONVersion = 1
+
+// jsonOutput JSON document of the json output format
+type jsonOutput struct {
+	Version         int        `json:"version"`
+	Account         string     `json:"account"`
+	RoleArn         string     `json:"role_arn"`
+	PrincipalArn    string     `json:"principal_arn"`
+	Region          string     `json:"region"`
+	Expiration      *time.Time `json:"expiration"`
+	AccessKeyID     string     `json:"access_key_id"`
+	SecretAccessKey string     `json:"secret_access_key,omitempty"`
+	SessionToken    string     `json:"session_token,omitempty"`
 }
 
 // AwsSamlInput struct for input parameters for next used with the official AWS lib
@@ -65,31 +100,148 @@ func ToAwsSamlOutput(credentials *types.Credentials, region string) AwsSamlOutpu
 	}
 }
 
+// STSEndpoint overrides the STS endpoint URL (e.g. a VPC endpoint or a stub STS in tests)
+var STSEndpoint string
+
+// DefaultRoleSessionName session name of chained roles without a configured one
+const DefaultRoleSessionName = "jc2aws"
+
+// AssumeRoleInput parameters of a role chaining hop
+type AssumeRoleInput struct {
+	RoleArn         string
+	ExternalID      string
+	SessionName     string
+	SourceIdentity  string
+	DurationSeconds int32
+}
+
+// newSTSClient init STS client for the region with the given credentials
+func newSTSClient(region string, provider aws.CredentialsProvider) *sts.Client {
+	cfg := aws.Config{
+		Credentials: provider,
+		Region:      region,
+	}
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if STSEndpoint != "" {
+			o.BaseEndpoint = aws.String(STSEndpoint)
+		}
+	})
+}
+
 // GetCredentials get credentials via assume role with SAML
 func GetCredentials(input AwsSamlInput) (AwsSamlOutput, error) {
 
 	awsInput, region := input.ToAwsInput()
 
 	ctx := context.TODO()
-	cfg := aws.Config{ // just stub for the sdk config
-		Credentials: credentials.NewStaticCredentialsProvider(
-			"AKIAEXAMPLE",
-			"SECRETEXAMPLE",
-			"",
-		),
-	}
-	cfg.Region = region
-
-	client := sts.NewFromConfig(cfg)
+	// AssumeRoleWithSAML is not signed, static credentials are just a stub for the sdk config
+	client := newSTSClient(region, credentials.NewStaticCredentialsProvider(
+		"AKIAEXAMPLE",
+		"SECRETEXAMPLE",
+		"",
+	))
 
 	res, err := client.AssumeRoleWithSAML(ctx, &awsInput)
 	if err != nil {
 		return AwsSamlOutput{}, fmt.Errorf("failed to assume role with SAML: %w", err)
 	}
 
-	return ToAwsSamlOutput(res.Credentials, region), nil
+	cred := ToAwsSamlOutput(res.Credentials, region)
+	cred.RoleArn, cred.PrincipalArn = input.RoleArn, input.PrincipalArn
+
+	return cred, nil
+}
+
+// AssumeRoleChain assume roles of the chain one by one, starting with the credentials,
+// and return credentials of the last role
+func AssumeRoleChain(cred AwsSamlOutput, chain []AssumeRoleInput) (AwsSamlOutput, error) {
+	ctx := context.TODO()
+
+	for _, hop := range chain {
+		client := newSTSClient(cred.Region, credentials.NewStaticCredentialsProvider(
+			cred.AccessKeyID,
+			cred.SecretAccessKey,
+			cred.SessionToken,
+		))
+
+		res, err := client.AssumeRole(ctx, hop.toAwsInput())
+		if err != nil {
+			return AwsSamlOutput{}, fmt.Errorf("failed to assume role %s: %w", hop.RoleArn, err)
+		}
+		principalArn := cred.PrincipalArn
+		cred = ToAwsSamlOutput(res.Credentials, cred.Region)
+		cred.RoleArn, cred.PrincipalArn = hop.RoleArn, principalArn
+	}
+
+	return cred, nil
+}
+
+// CallerIdentity identity of credentials returned by sts:GetCallerIdentity
+type CallerIdentity struct {
+	Account string `json:"account"`
+	Arn     string `json:"arn"`
+	UserID  string `json:"user_id"`
+	// SessionName session name of an assumed role
+	SessionName string `json:"session_name,omitempty"`
+}
+
+// GetCallerIdentity check the credentials with sts:GetCallerIdentity and return their identity
+func GetCallerIdentity(ctx context.Context, cred AwsSamlOutput) (CallerIdentity, error) {
+	region := cred.Region
+	if region == "" {
+		region = RegionsList[0]
+	}
+	client := newSTSClient(region, credentials.NewStaticCredentialsProvider(
+		cred.AccessKeyID,
+		cred.SecretAccessKey,
+		cred.SessionToken,
+	))
+
+	res, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return CallerIdentity{}, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	identity := CallerIdentity{
+		Account: aws.ToString(res.Account),
+		Arn:     aws.ToString(res.Arn),
+		UserID:  aws.ToString(res.UserId),
+	}
+	// arn:aws:sts::111111111111:assumed-role/role-name/session-name
+	if _, resource, ok := strings.Cut(identity.Arn, ":assumed-role/"); ok {
+		if i := strings.LastIndex(resource, "/"); i >= 0 {
+			identity.SessionName = resource[i+1:]
+		}
+	}
+	return identity, nil
+}
+
+// toAwsInput converter from standard types to official AWS lib types
+func (i AssumeRoleInput) toAwsInput() *sts.AssumeRoleInput {
+	in := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(i.RoleArn),
+		RoleSessionName: aws.String(i.SessionName),
+	}
+	if i.SessionName == "" {
+		in.RoleSessionName = aws.String(DefaultRoleSessionName)
+	}
+	if i.ExternalID != "" {
+		in.ExternalId = aws.String(i.ExternalID)
+	}
+	if i.SourceIdentity != "" {
+		in.SourceIdentity = aws.String(i.SourceIdentity)
+	}
+	if i.DurationSeconds != 0 {
+		in.DurationSeconds = aws.Int32(i.DurationSeconds)
+	}
+	return in
 }
 
+// EnvCredentialExpiration environment variable with the expiration of the credentials, known by AWS SDKs
+const EnvCredentialExpiration = "AWS_CREDENTIAL_EXPIRATION"
+
+// EnvVarNames names of the environment variables set by ToEnv
+var EnvVarNames = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION", EnvCredentialExpiration}
+
 // ToEnv output AWS credentials as Environment variables
 func (o *AwsSamlOutput) ToEnv() []string {
 	var env []string
@@ -99,60 +251,149 @@ func (o *AwsSamlOutput) ToEnv() []string {
 	env = append(env, fmt.Sprintf("AWS_SESSION_TOKEN=%s", o.SessionToken))
 	env = append(env, fmt.Sprintf("AWS_REGION=%s", o.Region))
 	env = append(env, fmt.Sprintf("AWS_DEFAULT_REGION=%s", o.Region))
+	if o.Expiration != nil {
+		env = append(env, fmt.Sprintf("%s=%s", EnvCredentialExpiration, FormatExpiration(*o.Expiration)))
+	}
 
 	return env
 }
 
 // PrintEnv prepare environment variables output as text
 func (o *AwsSamlOutput) PrintEnv() string {
-	env := fmt.Sprintf(`AWS_ACCESS_KEY_ID=%s
-AWS_SECRET_ACCESS_KEY=%s
-AWS_SESSION_TOKEN=%s
-AWS_REGION=%s
-AWS_DEFAULT_REGION=%s
-`, o.AccessKeyID, o.SecretAccessKey, o.SessionToken, o.Region, o.Region)
+	return strings.Join(o.ToEnv(), "\n") + "\n"
+}
 
-	return env
+// AwsProfile credentials of a named AWS CLI profile
+type AwsProfile struct {
+	Name        string
+	Credentials AwsSamlOutput
+	// Config other keys of the profile in the AWS config file, "parent.key" sets a nested setting
+	Config map[string]string
 }
 
 // ToAwsCredentials output as AWS profile
 // If an input file exists, loading existing profiles and rewriting exist profile or adding a new
 func (o *AwsSamlOutput) ToAwsCredentials(profileName string, inputIniFile string) ([]byte, error) {
-	var buf bytes.Buffer
+	return ProfilesToAwsCredentials([]AwsProfile{{Name: profileName, Credentials: *o}}, inputIniFile)
+}
+
+// ToAwsConfig output as AWS profile
+// If an input file exists, loading existing profiles and rewriting exist profile or adding a new
+func (o *AwsSamlOutput) ToAwsConfig(profileName string, inputIniFile string) ([]byte, error) {
+	return ProfilesToAwsConfig([]AwsProfile{{Name: profileName, Credentials: *o}}, inputIniFile)
+}
 
-	profile, err := ini.LooseLoad(inputIniFile)
+// ProfilesToAwsCredentials output several AWS profiles at once
+// If an input file exists, loading existing profiles and rewriting exist profiles or adding new
+func ProfilesToAwsCredentials(profiles []AwsProfile, inputIniFile string) ([]byte, error) {
+	file, err := inifile.Load(inputIniFile)
 	if err != nil {
 		return nil, err
 	}
 
-	section, _ := profile.NewSection(profileName)
-	section.Key("aws_access_key_id").SetValue(o.AccessKeyID)
-	section.Key("aws_secret_access_key").SetValue(o.SecretAccessKey)
-	section.Key("aws_session_token").SetValue(o.SessionToken)
-	section.Key("expiration").SetValue(o.Expiration.String())
+	for _, p := range profiles {
+		keys := []inifile.KeyValue{
+			{Key: "aws_access_key_id", Value: p.Credentials.AccessKeyID},
+			{Key: "aws_secret_access_key", Value: p.Credentials.SecretAccessKey},
+			{Key: "aws_session_token", Value: p.Credentials.SessionToken},
+		}
+		if p.Credentials.Expiration != nil {
+			keys = append(keys, inifile.KeyValue{Key: ExpirationKey, Value: FormatExpiration(*p.Credentials.Expiration)})
+		}
+		if p.Credentials.RoleArn != "" {
+			keys = append(keys, inifile.KeyValue{Key: RoleArnKey, Value: p.Credentials.RoleArn})
+		}
+		file.SetKeys(p.Name, keys)
+	}
 
-	_, err = profile.WriteTo(&buf)
+	return file.Bytes(), nil
+}
 
-	return buf.Bytes(), err
+// ProfilesToAwsConfig output regions and settings of several AWS profiles at once
+// If an input file exists, loading existing profiles and rewriting exist profiles or adding new
+func ProfilesToAwsConfig(profiles []AwsProfile, inputIniFile string) ([]byte, error) {
+	keys := make(map[string]map[string]string, len(profiles))
+	for _, p := range profiles {
+		settings := map[string]string{}
+		maps.Copy(settings, p.Config)
+		settings["region"] = p.Credentials.Region
+		keys[p.Name] = settings
+	}
+	return updateAwsConfigProfiles(inputIniFile, keys)
 }
 
-// ToAwsConfig output as AWS profile
-// If an input file exists, loading existing profiles and rewriting exist profile or adding a new
-func (o *AwsSamlOutput) ToAwsConfig(profileName string, inputIniFile string) ([]byte, error) {
-	var buf bytes.Buffer
+// ToCredentialProcess output as JSON document for the credential_process AWS config setting
+func (o *AwsSamlOutput) ToCredentialProcess() ([]byte, error) {
+	out := credentialProcessOutput{
+		Version:         CredentialProcessVersion,
+		AccessKeyID:     o.AccessKeyID,
+		SecretAccessKey: o.SecretAccessKey,
+		SessionToken:    o.SessionToken,
+	}
+	if o.Expiration != nil {
+		out.Expiration = o.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
 
-	if profileName != DefaultAwsProfileName {
-		profileName = "profile " + profileName
+// ToJSON output as JSON document of the json output format
+// Secret access key and session token are left out if omitSecrets is set
+func (o *AwsSamlOutput) ToJSON(account string, omitSecrets bool) ([]byte, error) {
+	out := jsonOutput{
+		Version:      JSONVersion,
+		Account:      account,
+		RoleArn:      o.RoleArn,
+		PrincipalArn: o.PrincipalArn,
+		Region:       o.Region,
+		AccessKeyID:  o.AccessKeyID,
+	}
+	if o.Expiration != nil {
+		exp := o.Expiration.UTC()
+		out.Expiration = &exp
+	}
+	if !omitSecrets {
+		out.SecretAccessKey = o.SecretAccessKey
+		out.SessionToken = o.SessionToken
 	}
 
-	profile, err := ini.LooseLoad(inputIniFile)
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// ToAwsConfigCredentialProcess output as AWS profile which obtains credentials by running the command
+// If an input file exists, loading existing profiles and rewriting exist profile or adding a new
+func ToAwsConfigCredentialProcess(profileName, region, command string, inputIniFile string) ([]byte, error) {
+	keys := map[string]string{
+		"credential_process": command,
+	}
+	if region != "" {
+		keys["region"] = region
+	}
+	return updateAwsConfig(profileName, inputIniFile, keys)
+}
+
+// updateAwsConfig set keys of the profile section in AWS config file
+func updateAwsConfig(profileName string, inputIniFile string, keys map[string]string) ([]byte, error) {
+	return updateAwsConfigProfiles(inputIniFile, map[string]map[string]string{profileName: keys})
+}
+
+// updateAwsConfigProfiles set keys of several profile sections in AWS config file
+func updateAwsConfigProfiles(inputIniFile string, profiles map[string]map[string]string) ([]byte, error) {
+	file, err := inifile.Load(inputIniFile)
 	if err != nil {
 		return nil, err
 	}
-	section, _ := profile.NewSection(profileName)
-	section.Key("region").SetValue(o.Region)
-
-	_, err = profile.WriteTo(&buf)
+	for _, profileName := range slices.Sorted(maps.Keys(profiles)) {
+		keys := profiles[profileName]
+		if profileName != DefaultAwsProfileName {
+			profileName = "profile " + profileName
+		}
+		var kvs []inifile.KeyValue
+		for _, k := range slices.Sorted(maps.Keys(keys)) {
+			kvs = append(kvs, inifile.KeyValue{Key: k, Value: keys[k]})
+		}
+		file.SetKeys(profileName, kvs)
+	}
 
-	return buf.Bytes(), err
+	return file.Bytes(), nil
 }
@@ -1,7 +1,15 @@
 package aws
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -90,6 +98,20 @@ func TestAwsSamlOutput_ToEnv(t *testing.T) {
 				"AWS_REGION=TEST_REGION",
 				"AWS_DEFAULT_REGION=TEST_REGION",
 			}},
+		{name: "expiration", fields: fields{
+			AccessKeyID:     "TEST_ACCESS_ID",
+			SecretAccessKey: "TEST_SECRET_ACCESS_KEY",
+			SessionToken:    "TEST_SESSION_TOKEN",
+			Region:          "TEST_REGION",
+			Expiration:      aws.Time(time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*3600))),
+		},
+			want: []string{"AWS_ACCESS_KEY_ID=TEST_ACCESS_ID",
+				"AWS_SECRET_ACCESS_KEY=TEST_SECRET_ACCESS_KEY",
+				"AWS_SESSION_TOKEN=TEST_SESSION_TOKEN",
+				"AWS_REGION=TEST_REGION",
+				"AWS_DEFAULT_REGION=TEST_REGION",
+				"AWS_CREDENTIAL_EXPIRATION=2026-01-02T08:04:05Z",
+			}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -104,6 +126,12 @@ func TestAwsSamlOutput_ToEnv(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ToEnv() got = %v, want %v", got, tt.want)
 			}
+			// EnvVarNames must list every variable set by ToEnv
+			for i, kv := range got {
+				if name, _, _ := strings.Cut(kv, "="); i >= len(EnvVarNames) || EnvVarNames[i] != name {
+					t.Errorf("EnvVarNames = %v, doesn't match ToEnv() variable %s", EnvVarNames, name)
+				}
+			}
 		})
 	}
 }
@@ -190,7 +218,7 @@ aws_access_key_id     = TEST_ACCESS_KEY_ID
 aws_secret_access_key = TEST_SECRET_ACCESS_KEY
 aws_session_token     = TEST_SESSION_TOKEN
 expiration            = %s
-`, timeNow)},
+`, timeNow.UTC().Format(time.RFC3339))},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -326,6 +354,47 @@ func TestAwsSamlOutputToAwsCredentialsWithExistingFile(t *testing.T) {
 	}
 }
 
+func TestProfilesToAwsCredentials(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(existing, []byte("[keep]\naws_access_key_id = old-key\n\n[prod]\naws_access_key_id = old-prod\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles := []AwsProfile{
+		{Name: "prod", Credentials: AwsSamlOutput{AccessKeyID: "prod-key", Region: "us-east-1", Expiration: &time.Time{}}},
+		{Name: "stage", Credentials: AwsSamlOutput{AccessKeyID: "stage-key", Region: "eu-west-1", Expiration: &time.Time{}}},
+	}
+
+	result, err := ProfilesToAwsCredentials(profiles, existing)
+	if err != nil {
+		t.Fatalf("ProfilesToAwsCredentials() error = %v", err)
+	}
+	creds, err := ini.Load(result)
+	if err != nil {
+		t.Fatalf("Failed to parse generated INI: %v", err)
+	}
+	for section, want := range map[string]string{"keep": "old-key", "prod": "prod-key", "stage": "stage-key"} {
+		if got := creds.Section(section).Key("aws_access_key_id").String(); got != want {
+			t.Errorf("[%s] aws_access_key_id = %q, want %q", section, got, want)
+		}
+	}
+
+	result, err = ProfilesToAwsConfig(profiles, "")
+	if err != nil {
+		t.Fatalf("ProfilesToAwsConfig() error = %v", err)
+	}
+	cfg, err := ini.Load(result)
+	if err != nil {
+		t.Fatalf("Failed to parse generated INI: %v", err)
+	}
+	if got := cfg.Section("profile prod").Key("region").String(); got != "us-east-1" {
+		t.Errorf("[profile prod] region = %q, want us-east-1", got)
+	}
+	if got := cfg.Section("profile stage").Key("region").String(); got != "eu-west-1" {
+		t.Errorf("[profile stage] region = %q, want eu-west-1", got)
+	}
+}
+
 func TestRegionsList(t *testing.T) {
 	expectedRegions := []string{"us-east-1", "us-east-2", "us-west-1", "us-west-2", "af-south-1", "ap-east-1",
 		"ap-south-2", "ap-southeast-3", "ap-southeast-4", "ap-south-1", "ap-northeast-3", "ap-northeast-2",
@@ -366,3 +435,335 @@ func TestGetCredentialsErrorHandling(t *testing.T) {
 		t.Error("Expected error for invalid input, got nil")
 	}
 }
+
+func TestAwsSamlOutputToCredentialProcess(t *testing.T) {
+	exp := time.Date(2026, 1, 15, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+
+	tests := []struct {
+		name   string
+		output AwsSamlOutput
+		want   map[string]any
+	}{
+		{
+			name: "with expiration",
+			output: AwsSamlOutput{
+				AccessKeyID:     "TEST_ACCESS_KEY_ID",
+				SecretAccessKey: "TEST_SECRET_ACCESS_KEY",
+				SessionToken:    "TEST_SESSION_TOKEN",
+				Region:          "us-east-1",
+				Expiration:      &exp,
+			},
+			want: map[string]any{
+				"Version":         float64(1),
+				"AccessKeyId":     "TEST_ACCESS_KEY_ID",
+				"SecretAccessKey": "TEST_SECRET_ACCESS_KEY",
+				"SessionToken":    "TEST_SESSION_TOKEN",
+				"Expiration":      "2026-01-15T17:00:00Z",
+			},
+		},
+		{
+			name: "without expiration",
+			output: AwsSamlOutput{
+				AccessKeyID:     "TEST_ACCESS_KEY_ID",
+				SecretAccessKey: "TEST_SECRET_ACCESS_KEY",
+				SessionToken:    "TEST_SESSION_TOKEN",
+			},
+			want: map[string]any{
+				"Version":         float64(1),
+				"AccessKeyId":     "TEST_ACCESS_KEY_ID",
+				"SecretAccessKey": "TEST_SECRET_ACCESS_KEY",
+				"SessionToken":    "TEST_SESSION_TOKEN",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.output.ToCredentialProcess()
+			if err != nil {
+				t.Fatalf("ToCredentialProcess() error = %v", err)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("ToCredentialProcess() returned invalid JSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToCredentialProcess() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAwsSamlOutputToJSON(t *testing.T) {
+	exp := time.Date(2026, 1, 15, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	output := AwsSamlOutput{
+		AccessKeyID:     "TEST_ACCESS_KEY_ID",
+		SecretAccessKey: "TEST_SECRET_ACCESS_KEY",
+		SessionToken:    "TEST_SESSION_TOKEN",
+		Region:          "us-east-1",
+		Expiration:      &exp,
+		RoleArn:         "arn:aws:iam::000000000000:role/admin",
+		PrincipalArn:    "arn:aws:iam::000000000000:saml-provider/jumpcloud",
+	}
+	full := map[string]any{
+		"version":           float64(1),
+		"account":           "prod",
+		"role_arn":          "arn:aws:iam::000000000000:role/admin",
+		"principal_arn":     "arn:aws:iam::000000000000:saml-provider/jumpcloud",
+		"region":            "us-east-1",
+		"expiration":        "2026-01-15T17:00:00Z",
+		"access_key_id":     "TEST_ACCESS_KEY_ID",
+		"secret_access_key": "TEST_SECRET_ACCESS_KEY",
+		"session_token":     "TEST_SESSION_TOKEN",
+	}
+	withoutSecrets := maps.Clone(full)
+	delete(withoutSecrets, "secret_access_key")
+	delete(withoutSecrets, "session_token")
+
+	tests := []struct {
+		name        string
+		output      AwsSamlOutput
+		omitSecrets bool
+		want        map[string]any
+	}{
+		{name: "with secrets", output: output, want: full},
+		{name: "without secrets", output: output, omitSecrets: true, want: withoutSecrets},
+		{
+			name:   "without expiration",
+			output: AwsSamlOutput{AccessKeyID: "TEST_ACCESS_KEY_ID"},
+			want: map[string]any{
+				"version": float64(1), "account": "prod", "role_arn": "", "principal_arn": "", "region": "",
+				"expiration": nil, "access_key_id": "TEST_ACCESS_KEY_ID",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.output.ToJSON("prod", tt.omitSecrets)
+			if err != nil {
+				t.Fatalf("ToJSON() error = %v", err)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("ToJSON() returned invalid JSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToJSON() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToAwsConfigCredentialProcess(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(existing, []byte("[profile other]\nregion = eu-west-1\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	result, err := ToAwsConfigCredentialProcess("prod", "us-east-1", "jc2aws --account prod -f credential-process", existing)
+	if err != nil {
+		t.Fatalf("ToAwsConfigCredentialProcess() error = %v", err)
+	}
+
+	cfg, err := ini.Load(result)
+	if err != nil {
+		t.Fatalf("Failed to parse generated INI: %v", err)
+	}
+
+	section := cfg.Section("profile prod")
+	if got := section.Key("credential_process").String(); got != "jc2aws --account prod -f credential-process" {
+		t.Errorf("credential_process: got %q", got)
+	}
+	if got := section.Key("region").String(); got != "us-east-1" {
+		t.Errorf("region: got %q", got)
+	}
+	if got := cfg.Section("profile other").Key("region").String(); got != "eu-west-1" {
+		t.Errorf("existing profile should be kept, got region %q", got)
+	}
+}
+
+// stubSTS serves AssumeRole requests, recording their forms and the access key used to sign them.
+// Issued access keys are "AKIA" + the index of the call.
+func stubSTS(t *testing.T, calls *[]url.Values, signedWith *[]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		if r.Form.Get("Action") != "AssumeRole" {
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		*calls = append(*calls, r.Form)
+		// Credential=AKIA.../date/region/sts/aws4_request
+		_, cred, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+		key, _, _ := strings.Cut(cred, "/")
+		*signedWith = append(*signedWith, key)
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>AKIA%d</AccessKeyId>
+      <SecretAccessKey>SECRET%d</SecretAccessKey>
+      <SessionToken>TOKEN%d</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`, len(*calls), len(*calls), len(*calls))
+	}))
+	t.Cleanup(srv.Close)
+
+	STSEndpoint = srv.URL
+	t.Cleanup(func() { STSEndpoint = "" })
+	return srv
+}
+
+func TestAssumeRoleChain(t *testing.T) {
+	var calls []url.Values
+	var signedWith []string
+	stubSTS(t, &calls, &signedWith)
+
+	saml := AwsSamlOutput{AccessKeyID: "AKIASAML", SecretAccessKey: "SECRETSAML", SessionToken: "TOKENSAML", Region: "us-east-1",
+		RoleArn: "arn:aws:iam::111:role/saml", PrincipalArn: "arn:aws:iam::111:saml-provider/jumpcloud"}
+	chain := []AssumeRoleInput{
+		{RoleArn: "arn:aws:iam::222:role/hub", DurationSeconds: 900},
+		{RoleArn: "arn:aws:iam::333:role/target", ExternalID: "ext", SessionName: "alice", SourceIdentity: "alice@example.com"},
+	}
+
+	got, err := AssumeRoleChain(saml, chain)
+	if err != nil {
+		t.Fatalf("AssumeRoleChain() error = %v", err)
+	}
+	if got.AccessKeyID != "AKIA2" || got.SecretAccessKey != "SECRET2" || got.SessionToken != "TOKEN2" || got.Region != "us-east-1" {
+		t.Errorf("AssumeRoleChain() got = %+v, want credentials of the last role", got)
+	}
+	if got.Expiration == nil || got.Expiration.Year() != 2030 {
+		t.Errorf("AssumeRoleChain() got expiration %v", got.Expiration)
+	}
+	if got.RoleArn != "arn:aws:iam::333:role/target" || got.PrincipalArn != saml.PrincipalArn {
+		t.Errorf("AssumeRoleChain() got role %q, principal %q, want the last role and the SAML principal", got.RoleArn, got.PrincipalArn)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("want 2 AssumeRole calls, got %d", len(calls))
+	}
+	// Every hop is signed with credentials of the previous one
+	if want := []string{"AKIASAML", "AKIA1"}; signedWith[0] != want[0] || signedWith[1] != want[1] {
+		t.Errorf("signed with %v, want %v", signedWith, want)
+	}
+
+	tests := []struct {
+		call  int
+		param string
+		want  string
+	}{
+		{0, "RoleArn", "arn:aws:iam::222:role/hub"},
+		{0, "RoleSessionName", DefaultRoleSessionName},
+		{0, "DurationSeconds", "900"},
+		{0, "ExternalId", ""},
+		{1, "RoleArn", "arn:aws:iam::333:role/target"},
+		{1, "RoleSessionName", "alice"},
+		{1, "ExternalId", "ext"},
+		{1, "SourceIdentity", "alice@example.com"},
+		{1, "DurationSeconds", ""},
+	}
+	for _, tt := range tests {
+		if got := calls[tt.call].Get(tt.param); got != tt.want {
+			t.Errorf("call %d %s got = %q, want %q", tt.call, tt.param, got, tt.want)
+		}
+	}
+}
+
+func TestAssumeRoleChainError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not allowed</Message></Error></ErrorResponse>`)
+	}))
+	defer srv.Close()
+	STSEndpoint = srv.URL
+	defer func() { STSEndpoint = "" }()
+
+	saml := AwsSamlOutput{AccessKeyID: "AKIASAML", SecretAccessKey: "SECRETSAML", Region: "us-east-1"}
+	_, err := AssumeRoleChain(saml, []AssumeRoleInput{{RoleArn: "arn:aws:iam::222:role/hub"}})
+	if err == nil || !strings.Contains(err.Error(), "arn:aws:iam::222:role/hub") {
+		t.Errorf("AssumeRoleChain() error = %v, want error naming the role", err)
+	}
+}
+
+func TestProfilesToAwsConfigSettings(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(existing, []byte("# my settings\n[profile prod]\noutput = text\ns3 =\n  max_concurrent_requests = 10\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles := []AwsProfile{{
+		Name:        "prod",
+		Credentials: AwsSamlOutput{Region: "us-east-1", Expiration: &time.Time{}},
+		Config: map[string]string{
+			"output":              "json",
+			"s3.addressing_style": "path",
+			"region":              "eu-west-1",
+		},
+	}}
+	result, err := ProfilesToAwsConfig(profiles, existing)
+	if err != nil {
+		t.Fatalf("ProfilesToAwsConfig() error = %v", err)
+	}
+
+	// The region of the credentials wins over the region from the settings
+	want := "# my settings\n[profile prod]\noutput = json\ns3 =\n  max_concurrent_requests = 10\n  addressing_style = path\nregion = us-east-1\n"
+	if got := string(result); got != want {
+		t.Errorf("ProfilesToAwsConfig() got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// stubCallerIdentity fake AWS STS answering GetCallerIdentity for the access key AKIAVALID
+func stubCallerIdentity(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "GetCallerIdentity" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=AKIAVALID/") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>ExpiredToken</Code><Message>The security token included in the request is expired</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:sts::111:assumed-role/admin/alice</Arn>
+    <UserId>AROAEXAMPLE:alice</UserId>
+    <Account>111</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+	}))
+	t.Cleanup(srv.Close)
+
+	STSEndpoint = srv.URL
+	t.Cleanup(func() { STSEndpoint = "" })
+}
+
+func TestGetCallerIdentity(t *testing.T) {
+	stubCallerIdentity(t)
+
+	got, err := GetCallerIdentity(context.Background(), AwsSamlOutput{AccessKeyID: "AKIAVALID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"})
+	if err != nil {
+		t.Fatalf("GetCallerIdentity() error = %v", err)
+	}
+	want := CallerIdentity{Account: "111", Arn: "arn:aws:sts::111:assumed-role/admin/alice", UserID: "AROAEXAMPLE:alice", SessionName: "alice"}
+	if got != want {
+		t.Errorf("GetCallerIdentity() got = %+v, want %+v", got, want)
+	}
+
+	if _, err := GetCallerIdentity(context.Background(), AwsSamlOutput{AccessKeyID: "AKIAEXPIRED", SecretAccessKey: "SECRET", Region: "eu-west-1"}); err == nil ||
+		!strings.Contains(err.Error(), "ExpiredToken") {
+		t.Errorf("GetCallerIdentity() with expired credentials error = %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/inifile"
+)
+
+const (
+	// ExpirationKey key of the credentials file with the expiration of the profile credentials
+	ExpirationKey = "expiration"
+
+	// RoleArnKey key of the credentials file with the role of the profile credentials
+	RoleArnKey = "jc2aws_role_arn"
+
+	// envFileRolePrefix comment of the env file with the role of the credentials
+	envFileRolePrefix = "# " + RoleArnKey + "="
+
+	// legacyExpirationLayout layout of time.Time.String(), written by previous versions
+	legacyExpirationLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+)
+
+// FormatExpiration format the expiration as RFC3339 in UTC
+func FormatExpiration(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ParseExpiration parse the expiration written by FormatExpiration or by previous versions with time.Time.String()
+func ParseExpiration(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	// Drop the monotonic clock reading, e.g. " m=+3599.998"
+	s, _, _ = strings.Cut(s, " m=")
+	t, err := time.Parse(legacyExpirationLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiration %q", s)
+	}
+	return t, nil
+}
+
+// ReadProfiles return profiles of the credentials file written by jc2aws (with a valid expiration),
+// the region and the jc2aws_account setting are read from the config file
+func ReadProfiles(credentialsFile, configFile string) ([]AwsProfile, error) {
+	creds, err := inifile.Load(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := inifile.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []AwsProfile
+	for _, name := range creds.Sections() {
+		value, ok := creds.Get(name, ExpirationKey)
+		if !ok {
+			continue
+		}
+		expiration, err := ParseExpiration(value)
+		if err != nil {
+			continue
+		}
+
+		p := AwsProfile{Name: name, Credentials: AwsSamlOutput{Expiration: &expiration}}
+		p.Credentials.AccessKeyID, _ = creds.Get(name, "aws_access_key_id")
+		p.Credentials.SecretAccessKey, _ = creds.Get(name, "aws_secret_access_key")
+		p.Credentials.SessionToken, _ = creds.Get(name, "aws_session_token")
+		p.Credentials.RoleArn, _ = creds.Get(name, RoleArnKey)
+
+		section := name
+		if name != DefaultAwsProfileName {
+			section = "profile " + name
+		}
+		p.Credentials.Region, _ = conf.Get(section, "region")
+		if account, ok := conf.Get(section, "jc2aws_account"); ok {
+			p.Config = map[string]string{"jc2aws_account": account}
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// ToEnvFile output as content of the env file: PrintEnv with the role as a comment
+func (o *AwsSamlOutput) ToEnvFile() string {
+	if o.RoleArn == "" {
+		return o.PrintEnv()
+	}
+	return envFileRolePrefix + o.RoleArn + "\n" + o.PrintEnv()
+}
+
+// ReadEnvFile return credentials of the env file written by ToEnvFile, false if the file doesn't exist
+func ReadEnvFile(path string) (AwsSamlOutput, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return AwsSamlOutput{}, false, nil
+	}
+	if err != nil {
+		return AwsSamlOutput{}, false, err
+	}
+
+	var cred AwsSamlOutput
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if role, ok := strings.CutPrefix(line, envFileRolePrefix); ok {
+			cred.RoleArn = role
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "AWS_ACCESS_KEY_ID":
+			cred.AccessKeyID = value
+		case "AWS_SECRET_ACCESS_KEY":
+			cred.SecretAccessKey = value
+		case "AWS_SESSION_TOKEN":
+			cred.SessionToken = value
+		case "AWS_REGION":
+			cred.Region = value
+		case EnvCredentialExpiration:
+			if t, err := ParseExpiration(value); err == nil {
+				cred.Expiration = &t
+			}
+		}
+	}
+	return cred, true, scanner.Err()
+}
@@ -0,0 +1,111 @@
+package aws
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseExpiration(t *testing.T) {
+	want := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "rfc3339", value: "2026-01-02T03:04:05Z"},
+		{name: "rfc3339 offset", value: "2026-01-01T22:04:05-05:00"},
+		{name: "legacy", value: "2026-01-02 03:04:05 +0000 UTC"},
+		{name: "legacy monotonic", value: "2026-01-02 03:04:05 +0000 UTC m=+3599.998"},
+		{name: "invalid", value: "<nil>", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExpiration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExpiration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(want) {
+				t.Errorf("ParseExpiration() got = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	credsFile := filepath.Join(dir, "credentials")
+	confFile := filepath.Join(dir, "config")
+
+	expiration := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	profiles := []AwsProfile{
+		{Name: "default", Credentials: AwsSamlOutput{AccessKeyID: "AKIA1", Region: "us-east-1", Expiration: &expiration, RoleArn: "arn:aws:iam::111:role/admin"}},
+		{Name: "stage", Credentials: AwsSamlOutput{AccessKeyID: "AKIA2", Region: "eu-west-1", Expiration: &expiration}, Config: map[string]string{"jc2aws_account": "my-stage"}},
+	}
+	creds, err := ProfilesToAwsCredentials(profiles, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Profiles without an expiration were not written by jc2aws
+	creds = append(creds, "\n[static]\naws_access_key_id = AKIASTATIC\n"...)
+	conf, err := ProfilesToAwsConfig(profiles, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(credsFile, creds, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(confFile, conf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadProfiles(credsFile, confFile)
+	if err != nil {
+		t.Fatalf("ReadProfiles() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ReadProfiles() got %d profiles, want 2", len(got))
+	}
+	if p := got[0]; p.Name != "default" || p.Credentials.AccessKeyID != "AKIA1" || p.Credentials.Region != "us-east-1" ||
+		p.Credentials.RoleArn != "arn:aws:iam::111:role/admin" || !p.Credentials.Expiration.Equal(expiration) {
+		t.Errorf("ReadProfiles() got default = %+v", p)
+	}
+	if p := got[1]; p.Name != "stage" || p.Credentials.Region != "eu-west-1" || p.Config["jc2aws_account"] != "my-stage" {
+		t.Errorf("ReadProfiles() got stage = %+v", p)
+	}
+
+	got, err = ReadProfiles(filepath.Join(dir, "missing"), filepath.Join(dir, "missing"))
+	if err != nil || len(got) != 0 {
+		t.Errorf("ReadProfiles() of missing files got = %v, %v", got, err)
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".jc2aws.env")
+	expiration := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cred := AwsSamlOutput{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Region:          "us-east-1",
+		Expiration:      &expiration,
+		RoleArn:         "arn:aws:iam::111:role/admin",
+	}
+	if err := os.WriteFile(path, []byte(cred.ToEnvFile()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := ReadEnvFile(path)
+	if err != nil || !ok {
+		t.Fatalf("ReadEnvFile() got = %v, %v", ok, err)
+	}
+	if got.AccessKeyID != "AKIA" || got.SecretAccessKey != "SECRET" || got.SessionToken != "TOKEN" ||
+		got.Region != "us-east-1" || got.RoleArn != cred.RoleArn || got.Expiration == nil || !got.Expiration.Equal(expiration) {
+		t.Errorf("ReadEnvFile() got = %+v", got)
+	}
+
+	if _, ok, err := ReadEnvFile(path + ".missing"); ok || err != nil {
+		t.Errorf("ReadEnvFile() of a missing file got = %v, %v", ok, err)
+	}
+}
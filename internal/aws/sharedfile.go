@@ -0,0 +1,91 @@
+package aws
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/yousysadmin/jc2aws/internal/filelock"
+	"github.com/yousysadmin/jc2aws/internal/utils"
+)
+
+const (
+	// SharedFileBackupSuffix suffix of the copy of the previous shared file
+	SharedFileBackupSuffix = ".bak"
+
+	// SharedFileLockSuffix suffix of the lock file of a shared file
+	SharedFileLockSuffix = ".lock"
+
+	// EnvSharedCredentialsFile and EnvConfigFile override paths of the shared files, as in the AWS CLI
+	EnvSharedCredentialsFile = "AWS_SHARED_CREDENTIALS_FILE"
+	EnvConfigFile            = "AWS_CONFIG_FILE"
+)
+
+// SharedCredentialsFile return path of the AWS credentials file,
+// $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+func SharedCredentialsFile() (string, error) {
+	return sharedFilePath(EnvSharedCredentialsFile, "credentials")
+}
+
+// SharedConfigFile return path of the AWS config file, $AWS_CONFIG_FILE or ~/.aws/config
+func SharedConfigFile() (string, error) {
+	return sharedFilePath(EnvConfigFile, "config")
+}
+
+// sharedFilePath return the path from the environment variable (~ and environment
+// variables are expanded, like the AWS CLI does) or the file in ~/.aws
+func sharedFilePath(envVar, name string) (string, error) {
+	if path := os.Getenv(envVar); path != "" {
+		return utils.ExpandPath(path)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".aws", name), nil
+}
+
+// UpdateSharedFile replace an AWS shared file (credentials or config) with the content returned by render.
+// The file is locked for the whole update and render is called under the lock, so concurrent jc2aws
+// processes don't lose each other's profiles. The previous file is kept as a backup, the new one
+// is written to a temporary file and renamed, so readers never see a partially written file.
+func UpdateSharedFile(path string, render func() ([]byte, error)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+	}
+
+	lock, err := filelock.Acquire(path + SharedFileLockSuffix)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	data, err := render()
+	if err != nil {
+		return err
+	}
+
+	// New files are private, existing files keep their permissions
+	mode := fs.FileMode(0600)
+	previous, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if bytes.Equal(previous, data) {
+			return nil
+		}
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := utils.WriteFileAtomic(path+SharedFileBackupSuffix, previous, 0600); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, data, mode)
+}
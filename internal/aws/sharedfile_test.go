@@ -0,0 +1,151 @@
+package aws
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestUpdateSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".aws", "credentials")
+	existing := "# my profiles\n[keep]\naws_access_key_id = KEEP\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(existing), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := AwsSamlOutput{AccessKeyID: "NEW", Expiration: &time.Time{}}
+	render := func() ([]byte, error) { return cred.ToAwsCredentials("new", path) }
+	if err := UpdateSharedFile(path, render); err != nil {
+		t.Fatalf("UpdateSharedFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got[:len(existing)] != existing {
+		t.Errorf("UpdateSharedFile() changed existing lines:\n%s", got)
+	}
+	backup, err := os.ReadFile(path + SharedFileBackupSuffix)
+	if err != nil || string(backup) != existing {
+		t.Errorf("backup got = %q, %v, want the previous file", backup, err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+			t.Errorf("file mode = %v, want the previous 0640", info.Mode().Perm())
+		}
+	}
+
+	// Unchanged content is not written again, the backup stays
+	if err := UpdateSharedFile(path, render); err != nil {
+		t.Fatalf("UpdateSharedFile() error = %v", err)
+	}
+	if backup, _ := os.ReadFile(path + SharedFileBackupSuffix); string(backup) != existing {
+		t.Error("UpdateSharedFile() replaced the backup without changes")
+	}
+
+	renderErr := fmt.Errorf("render failed")
+	if err := UpdateSharedFile(path, func() ([]byte, error) { return nil, renderErr }); err != renderErr {
+		t.Errorf("UpdateSharedFile() error = %v, want render error", err)
+	}
+}
+
+func TestUpdateSharedFileNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".aws", "config")
+	if err := UpdateSharedFile(path, func() ([]byte, error) { return []byte("[default]\nregion = us-east-1\n"), nil }); err != nil {
+		t.Fatalf("UpdateSharedFile() error = %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("new file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+		}
+	}
+	if _, err := os.Stat(path + SharedFileBackupSuffix); !os.IsNotExist(err) {
+		t.Errorf("backup of a new file created: %v", err)
+	}
+}
+
+func TestUpdateSharedFileConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+
+	const writers = 16
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Go(func() {
+			cred := AwsSamlOutput{AccessKeyID: fmt.Sprintf("KEY%d", i), Expiration: &time.Time{}}
+			profile := fmt.Sprintf("profile-%d", i)
+			err := UpdateSharedFile(path, func() ([]byte, error) { return cred.ToAwsCredentials(profile, path) })
+			if err != nil {
+				t.Errorf("UpdateSharedFile() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	cfg, err := ini.Load(path)
+	if err != nil {
+		t.Fatalf("failed to parse credentials: %v", err)
+	}
+	for i := range writers {
+		if got := cfg.Section(fmt.Sprintf("profile-%d", i)).Key("aws_access_key_id").String(); got != fmt.Sprintf("KEY%d", i) {
+			t.Errorf("profile-%d aws_access_key_id = %q, a concurrent writer lost it", i, got)
+		}
+	}
+}
+
+func TestUpdateSharedFileMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	malformed := "not ini at all\n[broken\n[profile ok]\nregion = us-east-1\n"
+	if err := os.WriteFile(path, []byte(malformed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := AwsSamlOutput{Region: "eu-west-1"}
+	if err := UpdateSharedFile(path, func() ([]byte, error) { return cred.ToAwsConfig("ok", path) }); err != nil {
+		t.Fatalf("UpdateSharedFile() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "not ini at all\n[broken\n[profile ok]\nregion = eu-west-1\n"; string(data) != want {
+		t.Errorf("UpdateSharedFile() got:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestSharedFilePaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	tests := []struct {
+		name     string
+		env      string
+		wantCred string
+		wantConf string
+	}{
+		{name: "default", env: "", wantCred: filepath.Join(home, ".aws", "credentials"), wantConf: filepath.Join(home, ".aws", "config")},
+		{name: "absolute", env: filepath.Join(home, "custom"), wantCred: filepath.Join(home, "custom"), wantConf: filepath.Join(home, "custom")},
+		{name: "home", env: "~/aws/file", wantCred: filepath.Join(home, "aws", "file"), wantConf: filepath.Join(home, "aws", "file")},
+		{name: "env var", env: "$HOME/file", wantCred: home + "/file", wantConf: home + "/file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvSharedCredentialsFile, tt.env)
+			t.Setenv(EnvConfigFile, tt.env)
+
+			if got, err := SharedCredentialsFile(); err != nil || got != tt.wantCred {
+				t.Errorf("SharedCredentialsFile() got = %q, %v, want %q", got, err, tt.wantCred)
+			}
+			if got, err := SharedConfigFile(); err != nil || got != tt.wantConf {
+				t.Errorf("SharedConfigFile() got = %q, %v, want %q", got, err, tt.wantConf)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/utils"
+)
+
+const (
+	// DirName name of the jc2aws directory inside the user cache directory
+	DirName = "jc2aws"
+
+	// DefaultRefreshMargin credentials expiring within the margin are treated as expired
+	DefaultRefreshMargin = 5 * time.Minute
+
+	credentialsDir = "credentials"
+	fileExt        = ".json"
+)
+
+// Key identifies cached credentials
+type Key struct {
+	// Account name from config, or IDP URL if no account is used
+	Account string `json:"account"`
+	// Role ARN or role name
+	Role   string `json:"role"`
+	Region string `json:"region"`
+}
+
+// Entry describe cached credentials without exposing secrets
+type Entry struct {
+	Key        Key        `json:"key"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Encrypted  bool       `json:"-"`
+}
+
+// file on-disk cache entry, credentials are stored either plain or sealed
+type file struct {
+	Entry
+	Credentials *aws.AwsSamlOutput `json:"credentials,omitempty"`
+	Sealed      *Sealed            `json:"sealed,omitempty"`
+}
+
+// Cache store of AWS credentials on disk
+type Cache struct {
+	// Cache directory
+	Dir string
+	// Credentials expiring within the margin are not returned
+	RefreshMargin time.Duration
+	// Encrypt cache files with a key derived from the passphrase (optional,
+	// required for sessions)
+	Passphrase string
+	// Saved sessions are not reused after this time (DefaultSessionTTL if 0)
+	SessionTTL time.Duration
+
+	// now returns current time, replaced in tests
+	now func() time.Time
+}
+
+// DefaultDir return the default cache directory ($XDG_CACHE_HOME/jc2aws or OS specific user cache dir)
+func DefaultDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, DirName), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine cache directory: %w", err)
+	}
+	return filepath.Join(dir, DirName), nil
+}
+
+// New Init new cache in the directory
+func New(dir string) *Cache {
+	return &Cache{
+		Dir:           dir,
+		RefreshMargin: DefaultRefreshMargin,
+		now:           time.Now,
+	}
+}
+
+// Get return cached credentials if they are still valid (taking into account the refresh margin)
+func (c *Cache) Get(key Key) (aws.AwsSamlOutput, bool, error) {
+	f, err := c.read(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return aws.AwsSamlOutput{}, false, nil
+	}
+	if err != nil {
+		return aws.AwsSamlOutput{}, false, err
+	}
+
+	if !c.Valid(f.Entry) {
+		return aws.AwsSamlOutput{}, false, nil
+	}
+
+	if f.Sealed != nil {
+		if c.Passphrase == "" {
+			// Encrypted by another configuration, will be overwritten on the next Put
+			return aws.AwsSamlOutput{}, false, nil
+		}
+		data, err := Open(c.Passphrase, f.Sealed)
+		if err != nil {
+			return aws.AwsSamlOutput{}, false, err
+		}
+		var cred aws.AwsSamlOutput
+		if err := json.Unmarshal(data, &cred); err != nil {
+			return aws.AwsSamlOutput{}, false, err
+		}
+		return cred, true, nil
+	}
+
+	if f.Credentials == nil {
+		return aws.AwsSamlOutput{}, false, nil
+	}
+	return *f.Credentials, true, nil
+}
+
+// Put store credentials in the cache
+func (c *Cache) Put(key Key, cred aws.AwsSamlOutput) error {
+	f := file{
+		Entry: Entry{
+			Key:        key,
+			Expiration: cred.Expiration,
+			CreatedAt:  c.now().UTC(),
+		},
+	}
+
+	if c.Passphrase != "" {
+		data, err := json.Marshal(cred)
+		if err != nil {
+			return err
+		}
+		f.Sealed, err = Seal(c.Passphrase, data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt cache entry: %w", err)
+		}
+	} else {
+		f.Credentials = &cred
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(c.Dir, credentialsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+
+	return utils.WriteFileAtomic(c.path(key), data, 0600)
+}
+
+// List return all cache entries, including expired ones
+func (c *Cache) List() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, credentialsDir, "*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, p := range files {
+		f, err := c.read(p)
+		if err != nil {
+			// Skip corrupted or foreign files
+			continue
+		}
+		entries = append(entries, f.Entry)
+	}
+	return entries, nil
+}
+
+// Delete remove cached credentials for the key
+func (c *Cache) Delete(key Key) error {
+	err := os.Remove(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Clear remove cached credentials matching the filter (all entries if filter is nil)
+// and return number of removed entries
+func (c *Cache) Clear(filter func(Key) bool) (int, error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if filter != nil && !filter(e.Key) {
+			continue
+		}
+		if err := c.Delete(e.Key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Valid report whether the entry is not expired (taking into account the refresh margin)
+func (c *Cache) Valid(e Entry) bool {
+	if e.Expiration == nil {
+		return false
+	}
+	return c.now().Add(c.RefreshMargin).Before(*e.Expiration)
+}
+
+// path return the cache file path for the key
+func (c *Cache) path(key Key) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{key.Account, key.Role, key.Region}, "\x00")))
+	return filepath.Join(c.Dir, credentialsDir, hex.EncodeToString(sum[:])+fileExt)
+}
+
+// read load a cache file
+func (c *Cache) read(path string) (file, error) {
+	var f file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("invalid cache file %s: %w", path, err)
+	}
+	f.Encrypted = f.Sealed != nil
+	return f, nil
+}
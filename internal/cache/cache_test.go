@@ -0,0 +1,366 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+func newTestCache(t *testing.T, now time.Time) *Cache {
+	t.Helper()
+	c := New(t.TempDir())
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func testCredentials(exp time.Time) aws.AwsSamlOutput {
+	return aws.AwsSamlOutput{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Region:          "us-east-1",
+		Expiration:      &exp,
+	}
+}
+
+func TestCachePutGet(t *testing.T) {
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+	key := Key{Account: "prod", Role: "admin", Region: "us-east-1"}
+
+	if _, ok, err := c.Get(key); ok || err != nil {
+		t.Fatalf("Get() on empty cache: ok=%v err=%v", ok, err)
+	}
+
+	if err := c.Put(key, testCredentials(now.Add(time.Hour))); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, ok, err := c.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("Get() ok=%v err=%v", ok, err)
+	}
+	if got.AccessKeyID != "AKIA" || got.SessionToken != "TOKEN" {
+		t.Errorf("Get() returned unexpected credentials: %+v", got)
+	}
+
+	other := Key{Account: "prod", Role: "admin", Region: "eu-west-1"}
+	if _, ok, _ := c.Get(other); ok {
+		t.Error("Get() should miss for a different region")
+	}
+}
+
+func TestCacheRefreshMargin(t *testing.T) {
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+	key := Key{Account: "prod", Role: "admin", Region: "us-east-1"}
+
+	if err := c.Put(key, testCredentials(now.Add(3*time.Minute))); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if _, ok, _ := c.Get(key); ok {
+		t.Error("Get() should miss for credentials expiring within the refresh margin")
+	}
+
+	c.RefreshMargin = time.Minute
+	if _, ok, _ := c.Get(key); !ok {
+		t.Error("Get() should hit with a smaller refresh margin")
+	}
+}
+
+func TestCacheEncrypted(t *testing.T) {
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+	c.Passphrase = "correct horse"
+	key := Key{Account: "prod", Role: "admin", Region: "us-east-1"}
+
+	if err := c.Put(key, testCredentials(now.Add(time.Hour))); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		t.Fatalf("failed to read cache file: %v", err)
+	}
+	for _, secret := range []string{"SECRET", "TOKEN"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("encrypted cache file contains %q in plain text", secret)
+		}
+	}
+
+	got, ok, err := c.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("Get() ok=%v err=%v", ok, err)
+	}
+	if got.SecretAccessKey != "SECRET" {
+		t.Errorf("Get() returned unexpected secret: %q", got.SecretAccessKey)
+	}
+
+	c.Passphrase = "wrong"
+	if _, ok, err := c.Get(key); ok || err == nil {
+		t.Errorf("Get() with wrong passphrase: ok=%v err=%v", ok, err)
+	}
+
+	c.Passphrase = ""
+	if _, ok, err := c.Get(key); ok || err != nil {
+		t.Errorf("Get() without passphrase should miss: ok=%v err=%v", ok, err)
+	}
+
+	entries, err := c.List()
+	if err != nil || len(entries) != 1 || !entries[0].Encrypted {
+		t.Errorf("List() should report an encrypted entry: %+v err=%v", entries, err)
+	}
+}
+
+func TestCacheFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on windows")
+	}
+
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+	key := Key{Account: "prod", Role: "admin", Region: "us-east-1"}
+	if err := c.Put(key, testCredentials(now.Add(time.Hour))); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	info, err := os.Stat(c.path(key))
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("cache file permissions: want 0600, got %o", perm)
+	}
+}
+
+func TestCacheListAndClear(t *testing.T) {
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+
+	keys := []Key{
+		{Account: "prod", Role: "admin", Region: "us-east-1"},
+		{Account: "prod", Role: "readonly", Region: "us-east-1"},
+		{Account: "stage", Role: "admin", Region: "us-east-1"},
+	}
+	for _, k := range keys {
+		if err := c.Put(k, testCredentials(now.Add(time.Hour))); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// Foreign files in the cache directory are ignored
+	if err := os.WriteFile(filepath.Join(c.Dir, credentialsDir, "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("List() want 3 entries, got %d", len(entries))
+	}
+
+	removed, err := c.Clear(func(k Key) bool { return k.Account == "prod" })
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Clear() want 2 removed, got %d", removed)
+	}
+
+	removed, err = c.Clear(nil)
+	if err != nil || removed != 1 {
+		t.Errorf("Clear(nil) want 1 removed, got %d err=%v", removed, err)
+	}
+}
+
+func TestCacheValid(t *testing.T) {
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+
+	exp := now.Add(time.Hour)
+	if !c.Valid(Entry{Expiration: &exp}) {
+		t.Error("Valid() want true for entry expiring in an hour")
+	}
+	if c.Valid(Entry{}) {
+		t.Error("Valid() want false for entry without expiration")
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/tmp/xdg-cache")
+	dir, err := DefaultDir()
+	if err != nil {
+		t.Fatalf("DefaultDir() error = %v", err)
+	}
+	if dir != filepath.Join("/tmp/xdg-cache", DirName) {
+		t.Errorf("DefaultDir() = %q", dir)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	sealed, err := Seal("passphrase", []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	got, err := Open("passphrase", sealed)
+	if err != nil || string(got) != "plaintext" {
+		t.Errorf("Open() = %q, err = %v", got, err)
+	}
+
+	if _, err := Open("other", sealed); err == nil {
+		t.Error("Open() with wrong passphrase should fail")
+	}
+
+	if _, err := Seal("", []byte("plaintext")); err == nil {
+		t.Error("Seal() with empty passphrase should fail")
+	}
+}
+
+func TestSessionPutGet(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+	key := SessionKey{Email: "user@example.com", ConsoleURL: "https://console.jumpcloud.com"}
+	cookies := []*http.Cookie{
+		{Name: "jc_session", Value: "session-id", Path: "/", HttpOnly: true},
+		{Name: "_xsrf", Value: "xsrf", Expires: now.Add(time.Hour)},
+	}
+
+	if err := c.PutSession(key, cookies); err == nil {
+		t.Error("PutSession() without passphrase should fail")
+	}
+
+	c.Passphrase = "passphrase"
+	if err := c.PutSession(key, cookies); err != nil {
+		t.Fatalf("PutSession() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(c.Dir, sessionsDir, "*"+fileExt))
+	if len(files) != 1 {
+		t.Fatalf("PutSession() should write 1 file, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if bytes.Contains(data, []byte("session-id")) {
+		t.Error("session file contains the plaintext cookie")
+	}
+
+	got, ok, err := c.GetSession(key)
+	if err != nil || !ok || len(got) != 2 || got[0].Value != "session-id" || !got[1].Expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("GetSession() got = %v, %v, %v, want saved cookies", got, ok, err)
+	}
+
+	c.Passphrase = "other"
+	if _, _, err := c.GetSession(key); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("GetSession() with wrong passphrase error = %v, want ErrDecrypt", err)
+	}
+
+	// The session expires with the first expiring cookie
+	c.now = func() time.Time { return now.Add(time.Hour) }
+	if _, ok, _ := c.GetSession(key); ok {
+		t.Error("GetSession() should not return a session with expired cookies")
+	}
+}
+
+func TestSessionTTL(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t, now)
+	c.Passphrase = "passphrase"
+	c.SessionTTL = time.Hour
+	key := SessionKey{Email: "user@example.com", ConsoleURL: "https://console.jumpcloud.com"}
+
+	if err := c.PutSession(key, []*http.Cookie{{Name: "jc_session", Value: "session-id"}}); err != nil {
+		t.Fatalf("PutSession() error = %v", err)
+	}
+	entries, err := c.ListSessions()
+	if err != nil || len(entries) != 1 || !entries[0].Expiration.Equal(now.Add(time.Hour)) {
+		t.Fatalf("ListSessions() got = %v, %v, want a session expiring after the TTL", entries, err)
+	}
+
+	c.now = func() time.Time { return now.Add(time.Hour) }
+	if _, ok, _ := c.GetSession(key); ok || c.SessionValid(entries[0]) {
+		t.Error("session should expire after the TTL")
+	}
+}
+
+func TestSessionListAndClear(t *testing.T) {
+	c := newTestCache(t, time.Now())
+	c.Passphrase = "passphrase"
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := c.PutSession(SessionKey{Email: email, ConsoleURL: "https://console.jumpcloud.com"}, nil); err != nil {
+			t.Fatalf("PutSession() error = %v", err)
+		}
+	}
+
+	removed, err := c.ClearSessions(func(k SessionKey) bool { return k.Email == "a@example.com" })
+	if err != nil || removed != 1 {
+		t.Fatalf("ClearSessions() = %d, %v, want 1", removed, err)
+	}
+	entries, _ := c.ListSessions()
+	if len(entries) != 1 || entries[0].Key.Email != "b@example.com" {
+		t.Errorf("ListSessions() after clear got = %v", entries)
+	}
+
+	if removed, err := c.ClearSessions(nil); err != nil || removed != 1 {
+		t.Errorf("ClearSessions(nil) = %d, %v, want 1", removed, err)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DirName, KeyFileName)
+
+	key, err := LoadOrCreateKey(path)
+	if err != nil || len(key) != 2*keySize {
+		t.Fatalf("LoadOrCreateKey() = %q, %v, want a new random key", key, err)
+	}
+	if again, err := LoadOrCreateKey(path); err != nil || again != key {
+		t.Errorf("LoadOrCreateKey() = %q, %v, want the saved key", again, err)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("key file permissions = %v, want 0600", info.Mode().Perm())
+		}
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/xdg-config")
+	if got, _ := DefaultKeyFile(); got != filepath.Join("/tmp/xdg-config", DirName, KeyFileName) {
+		t.Errorf("DefaultKeyFile() = %q", got)
+	}
+}
+
+func TestLoadOrCreateKey_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DirName, KeyFileName)
+
+	// Processes creating the key at the same time get the same complete key
+	keys := make([]string, 20)
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Go(func() { keys[i], errs[i] = LoadOrCreateKey(path) })
+	}
+	wg.Wait()
+
+	for i := range keys {
+		if errs[i] != nil || keys[i] != keys[0] || len(keys[i]) != 2*keySize {
+			t.Errorf("LoadOrCreateKey() = %q, %v, want the key %q", keys[i], errs[i], keys[0])
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("key directory has %d files, want only the key file", len(entries))
+	}
+}
@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/utils"
+)
+
+const (
+	// DefaultSessionTTL saved sessions are not reused after this time, even if cookies don't expire
+	DefaultSessionTTL = 8 * time.Hour
+
+	// KeyFileName name of the session jar key file inside the jc2aws config directory
+	KeyFileName = "session.key"
+
+	sessionsDir = "sessions"
+)
+
+// SessionKey identifies a saved Jumpcloud session
+type SessionKey struct {
+	Email      string `json:"email"`
+	ConsoleURL string `json:"console_url"`
+}
+
+// SessionEntry describe a saved session without exposing cookies
+type SessionEntry struct {
+	Key        SessionKey `json:"key"`
+	Expiration time.Time  `json:"expiration"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// sessionFile on-disk session, cookies are always sealed
+type sessionFile struct {
+	SessionEntry
+	Sealed *Sealed `json:"sealed"`
+}
+
+// cookie persisted part of an HTTP cookie
+type cookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+	HttpOnly bool       `json:"http_only,omitempty"`
+}
+
+// GetSession return cookies of the saved session if it is not expired
+func (c *Cache) GetSession(key SessionKey) ([]*http.Cookie, bool, error) {
+	f, err := c.readSession(c.sessionPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !c.SessionValid(f.SessionEntry) {
+		return nil, false, nil
+	}
+	if c.Passphrase == "" {
+		return nil, false, errors.New("session jar requires a passphrase")
+	}
+
+	data, err := Open(c.Passphrase, f.Sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	var stored []cookie
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, false, err
+	}
+
+	cookies := make([]*http.Cookie, 0, len(stored))
+	for _, s := range stored {
+		hc := &http.Cookie{Name: s.Name, Value: s.Value, Path: s.Path, Domain: s.Domain, Secure: s.Secure, HttpOnly: s.HttpOnly}
+		if s.Expires != nil {
+			hc.Expires = *s.Expires
+		}
+		cookies = append(cookies, hc)
+	}
+	return cookies, true, nil
+}
+
+// PutSession encrypt and save session cookies. The session expires with the first
+// expiring cookie, but not later than SessionTTL after it was saved.
+func (c *Cache) PutSession(key SessionKey, cookies []*http.Cookie) error {
+	if c.Passphrase == "" {
+		return errors.New("session jar requires a passphrase")
+	}
+
+	now := c.now().UTC()
+	ttl := c.SessionTTL
+	if ttl == 0 {
+		ttl = DefaultSessionTTL
+	}
+	f := sessionFile{
+		SessionEntry: SessionEntry{
+			Key:        key,
+			Expiration: now.Add(ttl),
+			CreatedAt:  now,
+		},
+	}
+
+	stored := make([]cookie, 0, len(cookies))
+	for _, hc := range cookies {
+		s := cookie{Name: hc.Name, Value: hc.Value, Path: hc.Path, Domain: hc.Domain, Secure: hc.Secure, HttpOnly: hc.HttpOnly}
+		if !hc.Expires.IsZero() {
+			exp := hc.Expires.UTC()
+			s.Expires = &exp
+			if exp.Before(f.Expiration) {
+				f.Expiration = exp
+			}
+		}
+		stored = append(stored, s)
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	f.Sealed, err = Seal(c.Passphrase, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %w", err)
+	}
+
+	data, err = json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(c.Dir, sessionsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session directory %s: %w", dir, err)
+	}
+
+	return utils.WriteFileAtomic(c.sessionPath(key), data, 0600)
+}
+
+// ListSessions return all saved sessions, including expired ones
+func (c *Cache) ListSessions() ([]SessionEntry, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, sessionsDir, "*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []SessionEntry
+	for _, p := range files {
+		f, err := c.readSession(p)
+		if err != nil {
+			// Skip corrupted or foreign files
+			continue
+		}
+		entries = append(entries, f.SessionEntry)
+	}
+	return entries, nil
+}
+
+// DeleteSession remove the saved session for the key
+func (c *Cache) DeleteSession(key SessionKey) error {
+	err := os.Remove(c.sessionPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ClearSessions remove saved sessions matching the filter (all sessions if filter is nil)
+// and return number of removed sessions
+func (c *Cache) ClearSessions(filter func(SessionKey) bool) (int, error) {
+	entries, err := c.ListSessions()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if filter != nil && !filter(e.Key) {
+			continue
+		}
+		if err := c.DeleteSession(e.Key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// SessionValid report whether the saved session is not expired
+func (c *Cache) SessionValid(e SessionEntry) bool {
+	return c.now().Before(e.Expiration)
+}
+
+// sessionPath return the session file path for the key
+func (c *Cache) sessionPath(key SessionKey) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{key.Email, key.ConsoleURL}, "\x00")))
+	return filepath.Join(c.Dir, sessionsDir, hex.EncodeToString(sum[:])+fileExt)
+}
+
+// readSession load a session file
+func (c *Cache) readSession(path string) (sessionFile, error) {
+	var f sessionFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	if f.Sealed == nil {
+		return f, fmt.Errorf("invalid session file %s: cookies are not encrypted", path)
+	}
+	return f, nil
+}
+
+// DefaultKeyFile return the default session jar key file ($XDG_CONFIG_HOME/jc2aws/session.key
+// or OS specific user config dir), kept apart from the cache directory
+func DefaultKeyFile() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, DirName, KeyFileName), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine config directory: %w", err)
+	}
+	return filepath.Join(dir, DirName, KeyFileName), nil
+}
+
+// LoadOrCreateKey read the key from the key file, a random key is
+// generated and written with 0600 permissions if the file doesn't exist
+func LoadOrCreateKey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("key file %s is empty", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create key directory: %w", err)
+	}
+	// The key is written to a temporary file and hard linked to the path, so other
+	// processes never read a partially written key. If the link exists, another
+	// process created the key in the meantime, use its key.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create key file %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(key + "\n"); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write key file %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write key file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	err = os.Link(tmp.Name(), path)
+	if errors.Is(err, os.ErrExist) {
+		return LoadOrCreateKey(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create key file %s: %w", path, err)
+	}
+	return key, nil
+}
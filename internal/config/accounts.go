@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"slices"
+	"strconv"
 )
 
 // Account store information about configured AWS accounts
@@ -13,20 +15,84 @@ type Account struct {
 	Email           string    `yaml:"email"`
 	Password        string    `yaml:"password"`
 	MFASecret       string    `yaml:"mfa_token_secret"`
+	MFAMethod       string    `yaml:"mfa_method"`
 	AWSPrincipalArn string    `yaml:"aws_principal_arn"`
 	AWSRoleArns     []AWSRole `yaml:"aws_role_arns"`
 	AWSRegions      []string  `yaml:"aws_regions"`
 	IdpURL          string    `yaml:"jc_idp_url"`
+	JCConsoleURL    string    `yaml:"jc_console_url"`
 	Duration        int       `yaml:"session_duration"`
+	// CredentialsFile, ConfigFileOut, EnvFile and JSONFile paths of the files written by the cli, env and json formats
+	CredentialsFile string `yaml:"credentials_file"`
+	ConfigFileOut   string `yaml:"config_file_out"`
+	EnvFile         string `yaml:"env_file"`
+	JSONFile        string `yaml:"json_file"`
+	// AWSConfig settings of the profile written to ~/.aws/config
+	AWSConfig AWSProfileConfig `yaml:"aws_config"`
 	// Deprecated: use session_duration instead. Will be removed in a future release.
 	SessionTimeout int `yaml:"session_timeout"`
 }
 
+// AWSProfileConfig store settings of the AWS CLI profile written to ~/.aws/config
+type AWSProfileConfig struct {
+	Output string `yaml:"output"`
+	// CliPager nil keeps the AWS CLI default, an empty string disables the pager
+	CliPager          *string `yaml:"cli_pager"`
+	S3AddressingStyle string  `yaml:"s3_addressing_style"`
+	RetryMode         string  `yaml:"retry_mode"`
+	MaxAttempts       int     `yaml:"max_attempts"`
+	// Metadata writes jc2aws_account and jc2aws_expiration of the credentials
+	Metadata bool `yaml:"metadata"`
+	// Extra any other keys, "parent.key" sets a nested setting (e.g. s3.use_accelerate_endpoint)
+	Extra map[string]string `yaml:"extra"`
+}
+
+// Settings return keys of the profile settings, extra keys don't override named settings
+func (c AWSProfileConfig) Settings() map[string]string {
+	settings := make(map[string]string, len(c.Extra)+5)
+	maps.Copy(settings, c.Extra)
+	if c.Output != "" {
+		settings["output"] = c.Output
+	}
+	if c.CliPager != nil {
+		settings["cli_pager"] = *c.CliPager
+	}
+	if c.S3AddressingStyle != "" {
+		settings["s3.addressing_style"] = c.S3AddressingStyle
+	}
+	if c.RetryMode != "" {
+		settings["retry_mode"] = c.RetryMode
+	}
+	if c.MaxAttempts > 0 {
+		settings["max_attempts"] = strconv.Itoa(c.MaxAttempts)
+	}
+	return settings
+}
+
 // AWSRole store information about aws roles
 type AWSRole struct {
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
 	Arn         string `yaml:"arn"`
+	// Chain roles assumed one by one after the SAML login, the last one is used
+	Chain []RoleHop `yaml:"chain"`
+}
+
+// RoleHop store information about a chained role
+type RoleHop struct {
+	AssumeRoleArn  string `yaml:"assume_role_arn"`
+	ExternalID     string `yaml:"external_id"`
+	SessionName    string `yaml:"session_name"`
+	Duration       int    `yaml:"session_duration"`
+	SourceIdentity string `yaml:"source_identity"`
+}
+
+// TargetArn return ARN of the role which credentials are issued for
+func (r AWSRole) TargetArn() string {
+	if len(r.Chain) > 0 {
+		return r.Chain[len(r.Chain)-1].AssumeRoleArn
+	}
+	return r.Arn
 }
 
 // FindAWSRoleArnByName return account by account name from accounts list
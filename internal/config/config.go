@@ -6,7 +6,7 @@ import (
 	"os"
 	"slices"
 
-	"gopkg.in/yaml.v2"
+	"go.yaml.in/yaml/v3"
 )
 
 const DefaultConfigFileName = ".jc2aws.yaml"
@@ -16,10 +16,36 @@ type Config struct {
 	DefaultEmail          string    `yaml:"default_email"`
 	DefaultPassword       string    `yaml:"default_password"`
 	DefaultMFATokenSecret string    `yaml:"default_mfa_token_secret"`
+	DefaultMFAMethod      string    `yaml:"default_mfa_method"`
 	NoUpdateCheck         bool      `yaml:"no_update_check"`
 	DefaultFormat         string    `yaml:"default_format"`
 	TUIDoneAction         string    `yaml:"tui_done_action"`
+	NoCache               bool      `yaml:"no_cache"`
+	ReuseSession          bool      `yaml:"reuse_session"`
+	CacheRefreshMargin    string    `yaml:"cache_refresh_margin"`
+	CacheKey              string    `yaml:"cache_key"`
+	ConsoleDestination    string    `yaml:"console_destination"`
+	ConsoleIssuer         string    `yaml:"console_issuer"`
+	FederationURL         string    `yaml:"federation_url"`
+	JCConsoleURL          string    `yaml:"jc_console_url"`
+	CredentialsFile       string    `yaml:"credentials_file"`
+	ConfigFileOut         string    `yaml:"config_file_out"`
+	EnvFile               string    `yaml:"env_file"`
+	JSONFile              string    `yaml:"json_file"`
+	STSEndpoint           string    `yaml:"sts_endpoint"`
 	Accounts              []Account `yaml:"accounts"`
+	Groups                []Group   `yaml:"groups"`
+
+	// Issues found by the validation when the config was read
+	Issues []Issue `yaml:"-"`
+}
+
+// Group named list of batch mode targets
+type Group struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Targets account[/role[/region]][=profile] specs
+	Targets []string `yaml:"targets"`
 }
 
 // NewConfig read config from file and return filled Config struct
@@ -36,10 +62,23 @@ func NewConfig(path string) (conf *Config, err error) {
 		return conf, err
 	}
 
-	err = yaml.Unmarshal(file, &conf)
-	if err != nil {
+	var doc yaml.Node
+	if err = yaml.Unmarshal(file, &doc); err != nil {
 		return conf, err
 	}
+	conf.Issues = append(dropDuplicateKeys(&doc), checkConfig(&doc)...)
+	sortIssues(conf.Issues)
+	if doc.Kind != 0 {
+		// Values of the wrong type and duplicate keys are reported as issues like other
+		// invalid values, the rest of the config is still used
+		if err = doc.Decode(conf); err != nil {
+			if _, ok := errors.AsType[*yaml.TypeError](err); !ok {
+				return conf, err
+			}
+			conf.Issues = append(conf.Issues, yamlIssues(err)...)
+			sortIssues(conf.Issues)
+		}
+	}
 
 	// Backward compatibility: migrate deprecated session_timeout to Duration
 	// if session_duration is not set. session_timeout will be removed in a future release.
@@ -120,3 +159,12 @@ func (c *Config) FindAccountByName(name string) (account Account, err error) {
 
 	return account, nil
 }
+
+// FindGroupByName return group by group name from groups list
+func (c *Config) FindGroupByName(name string) (group Group, err error) {
+	idx := slices.IndexFunc(c.Groups, func(g Group) bool { return g.Name == name })
+	if idx < 0 {
+		return group, fmt.Errorf("the group %s not found", name)
+	}
+	return c.Groups[idx], nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"maps"
 	"os"
 	"testing"
 )
@@ -292,3 +293,115 @@ accounts:
 		})
 	}
 }
+
+func TestConfigGroups(t *testing.T) {
+	configData := `
+accounts:
+  - name: prod
+  - name: stage
+groups:
+  - name: oncall
+    description: "On-call runbook"
+    targets:
+      - prod/admin
+      - stage/readonly=stage-ro
+`
+	path := t.TempDir() + "/config.yaml"
+	if err := os.WriteFile(path, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write config data: %v", err)
+	}
+
+	config, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	group, err := config.FindGroupByName("oncall")
+	if err != nil {
+		t.Fatalf("FindGroupByName() error = %v", err)
+	}
+	if len(group.Targets) != 2 || group.Targets[1] != "stage/readonly=stage-ro" {
+		t.Errorf("FindGroupByName() got targets %v", group.Targets)
+	}
+
+	if _, err := config.FindGroupByName("missing"); err == nil {
+		t.Error("FindGroupByName() expected error for unknown group")
+	}
+}
+
+func TestConfigAWSProfileSettings(t *testing.T) {
+	configData := `
+accounts:
+  - name: prod
+    aws_config:
+      output: json
+      cli_pager: ""
+      s3_addressing_style: path
+      retry_mode: adaptive
+      max_attempts: 5
+      metadata: true
+      extra:
+        sts_regional_endpoints: regional
+        output: text
+  - name: stage
+`
+	path := t.TempDir() + "/config.yaml"
+	if err := os.WriteFile(path, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write config data: %v", err)
+	}
+
+	config, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	prod, _ := config.FindAccountByName("prod")
+	want := map[string]string{
+		"output":                 "json",
+		"cli_pager":              "",
+		"s3.addressing_style":    "path",
+		"retry_mode":             "adaptive",
+		"max_attempts":           "5",
+		"sts_regional_endpoints": "regional",
+	}
+	if got := prod.AWSConfig.Settings(); !maps.Equal(got, want) {
+		t.Errorf("Settings() got = %v, want %v", got, want)
+	}
+	if !prod.AWSConfig.Metadata {
+		t.Error("Metadata got = false, want true")
+	}
+
+	stage, _ := config.FindAccountByName("stage")
+	if got := stage.AWSConfig.Settings(); len(got) != 0 {
+		t.Errorf("Settings() of an account without aws_config got = %v", got)
+	}
+}
+
+func TestConfigOutputPaths(t *testing.T) {
+	configData := `
+credentials_file: ~/devcontainer/aws/credentials
+config_file_out: $AWS_DIR/config
+env_file: /tmp/jc2aws.env
+accounts:
+  - name: prod
+    credentials_file: /mnt/prod/credentials
+`
+	path := t.TempDir() + "/config.yaml"
+	if err := os.WriteFile(path, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write config data: %v", err)
+	}
+
+	config, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	// Paths are expanded when files are written
+	if config.CredentialsFile != "~/devcontainer/aws/credentials" || config.ConfigFileOut != "$AWS_DIR/config" || config.EnvFile != "/tmp/jc2aws.env" {
+		t.Errorf("NewConfig() got paths %q, %q, %q", config.CredentialsFile, config.ConfigFileOut, config.EnvFile)
+	}
+
+	prod, _ := config.FindAccountByName("prod")
+	if prod.CredentialsFile != "/mnt/prod/credentials" {
+		t.Errorf("FindAccountByName() got credentials_file = %q", prod.CredentialsFile)
+	}
+}
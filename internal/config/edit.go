@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/yousysadmin/jc2aws/internal/utils"
+)
+
+// SetAccountValue set the param of the account in the config file, added after the last param
+// if it isn't set. Comments and the order of params are kept, the file is replaced atomically.
+func SetAccountValue(path, account, key, value string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a config file", path)
+	}
+
+	acc := findAccountNode(doc.Content[0], account)
+	if acc == nil {
+		return fmt.Errorf("account %q not found in config", account)
+	}
+	setMappingValue(acc, key, value)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, buf.Bytes(), info.Mode().Perm())
+}
+
+// findAccountNode return the mapping of the account in the accounts list, nil if not found
+func findAccountNode(root *yaml.Node, name string) *yaml.Node {
+	accounts := mappingValue(root, "accounts")
+	if accounts == nil || accounts.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, acc := range accounts.Content {
+		if n := mappingValue(acc, "name"); n != nil && n.Value == name {
+			return acc
+		}
+	}
+	return nil
+}
+
+// mappingValue return the value node of the key, nil if the node isn't a mapping or has no such key
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replace the value of the key with a double-quoted string, keeping its comments
+func setMappingValue(node *yaml.Node, key, value string) {
+	if v := mappingValue(node, key); v != nil {
+		v.Kind, v.Tag, v.Style, v.Value, v.Content, v.Alias = yaml.ScalarNode, "!!str", yaml.DoubleQuotedStyle, value, nil, nil
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: value},
+	)
+}
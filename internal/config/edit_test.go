@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetAccountValue(t *testing.T) {
+	configData := `# jc2aws config
+default_email: "default@example.com"
+
+accounts:
+  # Production
+  - name: "prod"
+    # MFA secret of the prod user
+    mfa_token_secret: "OLDSECRET"
+    jc_idp_url: "https://sso.jumpcloud.com/saml2/prod"
+  - name: "dev"
+    jc_idp_url: "https://sso.jumpcloud.com/saml2/dev" # dev app
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(configData), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetAccountValue(path, "prod", "mfa_token_secret", "otpauth://totp/JumpCloud:prod?secret=JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("SetAccountValue(prod) error = %v", err)
+	}
+	if err := SetAccountValue(path, "dev", "mfa_token_secret", "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("SetAccountValue(dev) error = %v", err)
+	}
+
+	conf, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	prod, _ := conf.FindAccountByName("prod")
+	dev, _ := conf.FindAccountByName("dev")
+	if prod.MFASecret != "otpauth://totp/JumpCloud:prod?secret=JBSWY3DPEHPK3PXP" || dev.MFASecret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("MFA secrets = %q, %q", prod.MFASecret, dev.MFASecret)
+	}
+	if dev.IdpURL != "https://sso.jumpcloud.com/saml2/dev" || conf.DefaultEmail != "default@example.com" {
+		t.Errorf("other params changed: %+v", conf)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, comment := range []string{"# jc2aws config", "# Production", "# MFA secret of the prod user", "# dev app"} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("comment %q lost:\n%s", comment, data)
+		}
+	}
+	if strings.Contains(string(data), "OLDSECRET") {
+		t.Errorf("old secret kept:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestSetAccountValue_Errors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"missing file", filepath.Join(dir, "missing.yaml"), "no such file"},
+		{"unknown account", write("accounts.yaml", "accounts:\n  - name: prod\n"), `account "dev" not found`},
+		{"invalid yaml", write("invalid.yaml", "accounts: [\n"), "failed to parse"},
+		{"not a mapping", write("list.yaml", "- a\n- b\n"), "is not a config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetAccountValue(tt.path, "dev", "mfa_token_secret", "X")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("SetAccountValue() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
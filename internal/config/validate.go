@@ -0,0 +1,375 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/yousysadmin/jc2aws/internal/secrets"
+	"github.com/yousysadmin/jc2aws/internal/validators"
+)
+
+// Severity of a config issue
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue problem found in the config file, Line and Column are 1-based (0 if unknown)
+type Issue struct {
+	Line     int
+	Column   int
+	Severity Severity
+	Message  string
+}
+
+// Position return "line:column" of the issue, "line" if the column is unknown
+func (i Issue) Position() string {
+	if i.Column <= 0 {
+		return strconv.Itoa(i.Line)
+	}
+	return strconv.Itoa(i.Line) + ":" + strconv.Itoa(i.Column)
+}
+
+// String format the issue as "line:column: severity: message"
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Position(), i.Severity, i.Message)
+}
+
+// HasErrors report whether any of the issues is an error
+func HasErrors(issues []Issue) bool {
+	return slices.ContainsFunc(issues, func(i Issue) bool { return i.Severity == SeverityError })
+}
+
+// Validate read the config file and return its issues sorted by position,
+// YAML syntax and type errors are returned as issues too
+func Validate(path string) ([]Issue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return yamlIssues(err), nil
+	}
+	issues := append(dropDuplicateKeys(&doc), checkConfig(&doc)...)
+	sortIssues(issues)
+	if doc.Kind != 0 {
+		if err := doc.Decode(&Config{}); err != nil {
+			issues = append(issues, yamlIssues(err)...)
+			sortIssues(issues)
+		}
+	}
+	return issues, nil
+}
+
+// yamlErrorLine "line N: message" of YAML errors
+var yamlErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// yamlIssues convert the YAML syntax or type error to issues
+func yamlIssues(err error) []Issue {
+	messages := []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	if typeErr, ok := errors.AsType[*yaml.TypeError](err); ok {
+		messages = typeErr.Errors
+	}
+
+	issues := make([]Issue, 0, len(messages))
+	for _, msg := range messages {
+		issue := Issue{Severity: SeverityError, Message: msg}
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Message = m[2]
+		}
+		issues = append(issues, issue)
+	}
+	sortIssues(issues)
+	return issues
+}
+
+// sortIssues sort the issues by position
+func sortIssues(issues []Issue) {
+	slices.SortStableFunc(issues, func(a, b Issue) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+}
+
+// dropDuplicateKeys remove keys defined again later in the same mapping, so the last value
+// is used like with YAML v2 instead of failing the whole mapping, and return an issue for each
+func dropDuplicateKeys(node *yaml.Node) []Issue {
+	var issues []Issue
+	if node.Kind == yaml.MappingNode {
+		last := map[string]int{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			last[node.Content[i].Value] = i
+		}
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if j := last[k.Value]; j != i {
+				dup := node.Content[j]
+				issues = append(issues, Issue{Line: dup.Line, Column: dup.Column, Severity: SeverityError,
+					Message: fmt.Sprintf("mapping key %q already defined at line %d", k.Value, k.Line)})
+				continue
+			}
+			content = append(content, k, v)
+		}
+		node.Content = content
+	}
+	for _, n := range node.Content {
+		issues = append(issues, dropDuplicateKeys(n)...)
+	}
+	return issues
+}
+
+// checker collects issues of the config nodes
+type checker struct {
+	issues []Issue
+}
+
+// checkConfig check params of the parsed config file: unknown params, duplicate names
+// and values rejected by the validators of the CLI flags
+func checkConfig(doc *yaml.Node) []Issue {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		// Decoding reports configs which aren't a mapping
+		return nil
+	}
+
+	c := &checker{}
+	c.keys(root, reflect.TypeFor[Config]())
+	c.value(root, "default_email", "email")
+	c.value(root, "default_mfa_token_secret", "mfa")
+	c.value(root, "default_mfa_method", "mfa-method")
+	c.value(root, "default_format", "output-format")
+	if n := field(root, "cache_refresh_margin"); isSet(n) {
+		if _, err := time.ParseDuration(n.Value); err != nil {
+			c.errorf(n, "cache_refresh_margin: invalid duration %q", n.Value)
+		}
+	}
+	accounts := c.accounts(field(root, "accounts"))
+	c.groups(field(root, "groups"), accounts)
+
+	sortIssues(c.issues)
+	return c.issues
+}
+
+func (c *checker) errorf(n *yaml.Node, format string, args ...any) {
+	c.issues = append(c.issues, Issue{Line: n.Line, Column: n.Column, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) warnf(n *yaml.Node, format string, args ...any) {
+	c.issues = append(c.issues, Issue{Line: n.Line, Column: n.Column, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// keys report keys of the mapping which aren't params of the type, nested mappings are checked too
+func (c *checker) keys(node *yaml.Node, t reflect.Type) {
+	node = resolve(node)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for k, v := range pairs(node) {
+			if k.Value == "<<" {
+				// Merge key of an anchor
+				continue
+			}
+			ft, ok := fields[k.Value]
+			if !ok {
+				c.errorf(k, "unknown param %q", k.Value)
+				continue
+			}
+			c.keys(v, ft)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			c.keys(item, t.Elem())
+		}
+	}
+}
+
+// value check the param of the mapping with the validator, values which
+// aren't set and secret references are skipped. Values aren't part of
+// the message, as they can be secrets.
+func (c *checker) value(node *yaml.Node, key, validator string) {
+	c.scalar(field(node, key), key, validator)
+}
+
+// scalar check the value node with the validator
+func (c *checker) scalar(n *yaml.Node, name, validator string) {
+	if !isSet(n) || secrets.IsReference(n.Value) {
+		return
+	}
+	if err := validators.Get(validator)(n.Value); err != nil {
+		c.errorf(n, "%s: %v", name, err)
+	}
+}
+
+// accounts check the accounts list and return the account names
+func (c *checker) accounts(list *yaml.Node) map[string]bool {
+	first := map[string]*yaml.Node{}
+	names := map[string]bool{}
+	for _, acc := range items(list) {
+		if acc.Kind != yaml.MappingNode {
+			continue
+		}
+
+		name := field(acc, "name")
+		switch {
+		case !isSet(name):
+			c.errorf(acc, "account without name")
+		case first[name.Value] != nil:
+			c.errorf(name, "duplicate account name %q, first defined at line %d", name.Value, first[name.Value].Line)
+		default:
+			first[name.Value] = name
+			names[name.Value] = true
+		}
+
+		c.value(acc, "email", "email")
+		c.value(acc, "mfa_token_secret", "mfa")
+		c.value(acc, "mfa_method", "mfa-method")
+		c.value(acc, "aws_principal_arn", "principal-arn")
+		c.value(acc, "jc_idp_url", "idp-url")
+		c.value(acc, "session_duration", "duration")
+		if n := field(acc, "session_timeout"); n != nil {
+			c.warnf(n, "session_timeout is deprecated, use session_duration")
+			c.scalar(n, "session_timeout", "duration")
+		}
+		for _, region := range items(field(acc, "aws_regions")) {
+			c.scalar(region, "aws_regions", "region")
+		}
+		c.roles(field(acc, "aws_role_arns"))
+	}
+	return names
+}
+
+// roles check the roles list of an account
+func (c *checker) roles(list *yaml.Node) {
+	first := map[string]*yaml.Node{}
+	for _, role := range items(list) {
+		if role.Kind != yaml.MappingNode {
+			continue
+		}
+		if name := field(role, "name"); isSet(name) {
+			if prev := first[name.Value]; prev != nil {
+				c.errorf(name, "duplicate role name %q, first defined at line %d", name.Value, prev.Line)
+			} else {
+				first[name.Value] = name
+			}
+		}
+
+		c.value(role, "arn", "role-arn")
+		for _, hop := range items(field(role, "chain")) {
+			c.value(hop, "assume_role_arn", "role-arn")
+			c.value(hop, "session_duration", "duration")
+		}
+	}
+}
+
+// groups check the groups list, targets must refer to configured accounts
+func (c *checker) groups(list *yaml.Node, accounts map[string]bool) {
+	first := map[string]*yaml.Node{}
+	for _, group := range items(list) {
+		if group.Kind != yaml.MappingNode {
+			continue
+		}
+		name := field(group, "name")
+		if isSet(name) {
+			if prev := first[name.Value]; prev != nil {
+				c.errorf(name, "duplicate group name %q, first defined at line %d", name.Value, prev.Line)
+			} else {
+				first[name.Value] = name
+			}
+		}
+
+		for _, target := range items(field(group, "targets")) {
+			if !isSet(target) {
+				continue
+			}
+			// account[/role[/region]][=profile]
+			spec, _, _ := strings.Cut(target.Value, "=")
+			account, _, _ := strings.Cut(spec, "/")
+			if !accounts[account] {
+				c.errorf(target, "target %q: account %q not found in config", target.Value, account)
+			}
+		}
+	}
+}
+
+// yamlFields return the types of the struct fields by their yaml names
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// resolve return the node an alias refers to
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// field return the resolved value node of the key, nil if not set
+func field(node *yaml.Node, key string) *yaml.Node {
+	if node = resolve(node); node == nil {
+		return nil
+	}
+	return resolve(mappingValue(node, key))
+}
+
+// pairs iterate key and resolved value nodes of the mapping
+func pairs(node *yaml.Node) iter.Seq2[*yaml.Node, *yaml.Node] {
+	return func(yield func(*yaml.Node, *yaml.Node) bool) {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !yield(node.Content[i], resolve(node.Content[i+1])) {
+				return
+			}
+		}
+	}
+}
+
+// items return the resolved items of the sequence, nil if the node isn't a sequence
+func items(node *yaml.Node) []*yaml.Node {
+	if node = resolve(node); node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	list := make([]*yaml.Node, 0, len(node.Content))
+	for _, item := range node.Content {
+		list = append(list, resolve(item))
+	}
+	return list
+}
+
+// isSet report whether the node is a scalar with a value
+func isSet(n *yaml.Node) bool {
+	return n != nil && n.Kind == yaml.ScalarNode && n.Tag != "!!null" && n.Value != ""
+}
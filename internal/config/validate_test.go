@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeTestConfig writes the config file and returns its path
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issueStrings return the issues formatted by Issue.String
+func issueStrings(issues []Issue) []string {
+	var list []string
+	for _, issue := range issues {
+		list = append(list, issue.String())
+	}
+	return list
+}
+
+func TestValidate(t *testing.T) {
+	path := writeTestConfig(t, `default_email: user@example.com
+default_fromat: json
+cache_refresh_margin: 5 minutes
+accounts:
+  - name: prod
+    mfa_token_secret: "not base32!"
+    aws_principal_arn: not-an-arn
+    aws_regions: [us-east-1, us-east-9]
+    session_duration: 60
+    aws_role_arns:
+      - name: admin
+        arn: arn:aws:iam::123456789012:role/admin
+      - name: admin
+        arn: bad-arn
+        chain:
+          - assume_role_arn: arn:aws:iam::210987654321:role/deploy
+            session_duraton: 3600
+  - name: prod
+    session_timeout: 3600
+    mfa_token_secret: "env:PROD_MFA"
+groups:
+  - name: all
+    targets: [prod/admin, dev=dev-profile]
+`)
+
+	issues, err := Validate(path)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	want := []string{
+		`2:1: error: unknown param "default_fromat"`,
+		`3:23: error: cache_refresh_margin: invalid duration "5 minutes"`,
+		`6:23: error: mfa_token_secret: mfa must be a 6 to 8 digit totp code, a base32 mfa secret or an otpauth:// URI`,
+		`7:24: error: aws_principal_arn: invalid principal arn`,
+		`8:30: error: aws_regions: invalid region`,
+		`9:23: error: session_duration: session duration must be 900 to 43200 seconds`,
+		`13:15: error: duplicate role name "admin", first defined at line 11`,
+		`14:14: error: arn: invalid role arn`,
+		`17:13: error: unknown param "session_duraton"`,
+		`18:11: error: duplicate account name "prod", first defined at line 5`,
+		`19:22: warning: session_timeout is deprecated, use session_duration`,
+		`23:27: error: target "dev=dev-profile": account "dev" not found in config`,
+	}
+	if got := issueStrings(issues); !slices.Equal(got, want) {
+		t.Errorf("Validate issues:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !HasErrors(issues) {
+		t.Error("HasErrors = false, want true")
+	}
+}
+
+func TestValidate_Valid(t *testing.T) {
+	path := writeTestConfig(t, `default_email: user@example.com
+default_password: "cmd:pass show jumpcloud"
+accounts:
+  - &prod
+    name: prod
+    mfa_token_secret: JBSWY3DPEHPK3PXP
+    aws_principal_arn: arn:aws:iam::123456789012:saml-provider/jumpcloud
+    aws_regions: [us-east-1]
+    session_duration: 43200
+    aws_config:
+      extra:
+        s3.use_accelerate_endpoint: "true"
+    aws_role_arns:
+      - name: admin
+        arn: arn:aws:iam::123456789012:role/admin
+  - <<: *prod
+    name: staging
+groups:
+  - name: all
+    targets: [prod/admin, staging=staging-profile]
+`)
+
+	issues, err := Validate(path)
+	if err != nil || len(issues) != 0 {
+		t.Errorf("Validate = %v, %v, want no issues", issueStrings(issues), err)
+	}
+}
+
+func TestValidate_YAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"syntax", "accounts:\n  - name: prod\n    aws_regions: [us-east-1\n", "2: error: did not find expected ',' or ']'"},
+		{"type", "accounts:\n  - name: prod\n    session_duration: one hour\n", "3: error: cannot unmarshal !!str `one hour` into int"},
+		{"duplicate key", "accounts:\n  - name: prod\n    name: dev\n", `3:5: error: mapping key "name" already defined at line 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := Validate(writeTestConfig(t, tt.data))
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got := issueStrings(issues); !slices.Contains(got, tt.want) {
+				t.Errorf("Validate issues = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_MissingFile(t *testing.T) {
+	if _, err := Validate(filepath.Join(t.TempDir(), "missing.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Validate error = %v, want not exist", err)
+	}
+}
+
+func TestNewConfig_Issues(t *testing.T) {
+	path := writeTestConfig(t, "accounts:\n  - name: prod\n    regions: [us-east-1]\n")
+
+	conf, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+	if got := issueStrings(conf.Issues); !slices.Equal(got, []string{`3:5: error: unknown param "regions"`}) {
+		t.Errorf("Issues = %q", got)
+	}
+	if len(conf.Accounts) != 1 || conf.Accounts[0].Name != "prod" {
+		t.Errorf("Accounts = %+v, want the account despite the issue", conf.Accounts)
+	}
+}
+
+func TestNewConfig_TypeErrors(t *testing.T) {
+	path := writeTestConfig(t, "accounts:\n  - name: prod\n    session_duration: one hour\n    aws_regions: [us-east-1]\n    name: dev\n")
+
+	conf, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("NewConfig: %v, want the type errors as issues", err)
+	}
+	want := []string{
+		"3: error: cannot unmarshal !!str `one hour` into int",
+		`3:23: error: session_duration: session duration must be 900 to 43200 seconds`,
+		`5:5: error: mapping key "name" already defined at line 2`,
+	}
+	if got := issueStrings(conf.Issues); !slices.Equal(got, want) {
+		t.Errorf("Issues:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// The last value of a duplicate key is used like with YAML v2
+	if len(conf.Accounts) != 1 || conf.Accounts[0].Name != "dev" || !slices.Equal(conf.Accounts[0].AWSRegions, []string{"us-east-1"}) {
+		t.Errorf("Accounts = %+v, want the account with its valid values", conf.Accounts)
+	}
+
+	if _, err := NewConfig(writeTestConfig(t, "accounts:\n  - name: prod\n  aws_regions: [us-east-1\n")); err == nil {
+		t.Error("NewConfig: want an error for a syntax error")
+	}
+}
@@ -0,0 +1,154 @@
+// Package console builds AWS Management Console sign-in URLs for temporary
+// credentials via the AWS federation endpoint (getSigninToken).
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+const (
+	// DefaultFederationURL AWS federation endpoint
+	DefaultFederationURL = "https://signin.aws.amazon.com/federation"
+
+	// DefaultConsoleURL console base URL used for relative destinations
+	DefaultConsoleURL = "https://console.aws.amazon.com/"
+
+	// DefaultIssuer shown by the console as the sign-in source
+	DefaultIssuer = "jc2aws"
+)
+
+// Options of the console sign-in URL
+type Options struct {
+	// FederationURL federation endpoint, DefaultFederationURL if empty
+	FederationURL string
+	// Destination console page opened after sign-in, a URL or a path relative
+	// to the console (e.g. "s3/home"), the console home page if empty
+	Destination string
+	// Issuer URL or name of the sign-in source, DefaultIssuer if empty
+	Issuer string
+	// Client HTTP client, a client with a 30s timeout if nil
+	Client *http.Client
+}
+
+// session temporary credentials in the getSigninToken format
+type session struct {
+	SessionID    string `json:"sessionId"`
+	SessionKey   string `json:"sessionKey"`
+	SessionToken string `json:"sessionToken"`
+}
+
+// signinTokenResponse getSigninToken response
+type signinTokenResponse struct {
+	SigninToken string `json:"SigninToken"`
+}
+
+// SigninToken exchange temporary credentials for a console sign-in token
+func SigninToken(ctx context.Context, cred aws.AwsSamlOutput, opts Options) (string, error) {
+	if cred.SessionToken == "" {
+		return "", fmt.Errorf("console sign-in requires temporary credentials with a session token")
+	}
+
+	s, err := json.Marshal(session{
+		SessionID:    cred.AccessKeyID,
+		SessionKey:   cred.SecretAccessKey,
+		SessionToken: cred.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("Action", "getSigninToken")
+	q.Set("Session", string(s))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.federationURL()+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := opts.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sign-in token: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to get sign-in token: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get sign-in token: %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tr signinTokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil || tr.SigninToken == "" {
+		return "", fmt.Errorf("failed to get sign-in token: invalid response from %s", opts.federationURL())
+	}
+	return tr.SigninToken, nil
+}
+
+// LoginURL return console sign-in URL for temporary credentials
+func LoginURL(ctx context.Context, cred aws.AwsSamlOutput, opts Options) (string, error) {
+	token, err := SigninToken(ctx, cred, opts)
+	if err != nil {
+		return "", err
+	}
+
+	issuer := opts.Issuer
+	if issuer == "" {
+		issuer = DefaultIssuer
+	}
+
+	q := url.Values{}
+	q.Set("Action", "login")
+	q.Set("Issuer", issuer)
+	q.Set("Destination", Destination(opts.Destination, cred.Region))
+	q.Set("SigninToken", token)
+	return opts.federationURL() + "?" + q.Encode(), nil
+}
+
+// Destination return console URL of the destination, relative destinations and
+// the console home page are opened in the region
+func Destination(dest, region string) string {
+	if strings.HasPrefix(dest, "https://") || strings.HasPrefix(dest, "http://") {
+		return dest
+	}
+	if dest == "" {
+		dest = "console/home"
+	}
+
+	u, err := url.Parse(DefaultConsoleURL + strings.TrimPrefix(dest, "/"))
+	if err != nil {
+		return DefaultConsoleURL
+	}
+	if region != "" {
+		q := u.Query()
+		if !q.Has("region") {
+			q.Set("region", region)
+			u.RawQuery = q.Encode()
+		}
+	}
+	return u.String()
+}
+
+func (o Options) federationURL() string {
+	if o.FederationURL != "" {
+		return o.FederationURL
+	}
+	return DefaultFederationURL
+}
+
+func (o Options) client() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
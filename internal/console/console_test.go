@@ -0,0 +1,132 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+var testCred = aws.AwsSamlOutput{
+	AccessKeyID:     "AKIA",
+	SecretAccessKey: "SECRET",
+	SessionToken:    "TOKEN",
+	Region:          "eu-west-1",
+}
+
+// federationStub serves getSigninToken, checking the session it receives
+func federationStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "getSigninToken" {
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		var s session
+		if err := json.Unmarshal([]byte(q.Get("Session")), &s); err != nil {
+			http.Error(w, "invalid session", http.StatusBadRequest)
+			return
+		}
+		if s.SessionID != "AKIA" || s.SessionKey != "SECRET" || s.SessionToken != "TOKEN" {
+			http.Error(w, "invalid credentials", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(signinTokenResponse{SigninToken: "signin-token"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoginURL(t *testing.T) {
+	srv := federationStub(t)
+
+	got, err := LoginURL(context.Background(), testCred, Options{
+		FederationURL: srv.URL,
+		Destination:   "s3/home",
+		Issuer:        "https://example.com",
+	})
+	if err != nil {
+		t.Fatalf("LoginURL() error = %v", err)
+	}
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("LoginURL() returned invalid URL %q", got)
+	}
+	if !strings.HasPrefix(got, srv.URL+"?") {
+		t.Errorf("LoginURL() should use the federation endpoint, got %q", got)
+	}
+	want := map[string]string{
+		"Action":      "login",
+		"Issuer":      "https://example.com",
+		"Destination": "https://console.aws.amazon.com/s3/home?region=eu-west-1",
+		"SigninToken": "signin-token",
+	}
+	for k, v := range want {
+		if u.Query().Get(k) != v {
+			t.Errorf("LoginURL() %s got = %q, want %q", k, u.Query().Get(k), v)
+		}
+	}
+}
+
+func TestLoginURLDefaults(t *testing.T) {
+	srv := federationStub(t)
+
+	got, err := LoginURL(context.Background(), testCred, Options{FederationURL: srv.URL})
+	if err != nil {
+		t.Fatalf("LoginURL() error = %v", err)
+	}
+	u, _ := url.Parse(got)
+	if u.Query().Get("Issuer") != DefaultIssuer {
+		t.Errorf("LoginURL() Issuer got = %q, want %q", u.Query().Get("Issuer"), DefaultIssuer)
+	}
+	if d := u.Query().Get("Destination"); d != "https://console.aws.amazon.com/console/home?region=eu-west-1" {
+		t.Errorf("LoginURL() Destination got = %q", d)
+	}
+}
+
+func TestSigninTokenErrors(t *testing.T) {
+	srv := federationStub(t)
+
+	tests := []struct {
+		name string
+		cred aws.AwsSamlOutput
+	}{
+		{"no session token", aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET"}},
+		{"rejected credentials", aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "WRONG", SessionToken: "TOKEN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SigninToken(context.Background(), tt.cred, Options{FederationURL: srv.URL}); err == nil {
+				t.Error("SigninToken() expected error")
+			}
+		})
+	}
+}
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		dest   string
+		region string
+		want   string
+	}{
+		{"", "us-east-1", "https://console.aws.amazon.com/console/home?region=us-east-1"},
+		{"", "", "https://console.aws.amazon.com/console/home"},
+		{"/ec2/home", "ca-central-1", "https://console.aws.amazon.com/ec2/home?region=ca-central-1"},
+		{"ec2/home?region=us-west-2", "ca-central-1", "https://console.aws.amazon.com/ec2/home?region=us-west-2"},
+		{"https://us-east-1.console.aws.amazon.com/lambda", "ca-central-1", "https://us-east-1.console.aws.amazon.com/lambda"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dest, func(t *testing.T) {
+			if got := Destination(tt.dest, tt.region); got != tt.want {
+				t.Errorf("Destination() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
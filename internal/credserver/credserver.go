@@ -0,0 +1,168 @@
+// Package credserver serves AWS credentials over HTTP in the format of the
+// container credentials provider (AWS_CONTAINER_CREDENTIALS_FULL_URI), so
+// AWS SDKs and the AWS CLI pick up rotating credentials without files.
+package credserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+const (
+	// Path of the credentials endpoint
+	Path = "/credentials"
+
+	// DefaultRefreshMargin credentials are refreshed this long before they expire
+	DefaultRefreshMargin = 5 * time.Minute
+
+	// Environment variables used by AWS SDKs to find the endpoint
+	EnvFullURI            = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	EnvAuthorizationToken = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+
+	// retryInterval delay before retrying a failed background refresh
+	retryInterval = 30 * time.Second
+)
+
+// Provider obtain new credentials
+type Provider func(ctx context.Context) (aws.AwsSamlOutput, error)
+
+// response credentials in the container credentials provider format
+type response struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+// errorResponse error in the container credentials provider format
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server HTTP handler serving credentials, refreshed before they expire
+type Server struct {
+	// Token expected in the Authorization header
+	Token         string
+	Provider      Provider
+	RefreshMargin time.Duration
+
+	mu   sync.Mutex
+	cred *aws.AwsSamlOutput
+}
+
+// New Init new server with the authorization token
+func New(token string, provider Provider) *Server {
+	return &Server{
+		Token:         token,
+		Provider:      provider,
+		RefreshMargin: DefaultRefreshMargin,
+	}
+}
+
+// NewToken generate random authorization token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Env return environment variables pointing AWS SDKs to the endpoint at baseURL
+func Env(baseURL, token string) []string {
+	return []string{
+		EnvFullURI + "=" + baseURL + Path,
+		EnvAuthorizationToken + "=" + token,
+	}
+}
+
+// ServeHTTP serve credentials to requests with a valid Authorization header
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != Path {
+		writeError(w, http.StatusNotFound, "NotFound", "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+		return
+	}
+	if s.Token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "invalid authorization token")
+		return
+	}
+
+	cred, err := s.Credentials(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "CredentialsError", err.Error())
+		return
+	}
+
+	res := response{
+		AccessKeyID:     cred.AccessKeyID,
+		SecretAccessKey: cred.SecretAccessKey,
+		Token:           cred.SessionToken,
+	}
+	if cred.Expiration != nil {
+		res.Expiration = cred.Expiration.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// Credentials return current credentials, obtaining new ones if they expire within the refresh margin
+func (s *Server) Credentials(ctx context.Context) (aws.AwsSamlOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cred != nil && !s.expiring(*s.cred) {
+		return *s.cred, nil
+	}
+
+	cred, err := s.Provider(ctx)
+	if err != nil {
+		return aws.AwsSamlOutput{}, err
+	}
+	s.cred = &cred
+	return cred, nil
+}
+
+// Run refresh credentials in the background before they expire, until the context is cancelled
+func (s *Server) Run(ctx context.Context) {
+	for {
+		wait := retryInterval
+		if cred, err := s.Credentials(ctx); err == nil && cred.Expiration != nil {
+			wait = max(time.Until(cred.Expiration.Add(-s.RefreshMargin)), time.Second)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// expiring report whether credentials expire within the refresh margin
+func (s *Server) expiring(cred aws.AwsSamlOutput) bool {
+	if cred.Expiration == nil {
+		return false
+	}
+	return time.Now().Add(s.RefreshMargin).After(*cred.Expiration)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
@@ -0,0 +1,153 @@
+package credserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/aws"
+)
+
+// countingProvider returns credentials valid for ttl and counts calls
+func countingProvider(calls *atomic.Int32, ttl time.Duration) Provider {
+	return func(context.Context) (aws.AwsSamlOutput, error) {
+		calls.Add(1)
+		exp := time.Now().Add(ttl)
+		return aws.AwsSamlOutput{AccessKeyID: "AKIA", SecretAccessKey: "SECRET", SessionToken: "TOKEN", Expiration: &exp}, nil
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(New("secret-token", countingProvider(&calls, time.Hour)))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"valid", http.MethodGet, Path, "secret-token", http.StatusOK},
+		{"missing token", http.MethodGet, Path, "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, Path, "other-token", http.StatusUnauthorized},
+		{"wrong path", http.MethodGet, "/other", "secret-token", http.StatusNotFound},
+		{"wrong method", http.MethodPost, Path, "secret-token", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status got = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got response
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if got.AccessKeyID != "AKIA" || got.SecretAccessKey != "SECRET" || got.Token != "TOKEN" {
+				t.Errorf("unexpected credentials: %+v", got)
+			}
+			if _, err := time.Parse(time.RFC3339, got.Expiration); err != nil {
+				t.Errorf("Expiration is not RFC3339: %q", got.Expiration)
+			}
+		})
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("valid credentials should be reused, provider called %d times", calls.Load())
+	}
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	var calls atomic.Int32
+	s := New("token", countingProvider(&calls, 3*time.Minute))
+
+	for range 2 {
+		if _, err := s.Credentials(context.Background()); err != nil {
+			t.Fatalf("Credentials() error = %v", err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("credentials expiring within the refresh margin should be refreshed, provider called %d times", calls.Load())
+	}
+
+	s.RefreshMargin = time.Minute
+	if _, err := s.Credentials(context.Background()); err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("valid credentials should be reused, provider called %d times", calls.Load())
+	}
+}
+
+func TestCredentialsError(t *testing.T) {
+	s := New("token", func(context.Context) (aws.AwsSamlOutput, error) {
+		return aws.AwsSamlOutput{}, errors.New("auth failed")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, Path, nil)
+	req.Header.Set("Authorization", "token")
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status got = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	var got errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.Message != "auth failed" {
+		t.Errorf("error response got = %+v, err = %v", got, err)
+	}
+}
+
+func TestRunRefreshesInBackground(t *testing.T) {
+	var calls atomic.Int32
+	s := New("token", countingProvider(&calls, 2*time.Second))
+	s.RefreshMargin = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	// Fetched at start and refreshed one second later
+	if calls.Load() != 2 {
+		t.Errorf("want 2 fetches, got %d", calls.Load())
+	}
+}
+
+func TestTokenAndEnv(t *testing.T) {
+	a, err := NewToken()
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+	b, _ := NewToken()
+	if len(a) != 64 || a == b {
+		t.Errorf("NewToken() should return random 32 byte hex tokens, got %q and %q", a, b)
+	}
+
+	env := Env("http://127.0.0.1:9911", "token")
+	want := []string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911/credentials",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN=token",
+	}
+	if len(env) != 2 || env[0] != want[0] || env[1] != want[1] {
+		t.Errorf("Env() got = %v, want %v", env, want)
+	}
+}
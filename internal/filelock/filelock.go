@@ -0,0 +1,40 @@
+// Package filelock provides advisory inter-process file locks, so concurrent
+// jc2aws processes don't overwrite each other's changes of shared files.
+package filelock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Lock exclusive lock held on a lock file
+type Lock struct {
+	f *os.File
+}
+
+// Acquire wait until the exclusive lock on the lock file is acquired, the file is
+// created if it doesn't exist. The lock is released by Unlock or when the process exits.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock release the lock, the lock file is kept for other processes
+func (l *Lock) Unlock() error {
+	if err := unlock(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,61 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestAcquireSerializesWriters(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "nested", "counter.lock")
+	counter := filepath.Join(dir, "counter")
+
+	// Read-modify-write without the lock would lose increments
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			l, err := Acquire(lockPath)
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			defer l.Unlock()
+
+			data, _ := os.ReadFile(counter)
+			n, _ := strconv.Atoi(string(data))
+			if err := os.WriteFile(counter, []byte(strconv.Itoa(n+1)), 0600); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "20" {
+		t.Errorf("counter = %s, want 20", data)
+	}
+}
+
+func TestUnlockReleases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.lock")
+	l, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	// Acquired again after the release, not blocked forever
+	l, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() after Unlock() error = %v", err)
+	}
+	l.Unlock()
+}
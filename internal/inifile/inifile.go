@@ -0,0 +1,301 @@
+// Package inifile edits INI files such as ~/.aws/credentials and ~/.aws/config
+// line by line: comments, ordering, formatting and lines it doesn't understand
+// are kept as they are, only the edited keys and sections change.
+package inifile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// File INI file as a list of lines
+type File struct {
+	lines []string
+	// eol line ending of the file, "\r\n" is kept for files written on Windows
+	eol string
+}
+
+// Parse read the INI document, it never fails: malformed lines are kept as is
+func Parse(data []byte) *File {
+	f := &File{eol: "\n"}
+	if bytes.Contains(data, []byte("\r\n")) {
+		f.eol = "\r\n"
+	}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text != "" {
+		f.lines = strings.Split(text, "\n")
+	}
+	return f
+}
+
+// Load read the INI file, a missing file is an empty document
+func Load(path string) (*File, error) {
+	if path == "" {
+		return Parse(nil), nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Parse(nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data), nil
+}
+
+// Bytes return the INI document
+func (f *File) Bytes() []byte {
+	if len(f.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(f.lines, f.eol) + f.eol)
+}
+
+// Get return the value of the key in the section, "parent.key" gets a nested setting
+func (f *File) Get(section, key string) (string, bool) {
+	start, end := f.section(section)
+	if start < 0 {
+		return "", false
+	}
+	parent, sub, nested := strings.Cut(key, ".")
+	if !nested {
+		if i := f.key(start, end, key); i >= 0 {
+			_, value, _ := parseKey(f.lines[i])
+			return value, true
+		}
+		return "", false
+	}
+
+	i := f.key(start, end, parent)
+	if i < 0 {
+		return "", false
+	}
+	if j := f.nestedKey(i, end, sub); j >= 0 {
+		_, value, _ := parseKey(strings.TrimSpace(f.lines[j]))
+		return value, true
+	}
+	return "", false
+}
+
+// Set the value of the key in the section. An existing key is replaced in place,
+// a new key is added after the last key of the section, a new section at the end of the file.
+// "parent.key" sets a nested setting, e.g. "s3.addressing_style".
+func (f *File) Set(section, key, value string) {
+	if parent, sub, ok := strings.Cut(key, "."); ok {
+		f.setNested(section, parent, sub, value)
+		return
+	}
+
+	start, end := f.section(section)
+	if start < 0 {
+		f.addSection(section)
+		f.lines = append(f.lines, formatKey(key, value, 0))
+		return
+	}
+
+	if i := f.key(start, end, key); i >= 0 {
+		f.lines[i] = replaceValue(f.lines[i], value)
+		return
+	}
+
+	// After the last key and its continuation lines, so trailing comments
+	// and blank lines stay in front of the next section
+	last := start
+	for i := start + 1; i < end; i++ {
+		if !isBlankOrComment(f.lines[i]) {
+			last = i
+		}
+	}
+	f.lines = slices.Insert(f.lines, last+1, formatKey(key, value, 0))
+}
+
+// setNested set the nested setting, other nested settings of the parent are kept
+func (f *File) setNested(section, parent, key, value string) {
+	start, end := f.section(section)
+	if start < 0 || f.key(start, end, parent) < 0 {
+		f.Set(section, parent, "")
+		start, end = f.section(section)
+	}
+
+	i := f.key(start, end, parent)
+	if j := f.nestedKey(i, end, key); j >= 0 {
+		f.lines[j] = replaceValue(f.lines[j], value)
+		return
+	}
+	j := i + 1
+	for j < end && isContinuation(f.lines[j]) {
+		j++
+	}
+	f.lines = slices.Insert(f.lines, j, "  "+formatKey(key, value, 0))
+}
+
+// KeyValue key and value of a section
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// SetKeys set the keys of the section. A new section is added at the end of the file
+// with aligned keys, the way the ini package formats sections.
+func (f *File) SetKeys(section string, keys []KeyValue) {
+	if f.HasSection(section) {
+		for _, kv := range keys {
+			f.Set(section, kv.Key, kv.Value)
+		}
+		return
+	}
+
+	var plain, nested []KeyValue
+	width := 0
+	for _, kv := range keys {
+		if strings.Contains(kv.Key, ".") {
+			nested = append(nested, kv)
+			continue
+		}
+		plain = append(plain, kv)
+		width = max(width, len(kv.Key))
+	}
+
+	f.addSection(section)
+	for _, kv := range plain {
+		f.lines = append(f.lines, formatKey(kv.Key, kv.Value, width))
+	}
+	for _, kv := range nested {
+		f.Set(section, kv.Key, kv.Value)
+	}
+}
+
+// addSection add the section header at the end of the file, separated by a blank line
+func (f *File) addSection(section string) {
+	if n := len(f.lines); n > 0 && strings.TrimSpace(f.lines[n-1]) != "" {
+		f.lines = append(f.lines, "")
+	}
+	f.lines = append(f.lines, "["+section+"]")
+}
+
+// formatKey format a "key = value" line, the key is padded to the width
+func formatKey(key, value string, width int) string {
+	return strings.TrimRight(fmt.Sprintf("%-*s = %s", width, key, value), " ")
+}
+
+// replaceValue replace the value of a key line, keeping the formatting of the key (e.g. aligned "=" signs)
+func replaceValue(line, value string) string {
+	eq := strings.Index(line, "=") + 1
+	for eq < len(line) && (line[eq] == ' ' || line[eq] == '\t') {
+		eq++
+	}
+	return strings.TrimRight(line[:eq]+value, " ")
+}
+
+// Delete remove the key from the section
+func (f *File) Delete(section, key string) {
+	start, end := f.section(section)
+	if start < 0 {
+		return
+	}
+	i := f.key(start, end, key)
+	if i < 0 {
+		return
+	}
+	// Remove indented continuation lines (nested settings) too
+	j := i + 1
+	for j < end && isContinuation(f.lines[j]) {
+		j++
+	}
+	f.lines = slices.Delete(f.lines, i, j)
+}
+
+// HasSection report whether the section exists
+func (f *File) HasSection(section string) bool {
+	start, _ := f.section(section)
+	return start >= 0
+}
+
+// Sections return names of the sections in the order of the file
+func (f *File) Sections() []string {
+	var sections []string
+	for _, l := range f.lines {
+		if header, ok := parseHeader(l); ok && !slices.Contains(sections, header) {
+			sections = append(sections, header)
+		}
+	}
+	return sections
+}
+
+// section return the header line index of the first section with the name and the index
+// of the next section header (or the number of lines), -1 if the section doesn't exist
+func (f *File) section(name string) (int, int) {
+	start := -1
+	for i, l := range f.lines {
+		header, ok := parseHeader(l)
+		if !ok {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if header == name {
+			start = i
+		}
+	}
+	return start, len(f.lines)
+}
+
+// nestedKey return the line index of the nested key in continuation lines of the parent key line, -1 if not found
+func (f *File) nestedKey(parent, end int, key string) int {
+	for j := parent + 1; j < end && isContinuation(f.lines[j]); j++ {
+		if k, _, ok := parseKey(strings.TrimSpace(f.lines[j])); ok && k == key {
+			return j
+		}
+	}
+	return -1
+}
+
+// key return the line index of the key between start and end, -1 if not found
+func (f *File) key(start, end int, key string) int {
+	for i := start + 1; i < end; i++ {
+		if k, _, ok := parseKey(f.lines[i]); ok && k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseHeader return the name of a "[section]" line
+func parseHeader(line string) (string, bool) {
+	l := strings.TrimSpace(line)
+	if len(l) < 2 || l[0] != '[' || l[len(l)-1] != ']' {
+		return "", false
+	}
+	return strings.TrimSpace(l[1 : len(l)-1]), true
+}
+
+// parseKey return the key and value of a "key = value" line, indented lines
+// are continuation lines of the previous key and are not keys themselves
+func parseKey(line string) (string, string, bool) {
+	if isBlankOrComment(line) || isContinuation(line) {
+		return "", "", false
+	}
+	k, v, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	return strings.TrimSpace(k), strings.TrimSpace(v), true
+}
+
+// isBlankOrComment report whether the line is empty or a # or ; comment
+func isBlankOrComment(line string) bool {
+	l := strings.TrimSpace(line)
+	return l == "" || l[0] == '#' || l[0] == ';'
+}
+
+// isContinuation report whether the line is indented
+func isContinuation(line string) bool {
+	return line != "" && (line[0] == ' ' || line[0] == '\t') && strings.TrimSpace(line) != ""
+}
@@ -0,0 +1,186 @@
+package inifile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testFile = `# Managed by hand, keep this comment
+[default]
+region = us-east-1 ; inline comment kept
+output=json
+
+; old profile
+[profile legacy]
+s3 =
+  max_concurrent_requests = 10
+region = eu-west-1
+
+# trailing comment of legacy
+
+[profile other]
+region = ca-central-1
+`
+
+func TestSetPreservesFile(t *testing.T) {
+	f := Parse([]byte(testFile))
+	f.Set("profile legacy", "region", "us-west-2")
+	f.Set("profile legacy", "credential_process", "/bin/jc2aws --output-format credential-process")
+	f.Set("profile new", "region", "sa-east-1")
+
+	want := `# Managed by hand, keep this comment
+[default]
+region = us-east-1 ; inline comment kept
+output=json
+
+; old profile
+[profile legacy]
+s3 =
+  max_concurrent_requests = 10
+region = us-west-2
+credential_process = /bin/jc2aws --output-format credential-process
+
+# trailing comment of legacy
+
+[profile other]
+region = ca-central-1
+
+[profile new]
+region = sa-east-1
+`
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSetUnchangedFileIsIdentical(t *testing.T) {
+	f := Parse([]byte(testFile))
+	if got := string(f.Bytes()); got != testFile {
+		t.Errorf("Bytes() got:\n%s\nwant:\n%s", got, testFile)
+	}
+}
+
+func TestGetAndDelete(t *testing.T) {
+	f := Parse([]byte(testFile))
+	if v, ok := f.Get("default", "output"); !ok || v != "json" {
+		t.Errorf("Get(default, output) got = %q, %v", v, ok)
+	}
+	// Indented lines are nested settings, not keys of the section
+	if _, ok := f.Get("profile legacy", "max_concurrent_requests"); ok {
+		t.Error("Get() returned a nested setting")
+	}
+
+	f.Delete("profile legacy", "s3")
+	f.Delete("profile legacy", "missing")
+	f.Delete("missing", "region")
+	if _, ok := f.Get("profile legacy", "s3"); ok {
+		t.Error("Delete() kept the key")
+	}
+	if v, _ := f.Get("profile legacy", "region"); v != "eu-west-1" {
+		t.Errorf("Delete() removed other keys, region = %q", v)
+	}
+	if !f.HasSection("profile legacy") || f.HasSection("missing") {
+		t.Error("HasSection() got wrong result")
+	}
+	if got := f.Sections(); !slices.Equal(got, []string{"default", "profile legacy", "profile other"}) {
+		t.Errorf("Sections() got = %v", got)
+	}
+}
+
+func TestMalformedFile(t *testing.T) {
+	malformed := "garbage without section\n[unterminated\nkey without value\n[ok]\n=no key\n"
+	f := Parse([]byte(malformed))
+	f.Set("ok", "region", "us-east-1")
+	f.Set("new", "region", "us-east-2")
+
+	want := "garbage without section\n[unterminated\nkey without value\n[ok]\n=no key\nregion = us-east-1\n\n[new]\nregion = us-east-2\n"
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	f := Parse([]byte("[default]\r\nregion = us-east-1\r\n"))
+	f.Set("default", "output", "json")
+	if got, want := string(f.Bytes()), "[default]\r\nregion = us-east-1\r\noutput = json\r\n"; got != want {
+		t.Errorf("Bytes() got = %q, want %q", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f, err := Load(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || f.Bytes() != nil {
+		t.Errorf("Load() of a missing file got = %q, %v, want empty document", f.Bytes(), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if v, ok := f.Get("profile other", "region"); !ok || v != "ca-central-1" {
+		t.Errorf("Get() got = %q, %v", v, ok)
+	}
+}
+
+func TestSetKeys(t *testing.T) {
+	f := Parse([]byte("[existing]\nregion   =   us-east-1\n"))
+	keys := []KeyValue{{Key: "region", Value: "eu-west-1"}, {Key: "aws_access_key_id", Value: "AKIA"}}
+	f.SetKeys("existing", keys)
+	f.SetKeys("new", keys)
+	// Replaced values keep the alignment
+	f.SetKeys("new", []KeyValue{{Key: "region", Value: "us-west-2"}})
+
+	want := "[existing]\nregion   =   eu-west-1\naws_access_key_id = AKIA\n\n[new]\nregion            = us-west-2\naws_access_key_id = AKIA\n"
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSetNested(t *testing.T) {
+	f := Parse([]byte(testFile))
+	f.Set("profile legacy", "s3.max_concurrent_requests", "20")
+	f.Set("profile legacy", "s3.addressing_style", "path")
+	f.Set("profile other", "s3.addressing_style", "virtual")
+	f.SetKeys("profile new", []KeyValue{{Key: "s3.addressing_style", Value: "path"}, {Key: "region", Value: "us-east-1"}, {Key: "cli_pager", Value: ""}})
+
+	want := `# Managed by hand, keep this comment
+[default]
+region = us-east-1 ; inline comment kept
+output=json
+
+; old profile
+[profile legacy]
+s3 =
+  max_concurrent_requests = 20
+  addressing_style = path
+region = eu-west-1
+
+# trailing comment of legacy
+
+[profile other]
+region = ca-central-1
+s3 =
+  addressing_style = virtual
+
+[profile new]
+region    = us-east-1
+cli_pager =
+s3 =
+  addressing_style = path
+`
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() got:\n%s\nwant:\n%s", got, want)
+	}
+	if v, ok := f.Get("profile legacy", "s3.max_concurrent_requests"); !ok || v != "20" {
+		t.Errorf("Get(s3.max_concurrent_requests) got = %q, %v", v, ok)
+	}
+	if _, ok := f.Get("profile legacy", "s3.missing"); ok {
+		t.Error("Get() found a missing nested key")
+	}
+}
@@ -0,0 +1,200 @@
+package jumpcloud
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/utils"
+)
+
+const (
+	duoPath = "/userconsole/auth/duo"
+
+	// Duo Web frame API (traditional prompt)
+	duoAuthPath   = "/frame/web/v1/auth"
+	duoPromptPath = "/frame/prompt"
+	duoStatusPath = "/frame/status"
+	// duoFrameVersion version of the Duo Web SDK used by the console
+	duoFrameVersion = "2.6"
+	// duoDevice and duoFactor send a push to the default device of the user
+	duoDevice = "auto"
+	duoFactor = "Duo Push"
+)
+
+// Duo push results
+const (
+	duoResultSuccess = "SUCCESS"
+	duoResultFailure = "FAILURE"
+	// duoStatusTimeout status code of a push which wasn't answered
+	duoStatusTimeout = "timeout"
+)
+
+// duoAuthResponse Jumpcloud Duo authentication request of the user
+type duoAuthResponse struct {
+	APIHost    string `json:"api_host"`
+	SigRequest string `json:"sig_request"`
+}
+
+// duoResponse Duo frame API response
+type duoResponse struct {
+	Stat     string `json:"stat"`
+	Message  string `json:"message"`
+	Response struct {
+		TxID       string `json:"txid"`
+		StatusCode string `json:"status_code"`
+		Result     string `json:"result"`
+		ResultURL  string `json:"result_url"`
+		Cookie     string `json:"cookie"`
+	} `json:"response"`
+}
+
+// stateDuo send a Duo push and log in with the signed response of Duo when it is approved
+func (jc *JumpCloud) stateDuo(ctx context.Context, _ *authFlow) (authState, error) {
+	var duo duoAuthResponse
+	if err := jc.consoleRequest(ctx, http.MethodGet, duoPath, nil, &duo); err != nil {
+		return stateDone, fmt.Errorf("failed to start Duo authentication: %w", err)
+	}
+	// The request signed by JumpCloud is "TX|...:APP|...", Duo signs the TX part
+	tx, app, ok := strings.Cut(duo.SigRequest, ":")
+	if !ok || duo.APIHost == "" {
+		return stateDone, errors.New("failed to start Duo authentication: invalid Duo request")
+	}
+	duoURL := cmp.Or(jc.DuoURL, "https://"+duo.APIHost)
+
+	sid, err := jc.duoSession(ctx, duoURL, tx)
+	if err != nil {
+		return stateDone, fmt.Errorf("failed to start Duo authentication: %w", err)
+	}
+
+	prompt, err := jc.duoRequest(ctx, duoURL+duoPromptPath, url.Values{
+		"sid":    {sid},
+		"device": {duoDevice},
+		"factor": {duoFactor},
+	})
+	if err != nil {
+		return stateDone, fmt.Errorf("failed to send Duo push: %w", err)
+	}
+	if prompt.Response.TxID == "" {
+		return stateDone, errors.New("failed to send Duo push: empty transaction id")
+	}
+	if jc.OnPush != nil {
+		jc.OnPush(MFAMethodDuo)
+	}
+
+	resultURL, err := jc.waitDuoPush(ctx, duoURL, sid, prompt.Response.TxID)
+	if err != nil {
+		return stateDone, err
+	}
+	result, err := jc.duoRequest(ctx, duoURL+resultURL, url.Values{"sid": {sid}})
+	if err != nil {
+		return stateDone, fmt.Errorf("failed to get Duo response: %w", err)
+	}
+	if result.Response.Cookie == "" {
+		return stateDone, errors.New("failed to get Duo response: empty signature")
+	}
+
+	body, _ := json.Marshal(map[string]string{"sig_response": result.Response.Cookie + ":" + app})
+	if err := jc.consoleRequest(ctx, http.MethodPost, duoPath, body, nil); err != nil {
+		return stateDone, fmt.Errorf("failed to log in with Duo: %w", err)
+	}
+	return stateSAML, nil
+}
+
+// duoSession start the Duo frame with the transaction signed by JumpCloud and return its session id
+func (jc *JumpCloud) duoSession(ctx context.Context, duoURL, tx string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(jc.MaxRequestTimeout)*time.Second)
+	defer cancel()
+
+	parent := jc.ConsoleURL + "/userconsole/"
+	query := url.Values{"tx": {tx}, "parent": {parent}, "v": {duoFrameVersion}}
+	form := url.Values{"parent": {parent}}
+	resp, err := utils.Request(ctx, http.MethodPost, duoURL+duoAuthPath+"?"+query.Encode(), []byte(form.Encode()), duoHeaders(), nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return utils.GetHTMLInputValue(resp, "sid")
+}
+
+// waitDuoPush wait until the Duo push is approved and return the URL path of the result
+func (jc *JumpCloud) waitDuoPush(ctx context.Context, duoURL, sid, txid string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, jc.PushTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(jc.PushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", errors.New("Duo push was not approved in time")
+			}
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+
+		status, err := jc.duoRequest(ctx, duoURL+duoStatusPath, url.Values{"sid": {sid}, "txid": {txid}})
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return "", fmt.Errorf("failed to check Duo push status: %w", err)
+		}
+
+		switch status.Response.Result {
+		case duoResultSuccess:
+			if status.Response.ResultURL == "" {
+				return "", errors.New("failed to check Duo push status: empty result URL")
+			}
+			return status.Response.ResultURL, nil
+		case duoResultFailure:
+			if status.Response.StatusCode == duoStatusTimeout {
+				return "", errors.New("Duo push expired")
+			}
+			return "", errors.New("Duo push was denied")
+		}
+	}
+}
+
+// duoRequest post the form to the Duo frame API
+func (jc *JumpCloud) duoRequest(ctx context.Context, requestURL string, form url.Values) (duoResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(jc.MaxRequestTimeout)*time.Second)
+	defer cancel()
+
+	var res duoResponse
+	resp, err := utils.Request(ctx, http.MethodPost, requestURL, []byte(form.Encode()), duoHeaders(), nil)
+	if err != nil {
+		return res, err
+	}
+	respBody, err := utils.ReadHTTPResponseBody(resp)
+	if err != nil {
+		return res, err
+	}
+
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return res, fmt.Errorf("unexpected response with status %s", resp.Status)
+	}
+	if res.Stat != "OK" {
+		return res, errors.New(cmp.Or(res.Message, "unexpected status "+resp.Status))
+	}
+	return res, nil
+}
+
+// duoHeaders return headers of Duo frame API requests
+func duoHeaders() http.Header {
+	headers := http.Header{}
+	headers.Add("Accept", "application/json")
+	headers.Add("Content-Type", "application/x-www-form-urlencoded")
+	return headers
+}
@@ -0,0 +1,58 @@
+package jumpcloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
+)
+
+func TestGetSaml_Duo(t *testing.T) {
+	srv := newTestServer(t, []Factor{{Type: "duo", Status: "available"}}, pushStatusAccepted)
+
+	jc := newTestClient(t, srv, "", MFAMethodDuo)
+	var method string
+	jc.OnPush = func(m string) { method = m }
+	got, err := jc.GetSaml()
+	if err != nil || got != srv.SAMLResponse() || !jc.LoggedIn() {
+		t.Fatalf("GetSaml() got = %q, %v, logged in %v, want the IDP SAMLResponse", got, err, jc.LoggedIn())
+	}
+	if method != MFAMethodDuo || srv.Logins() != 1 {
+		t.Errorf("GetSaml() notified %q, %d logins, want duo and 1 login", method, srv.Logins())
+	}
+}
+
+func TestGetSaml_DuoTimeoutAndCancel(t *testing.T) {
+	srv := newTestServer(t, []Factor{{Type: "duo", Status: "available"}}, pushStatusPending)
+
+	jc := newTestClient(t, srv, "", MFAMethodDuo)
+	jc.PushTimeout = 50 * time.Millisecond
+	if _, err := jc.GetSaml(); err == nil || err.Error() != "Duo push was not approved in time" {
+		t.Errorf("GetSaml() error = %v, want timeout", err)
+	}
+
+	jc = newTestClient(t, srv, "", MFAMethodDuo)
+	ctx, cancel := context.WithCancel(context.Background())
+	jc.OnPush = func(string) { cancel() }
+	if _, err := jc.GetSamlContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetSamlContext() error = %v, want context.Canceled", err)
+	}
+	if srv.Logins() != 0 {
+		t.Errorf("GetSaml() made %d logins, want none without approval", srv.Logins())
+	}
+}
+
+func TestGetSaml_DuoInvalidRequest(t *testing.T) {
+	srv := newTestServer(t, []Factor{{Type: "duo", Status: "available"}}, pushStatusAccepted)
+
+	// The Duo frame doesn't know the transaction of another server
+	other := jumpcloudtest.NewServer()
+	defer other.Close()
+	jc := newTestClient(t, srv, "", MFAMethodDuo)
+	jc.DuoURL = other.URL
+	if _, err := jc.GetSaml(); err == nil || srv.Logins() != 0 || other.Pushes() != 0 {
+		t.Errorf("GetSaml() error = %v, %d logins, %d pushes, want failure before the push", err, srv.Logins(), other.Pushes())
+	}
+}
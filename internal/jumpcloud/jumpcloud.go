@@ -6,18 +6,59 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/yousysadmin/jc2aws/internal/utils"
 )
 
 const (
-	xsrfURL              = "https://console.jumpcloud.com/userconsole/xsrf"
-	authURL              = "https://console.jumpcloud.com/userconsole/auth"
+	// DefaultConsoleURL JumpCloud console URL used when ConsoleURL is empty
+	DefaultConsoleURL    = "https://console.jumpcloud.com"
+	xsrfPath             = "/userconsole/xsrf"
+	authPath             = "/userconsole/auth"
+	pushPath             = "/userconsole/auth/push"
 	MaxRequestTimeout    = 10
 	MaxConnectionTimeout = 30
+
+	// DefaultPushTimeout time to wait for a push notification to be approved
+	DefaultPushTimeout = 2 * time.Minute
+	// DefaultPushInterval delay between push approval status checks
+	DefaultPushInterval = 2 * time.Second
+
+	// MaxClockSkew clock skew to the JumpCloud server above which TOTP tokens
+	// are generated with the server time, the Date header has 1 second precision
+	MaxClockSkew = 5 * time.Second
+)
+
+// MFA methods
+const (
+	// MFAMethodAuto use the TOTP token if it is set, otherwise the only other available factor
+	MFAMethodAuto = "auto"
+	MFAMethodTOTP = "totp"
+	MFAMethodPush = "push"
+	MFAMethodDuo  = "duo"
+)
+
+// MFAMethods list of supported MFA methods
+var MFAMethods = []string{MFAMethodAuto, MFAMethodTOTP, MFAMethodPush, MFAMethodDuo}
+
+// ErrSessionExpired is returned with SessionOnly when the Session is missing or expired
+var ErrSessionExpired = errors.New("JumpCloud session expired")
+
+// Push notification statuses
+const (
+	pushStatusPending  = "pending"
+	pushStatusAccepted = "accepted"
+	pushStatusDenied   = "denied"
+	pushStatusExpired  = "expired"
 )
 
+// factorStatusAvailable status of factors the user can use
+const factorStatusAvailable = "available"
+
 // xsfrResponse Jumpcloud XSRF respose structure
 type xsfrResponse struct {
 	Token string `json:"xsrf"`
@@ -30,15 +71,43 @@ type authRequest struct {
 	Otp      string `json:"otp"`
 }
 
+// Factor MFA factor of the user
+type Factor struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
 // authResponse Jumpcloud Auth response
 // MFA require response '{"factors":[{"type":"totp","status":"available"}],"message":"MFA required."}'
 // Auth failed response: '{"message":"Authentication failed."}'
 type authResponse struct {
-	Message string `json:"message"`
-	Factors []struct {
-		Type   string `json:"type"`
-		Status string `json:"status"`
-	} `json:"factors"`
+	Message string   `json:"message"`
+	Factors []Factor `json:"factors"`
+}
+
+// pushResponse Jumpcloud push notification response
+type pushResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// MFARequiredError is returned when MFA is required and the factor can't be
+// chosen automatically: no TOTP token is set and there is no other single factor.
+type MFARequiredError struct {
+	// Factors available for the user
+	Factors []Factor
+}
+
+func (e *MFARequiredError) Error() string {
+	if len(e.Factors) == 0 {
+		return "MFA required"
+	}
+	return "MFA required, available factors: " + strings.Join(factorTypes(e.Factors), ", ")
+}
+
+// Methods return supported MFA methods which can be used without a TOTP token
+func (e *MFARequiredError) Methods() []string {
+	return tokenlessMethods(e.Factors)
 }
 
 type JumpCloud struct {
@@ -50,18 +119,76 @@ type JumpCloud struct {
 	IdpURL string
 	// Jumpcloud user MFA token (optional)
 	MFAToken string
+	// MFATokenFunc generate the MFA token when logging in without MFAToken (optional),
+	// skew is the clock skew to the JumpCloud server if it is above MaxClockSkew, otherwise 0
+	MFATokenFunc func(skew time.Duration) (string, error)
+	// MFAMethod MFA factor to use (MFAMethodAuto if empty)
+	MFAMethod string
+	// ConsoleURL Jumpcloud console URL (DefaultConsoleURL if empty),
+	// e.g. the EU region console, a proxy or a fake server in tests
+	ConsoleURL string
+	// DuoURL Duo API URL (https:// and the Duo API host of the user if empty), e.g. a fake server in tests
+	DuoURL string
 
 	// Maximal connection timeout for all reqest
 	MaxConnectionTimeout int
 	// Maximal request timeout for all request
 	MaxRequestTimeout int
+	// PushTimeout time to wait for a push notification (JumpCloud Protect or Duo) to be approved
+	PushTimeout time.Duration
+	// PushInterval delay between push approval status checks
+	PushInterval time.Duration
+	// OnPush is called with the MFA method (push or duo) when a push notification was sent (optional)
+	OnPush func(method string)
+	// Session cookies of a previous login (optional), tried before logging in
+	Session []*http.Cookie
+	// SessionOnly return ErrSessionExpired instead of logging in when the Session is rejected,
+	// e.g. when the MFA token was already used for the login of the Session
+	SessionOnly bool
 
 	// Coockies store
 	cookies []*http.Cookie
 	// XSRF token
 	xsrf string
+	// loggedIn the last GetSaml logged in instead of reusing the session
+	loggedIn bool
+	// clockSkew offset of the JumpCloud server clock to the local clock
+	clockSkew time.Duration
 }
 
+// authState step of the authentication flow
+type authState int
+
+const (
+	stateSession authState = iota
+	stateXSRF
+	stateLogin
+	stateMFA
+	stateTOTP
+	statePush
+	stateDuo
+	stateSAML
+	stateDone
+)
+
+// factorStates states handling MFA factors, add a factor here and in handlers
+var factorStates = map[string]authState{
+	MFAMethodTOTP: stateTOTP,
+	MFAMethodPush: statePush,
+	MFAMethodDuo:  stateDuo,
+}
+
+// authFlow data of the authentication in progress
+type authFlow struct {
+	// factors available for the user
+	factors []Factor
+	// samlResponse result of the flow
+	samlResponse string
+}
+
+// stateHandler run the step and return the next one
+type stateHandler func(ctx context.Context, flow *authFlow) (authState, error)
+
 // New Init new jc client
 func New(email, password, idpURL, mfaToken string) (JumpCloud, error) {
 	config := JumpCloud{
@@ -85,6 +212,13 @@ func NewWithConfig(config JumpCloud) (JumpCloud, error) {
 		return config, errors.New("email, password, idpurl can't be blank")
 	}
 
+	if config.MFAMethod == "" {
+		config.MFAMethod = MFAMethodAuto
+	}
+	if !slices.Contains(MFAMethods, config.MFAMethod) {
+		return config, fmt.Errorf("unsupported MFA method %q, use one of: %s", config.MFAMethod, strings.Join(MFAMethods, ", "))
+	}
+
 	if config.MaxRequestTimeout == 0 {
 		config.MaxRequestTimeout = MaxRequestTimeout
 	}
@@ -93,86 +227,402 @@ func NewWithConfig(config JumpCloud) (JumpCloud, error) {
 		config.MaxConnectionTimeout = MaxConnectionTimeout
 	}
 
+	if config.PushTimeout == 0 {
+		config.PushTimeout = DefaultPushTimeout
+	}
+
+	if config.PushInterval == 0 {
+		config.PushInterval = DefaultPushInterval
+	}
+
+	config.ConsoleURL = strings.TrimSuffix(config.ConsoleURL, "/")
+	if config.ConsoleURL == "" {
+		config.ConsoleURL = DefaultConsoleURL
+	}
+	config.DuoURL = strings.TrimSuffix(config.DuoURL, "/")
+
 	return config, nil
 }
 
 // GetSaml get SAML data
 func (jc *JumpCloud) GetSaml() (samlResponse string, err error) {
+	return jc.GetSamlContext(context.Background())
+}
+
+// GetSamlContext get SAML data, waiting for a push approval can be cancelled with the context
+func (jc *JumpCloud) GetSamlContext(ctx context.Context) (samlResponse string, err error) {
+	handlers := map[authState]stateHandler{
+		stateSession: jc.stateSession,
+		stateXSRF:    jc.stateXSRF,
+		stateLogin:   jc.stateLogin,
+		stateMFA:     jc.stateMFA,
+		stateTOTP:    jc.stateTOTP,
+		statePush:    jc.statePush,
+		stateDuo:     jc.stateDuo,
+		stateSAML:    jc.stateSAML,
+	}
+
+	jc.loggedIn = false
+	flow := &authFlow{}
+	for state := stateSession; state != stateDone; {
+		if state, err = handlers[state](ctx, flow); err != nil {
+			return "", err
+		}
+	}
+
+	return flow.samlResponse, nil
+}
+
+// stateSession get SAML response with the saved session, log in if there is no session or it expired
+func (jc *JumpCloud) stateSession(ctx context.Context, flow *authFlow) (authState, error) {
+	jc.cookies = nil
+	for _, c := range jc.Session {
+		if c.Expires.IsZero() || c.Expires.After(time.Now()) {
+			jc.cookies = append(jc.cookies, c)
+		}
+	}
+	if len(jc.cookies) > 0 {
+		if _, err := jc.stateSAML(ctx, flow); err == nil {
+			return stateDone, nil
+		}
+		// JumpCloud shows the login page without SAMLResponse when the session expired
+		jc.cookies = nil
+	}
+
+	if jc.SessionOnly {
+		return stateDone, ErrSessionExpired
+	}
+	return stateXSRF, nil
+}
+
+// stateXSRF get XSRF token and session cookies
+func (jc *JumpCloud) stateXSRF(ctx context.Context, _ *authFlow) (authState, error) {
+	jc.loggedIn = true
+	if err := jc.getXSRFToken(ctx); err != nil {
+		return stateDone, err
+	}
+	return stateLogin, nil
+}
+
+// stateLogin authenticate with the password, and the TOTP token if it is set
+func (jc *JumpCloud) stateLogin(ctx context.Context, flow *authFlow) (authState, error) {
+	otp := ""
+	if jc.MFAMethod == MFAMethodAuto || jc.MFAMethod == MFAMethodTOTP {
+		if jc.MFAToken == "" && jc.MFATokenFunc != nil {
+			skew := jc.clockSkew
+			if skew.Abs() <= MaxClockSkew {
+				skew = 0
+			}
+			token, err := jc.MFATokenFunc(skew)
+			if err != nil {
+				return stateDone, err
+			}
+			jc.MFAToken = token
+		}
+		otp = jc.MFAToken
+	}
+
+	ok, res, err := jc.auth(ctx, otp)
+	switch {
+	case err != nil:
+		return stateDone, err
+	case ok:
+		return stateSAML, nil
+	case len(res.Factors) > 0 && otp == "":
+		flow.factors = res.Factors
+		return stateMFA, nil
+	default:
+		return stateDone, errors.New(res.Message)
+	}
+}
+
+// stateMFA choose the MFA factor
+func (jc *JumpCloud) stateMFA(_ context.Context, flow *authFlow) (authState, error) {
+	available := availableFactors(flow.factors)
+
+	method := jc.MFAMethod
+	if method == MFAMethodAuto {
+		method = jc.autoFactor(available)
+		if method == "" {
+			return stateDone, &MFARequiredError{Factors: available}
+		}
+	}
+
+	if !slices.Contains(factorTypes(available), method) {
+		return stateDone, fmt.Errorf("MFA method %s is not available, available factors: %s",
+			method, strings.Join(factorTypes(available), ", "))
+	}
+
+	state, ok := factorStates[method]
+	if !ok {
+		return stateDone, fmt.Errorf("MFA method %s is not supported yet, use totp, push or duo", method)
+	}
+	return state, nil
+}
+
+// autoFactor return the TOTP factor if the token is set, otherwise the only available factor
+// which doesn't need a token, or an empty string if there is no such factor
+func (jc *JumpCloud) autoFactor(available []Factor) string {
+	if jc.MFAToken != "" {
+		return MFAMethodTOTP
+	}
+
+	candidates := tokenlessMethods(available)
+	if len(candidates) != 1 {
+		return ""
+	}
+	return candidates[0]
+}
+
+// stateTOTP authenticate with the TOTP token
+func (jc *JumpCloud) stateTOTP(ctx context.Context, flow *authFlow) (authState, error) {
+	if jc.MFAToken == "" {
+		return stateDone, &MFARequiredError{Factors: availableFactors(flow.factors)}
+	}
+
+	ok, res, err := jc.auth(ctx, jc.MFAToken)
+	if err != nil {
+		return stateDone, err
+	}
+	if !ok {
+		return stateDone, errors.New(res.Message)
+	}
+	return stateSAML, nil
+}
 
-	if err = jc.getXSRFToken(); err != nil {
-		return "", err
+// statePush send a push notification and wait until it is approved
+func (jc *JumpCloud) statePush(ctx context.Context, _ *authFlow) (authState, error) {
+	push, err := jc.pushRequest(ctx, http.MethodPost, pushPath)
+	if err != nil {
+		return stateDone, fmt.Errorf("failed to send push notification: %w", err)
+	}
+	if push.ID == "" {
+		return stateDone, errors.New("failed to send push notification: empty notification id")
+	}
+	if jc.OnPush != nil {
+		jc.OnPush(MFAMethodPush)
 	}
 
-	if err = jc.auth(); err != nil {
-		return "", err
+	ctx, cancel := context.WithTimeout(ctx, jc.PushTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(jc.PushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return stateDone, errors.New("push notification was not approved in time")
+			}
+			return stateDone, ctx.Err()
+		case <-ticker.C:
+		}
+
+		status, err := jc.pushRequest(ctx, http.MethodGet, pushPath+"/"+url.PathEscape(push.ID))
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return stateDone, fmt.Errorf("failed to check push notification status: %w", err)
+		}
+
+		switch strings.ToLower(status.Status) {
+		case pushStatusAccepted:
+			if _, err := jc.pushRequest(ctx, http.MethodPost, pushPath+"/"+url.PathEscape(push.ID)+"/login"); err != nil {
+				return stateDone, fmt.Errorf("failed to log in with push notification: %w", err)
+			}
+			return stateSAML, nil
+		case pushStatusDenied:
+			return stateDone, errors.New("push notification was denied")
+		case pushStatusExpired:
+			return stateDone, errors.New("push notification expired")
+		}
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(jc.MaxRequestTimeout)*time.Second)
+// stateSAML get SAML response from the IDP URL
+func (jc *JumpCloud) stateSAML(ctx context.Context, flow *authFlow) (authState, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(jc.MaxRequestTimeout)*time.Second)
 	defer cancel()
 
 	resp, err := utils.Request(ctx, http.MethodGet, jc.IdpURL, nil, nil, jc.cookies)
 	if err != nil {
-		return "", fmt.Errorf("failed to request IDP URL: %w", err)
+		return stateDone, fmt.Errorf("failed to request IDP URL: %w", err)
 	}
+	jc.addCookies(resp.Cookies())
 
-	samlResponse, err = utils.GetHTMLInputValue(resp, "SAMLResponse")
+	samlResponse, err := utils.GetHTMLInputValue(resp, "SAMLResponse")
 	if err != nil {
-		return "", fmt.Errorf("fail to get saml response: %s", err)
+		return stateDone, fmt.Errorf("fail to get saml response: %s", err)
 	}
 
-	return samlResponse, nil
+	flow.samlResponse = samlResponse
+	return stateDone, nil
 }
 
-// auth authenticate in the Jumpcloud
-func (jc *JumpCloud) auth() error {
+// Cookies return session cookies after GetSaml, to be passed as Session next time
+func (jc *JumpCloud) Cookies() []*http.Cookie {
+	return slices.Clone(jc.cookies)
+}
+
+// LoggedIn report whether the last GetSaml logged in with the credentials
+// instead of reusing the Session
+func (jc *JumpCloud) LoggedIn() bool {
+	return jc.loggedIn
+}
+
+// auth authenticate in the Jumpcloud, ok is false when Jumpcloud rejected the request
+func (jc *JumpCloud) auth(ctx context.Context, otp string) (ok bool, responseData authResponse, err error) {
 	authRequestData, _ := json.Marshal(authRequest{
 		Email:    jc.Email,
 		Password: jc.Password,
-		Otp:      jc.MFAToken},
+		Otp:      otp},
 	)
 
-	headers := http.Header{}
-	headers.Add("Accept", "application/json")
-	headers.Add("Content-Type", "application/json")
-	headers.Add("X-Xsrftoken", jc.xsrf)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(jc.MaxRequestTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(jc.MaxRequestTimeout)*time.Second)
 	defer cancel()
 
-	resp, err := utils.Request(ctx, http.MethodPost, authURL, authRequestData, headers, jc.cookies)
+	resp, err := utils.Request(ctx, http.MethodPost, jc.ConsoleURL+authPath, authRequestData, jc.headers(), jc.cookies)
 	if err != nil {
-		return err
+		return false, responseData, err
 	}
+	jc.addCookies(resp.Cookies())
 
 	// Unmarshal response message
-	var responseData authResponse
-
 	respBody, err := utils.ReadHTTPResponseBody(resp)
 	if err != nil {
-		return err
+		return false, responseData, err
 	}
 
 	if err := json.Unmarshal(respBody, &responseData); err != nil {
+		return false, responseData, err
+	}
+
+	return resp.StatusCode == http.StatusOK, responseData, nil
+}
+
+// pushRequest make a request to the push notification API
+func (jc *JumpCloud) pushRequest(ctx context.Context, method, path string) (pushResponse, error) {
+	var body []byte
+	if method == http.MethodPost {
+		body = []byte("{}")
+	}
+
+	var push pushResponse
+	err := jc.consoleRequest(ctx, method, path, body, &push)
+	return push, err
+}
+
+// consoleRequest make a request to the JSON API of the console, the response is decoded into v
+func (jc *JumpCloud) consoleRequest(ctx context.Context, method, path string, body []byte, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(jc.MaxRequestTimeout)*time.Second)
+	defer cancel()
+
+	resp, err := utils.Request(ctx, method, jc.ConsoleURL+path, body, jc.headers(), jc.cookies)
+	if err != nil {
+		return err
+	}
+	jc.addCookies(resp.Cookies())
+
+	respBody, err := utils.ReadHTTPResponseBody(resp)
+	if err != nil {
 		return err
 	}
 
-	if resp.StatusCode != 200 {
-		return errors.New(responseData.Message)
+	if resp.StatusCode != http.StatusOK {
+		var res authResponse
+		if json.Unmarshal(respBody, &res) == nil && res.Message != "" {
+			return errors.New(res.Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
 	}
 
+	if len(respBody) > 0 && v != nil {
+		return json.Unmarshal(respBody, v)
+	}
 	return nil
 }
 
+// headers return headers of JSON API requests
+func (jc *JumpCloud) headers() http.Header {
+	headers := http.Header{}
+	headers.Add("Accept", "application/json")
+	headers.Add("Content-Type", "application/json")
+	headers.Add("X-Xsrftoken", jc.xsrf)
+	return headers
+}
+
+// addCookies store cookies set by a response, replacing cookies with the same name
+func (jc *JumpCloud) addCookies(cookies []*http.Cookie) {
+	for _, c := range cookies {
+		jc.cookies = slices.DeleteFunc(jc.cookies, func(old *http.Cookie) bool { return old.Name == c.Name })
+		jc.cookies = append(jc.cookies, c)
+	}
+}
+
+// tokenlessMethods return supported MFA methods of the factors which don't need a TOTP token
+func tokenlessMethods(factors []Factor) []string {
+	var methods []string
+	for _, t := range factorTypes(factors) {
+		if _, ok := factorStates[t]; ok && t != MFAMethodTOTP {
+			methods = append(methods, t)
+		}
+	}
+	return methods
+}
+
+// availableFactors return factors the user can use
+func availableFactors(factors []Factor) []Factor {
+	var available []Factor
+	for _, f := range factors {
+		if f.Status == "" || f.Status == factorStatusAvailable {
+			available = append(available, f)
+		}
+	}
+	return available
+}
+
+// factorTypes return types of the factors
+func factorTypes(factors []Factor) []string {
+	types := make([]string, 0, len(factors))
+	for _, f := range factors {
+		types = append(types, f.Type)
+	}
+	return types
+}
+
+// ClockSkew return the offset of the JumpCloud server clock to the local clock measured
+// by the last login, positive when the local clock is behind
+func (jc *JumpCloud) ClockSkew() time.Duration {
+	return jc.clockSkew
+}
+
+// clockSkew estimate the offset of the server clock from the Date header of a response to a
+// request sent at start and received at end, 0 if the header is missing or invalid
+func clockSkew(date string, start, end time.Time) time.Duration {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0
+	}
+	// The Date header is truncated to seconds and generated halfway through the request
+	serverTime = serverTime.Add(500 * time.Millisecond)
+	localTime := start.Add(end.Sub(start) / 2)
+	return serverTime.Sub(localTime).Round(time.Second)
+}
+
 // getXSRFToken get XSRF token from Jumpcloud
-func (jc *JumpCloud) getXSRFToken() error {
+func (jc *JumpCloud) getXSRFToken(ctx context.Context) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(jc.MaxRequestTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(jc.MaxRequestTimeout)*time.Second)
 	defer cancel()
 
-	resp, err := utils.Request(ctx, http.MethodGet, xsrfURL, nil, nil, nil)
+	start := time.Now()
+	resp, err := utils.Request(ctx, http.MethodGet, jc.ConsoleURL+xsrfPath, nil, nil, nil)
 	if err != nil {
 		return err
 	}
+	jc.clockSkew = clockSkew(resp.Header.Get("Date"), start, time.Now())
 
 	var xsrf xsfrResponse
 	respBody, err := utils.ReadHTTPResponseBody(resp)
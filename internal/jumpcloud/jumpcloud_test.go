@@ -1,8 +1,14 @@
 package jumpcloud
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud/jumpcloudtest"
 )
 
 func TestNew(t *testing.T) {
@@ -276,3 +282,298 @@ func TestXSRFResponseParsing(t *testing.T) {
 		})
 	}
 }
+
+// newTestServer fake Jumpcloud with the given MFA factors, TOTP code is 123456.
+// Push notifications get pushStatus after the first status check.
+func newTestServer(t *testing.T, factors []Factor, pushStatus string) *jumpcloudtest.Server {
+	t.Helper()
+	srv := jumpcloudtest.NewUnstartedServer()
+	for _, f := range factors {
+		srv.Factors = append(srv.Factors, jumpcloudtest.Factor{Type: f.Type, Status: f.Status})
+	}
+	if len(factors) > 0 {
+		srv.TOTP = "123456"
+	}
+	srv.PushStatus = pushStatus
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestClient client of the fake server
+func newTestClient(t *testing.T, srv *jumpcloudtest.Server, mfaToken, method string) JumpCloud {
+	t.Helper()
+	jc, err := NewWithConfig(JumpCloud{
+		Email:        jumpcloudtest.DefaultEmail,
+		Password:     jumpcloudtest.DefaultPassword,
+		IdpURL:       srv.IdpURL(),
+		MFAToken:     mfaToken,
+		MFAMethod:    method,
+		PushInterval: 10 * time.Millisecond,
+		ConsoleURL:   srv.URL + "/",
+		DuoURL:       srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig() error = %v", err)
+	}
+	return jc
+}
+
+func TestGetSaml(t *testing.T) {
+	totp := []Factor{{Type: "totp", Status: "available"}}
+	totpPush := []Factor{{Type: "totp", Status: "available"}, {Type: "push", Status: "available"}}
+	totpDuo := []Factor{{Type: "totp", Status: "available"}, {Type: "duo", Status: "available"}}
+
+	tests := []struct {
+		name       string
+		factors    []Factor
+		pushStatus string
+		mfaToken   string
+		method     string
+		wantErr    string
+		wantPushes int
+	}{
+		{name: "no MFA", method: MFAMethodAuto},
+		{name: "TOTP", factors: totp, mfaToken: "123456", method: MFAMethodAuto},
+		{name: "TOTP method", factors: totpPush, mfaToken: "123456", method: MFAMethodTOTP},
+		{name: "wrong TOTP", factors: totp, mfaToken: "000000", method: MFAMethodAuto, wantErr: "Authentication failed."},
+		{name: "missing TOTP", factors: totp, method: MFAMethodAuto, wantErr: "MFA required, available factors: totp"},
+		{name: "auto push", factors: totpPush, pushStatus: pushStatusAccepted, method: MFAMethodAuto, wantPushes: 1},
+		{name: "push method", factors: totpPush, pushStatus: pushStatusAccepted, mfaToken: "123456", method: MFAMethodPush, wantPushes: 1},
+		{name: "push denied", factors: totpPush, pushStatus: pushStatusDenied, method: MFAMethodPush, wantErr: "push notification was denied", wantPushes: 1},
+		{name: "push expired", factors: totpPush, pushStatus: pushStatusExpired, method: MFAMethodPush, wantErr: "push notification expired", wantPushes: 1},
+		{name: "push not available", factors: totp, method: MFAMethodPush, wantErr: "MFA method push is not available, available factors: totp"},
+		{name: "auto push or duo", factors: append(totpDuo, Factor{Type: "push", Status: "available"}), method: MFAMethodAuto, wantErr: "MFA required, available factors: totp, duo, push"},
+		{name: "auto duo", factors: []Factor{{Type: "duo", Status: "available"}}, pushStatus: pushStatusAccepted, method: MFAMethodAuto, wantPushes: 1},
+		{name: "duo method", factors: totpDuo, pushStatus: pushStatusAccepted, mfaToken: "123456", method: MFAMethodDuo, wantPushes: 1},
+		{name: "duo denied", factors: totpDuo, pushStatus: pushStatusDenied, method: MFAMethodDuo, wantErr: "Duo push was denied", wantPushes: 1},
+		{name: "duo expired", factors: totpDuo, pushStatus: pushStatusExpired, method: MFAMethodDuo, wantErr: "Duo push expired", wantPushes: 1},
+		{name: "duo not available", factors: totpPush, method: MFAMethodDuo, wantErr: "MFA method duo is not available, available factors: totp, push"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tt.factors, tt.pushStatus)
+
+			jc := newTestClient(t, srv, tt.mfaToken, tt.method)
+			var notified bool
+			jc.OnPush = func(string) { notified = true }
+
+			got, err := jc.GetSaml()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("GetSaml() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || got != srv.SAMLResponse() {
+				t.Errorf("GetSaml() got = %q, %v, want the IDP SAMLResponse", got, err)
+			}
+
+			if srv.Pushes() != tt.wantPushes || notified != (tt.wantPushes > 0) {
+				t.Errorf("GetSaml() sent %d push notifications (notified %v), want %d", srv.Pushes(), notified, tt.wantPushes)
+			}
+		})
+	}
+}
+
+func TestGetSaml_MFARequiredError(t *testing.T) {
+	srv := newTestServer(t, []Factor{
+		{Type: "totp", Status: "available"},
+		{Type: "webauthn", Status: "available"},
+		{Type: "push", Status: "unavailable"},
+	}, "")
+
+	jc := newTestClient(t, srv, "", MFAMethodAuto)
+	_, err := jc.GetSaml()
+
+	mfaErr, ok := errors.AsType[*MFARequiredError](err)
+	if !ok {
+		t.Fatalf("GetSaml() error = %v, want MFARequiredError", err)
+	}
+	if got := strings.Join(factorTypes(mfaErr.Factors), ","); got != "totp,webauthn" {
+		t.Errorf("MFARequiredError factors got = %v, want available factors", got)
+	}
+	if got := mfaErr.Methods(); len(got) != 0 {
+		t.Errorf("MFARequiredError.Methods() got = %v, want no methods without a token", got)
+	}
+
+	mfaErr = &MFARequiredError{Factors: []Factor{{Type: "totp"}, {Type: "push"}, {Type: "webauthn"}, {Type: "duo"}}}
+	if got := strings.Join(mfaErr.Methods(), ","); got != "push,duo" {
+		t.Errorf("MFARequiredError.Methods() got = %v, want supported methods without a token", got)
+	}
+}
+
+func TestGetSaml_PushTimeoutAndCancel(t *testing.T) {
+	srv := newTestServer(t, []Factor{{Type: "push", Status: "available"}}, pushStatusPending)
+
+	jc := newTestClient(t, srv, "", MFAMethodPush)
+	jc.PushTimeout = 50 * time.Millisecond
+	if _, err := jc.GetSaml(); err == nil || err.Error() != "push notification was not approved in time" {
+		t.Errorf("GetSaml() error = %v, want timeout", err)
+	}
+
+	jc = newTestClient(t, srv, "", MFAMethodPush)
+	ctx, cancel := context.WithCancel(context.Background())
+	jc.OnPush = func(string) { cancel() }
+	if _, err := jc.GetSamlContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetSamlContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestNewWithConfig_MFAMethod(t *testing.T) {
+	jc, err := NewWithConfig(JumpCloud{Email: "e", Password: "p", IdpURL: "u"})
+	if err != nil || jc.MFAMethod != MFAMethodAuto {
+		t.Errorf("NewWithConfig() MFAMethod got = %q, %v, want %q", jc.MFAMethod, err, MFAMethodAuto)
+	}
+	if _, err := NewWithConfig(JumpCloud{Email: "e", Password: "p", IdpURL: "u", MFAMethod: "sms"}); err == nil {
+		t.Error("NewWithConfig() expected error for unsupported MFA method")
+	}
+}
+
+func TestGetSaml_ReuseSession(t *testing.T) {
+	srv := newTestServer(t, []Factor{{Type: "totp", Status: "available"}}, "")
+
+	jc := newTestClient(t, srv, "123456", MFAMethodAuto)
+	if _, err := jc.GetSaml(); err != nil || !jc.LoggedIn() {
+		t.Fatalf("GetSaml() error = %v, logged in %v, want login", err, jc.LoggedIn())
+	}
+	session := jc.Cookies()
+
+	// A new client with the saved session doesn't post the credentials again
+	jc = newTestClient(t, srv, "", MFAMethodAuto)
+	jc.Session = session
+	got, err := jc.GetSaml()
+	if err != nil || got != srv.SAMLResponse() || jc.LoggedIn() || srv.Logins() != 1 {
+		t.Errorf("GetSaml() got = %q, %v, logged in %v, %d logins, want the saved session reused", got, err, jc.LoggedIn(), srv.Logins())
+	}
+
+	// Expired cookies are not sent
+	expired := newTestClient(t, srv, "123456", MFAMethodAuto)
+	for _, c := range session {
+		c := *c
+		c.Expires = time.Now().Add(-time.Minute)
+		expired.Session = append(expired.Session, &c)
+	}
+	if _, err := expired.GetSaml(); err != nil || !expired.LoggedIn() || srv.Logins() != 2 {
+		t.Errorf("GetSaml() error = %v, logged in %v, %d logins, want login with expired cookies", err, expired.LoggedIn(), srv.Logins())
+	}
+
+	// Session expired on the server: fall back to the login
+	srv.ExpireSessions()
+	jc = newTestClient(t, srv, "123456", MFAMethodAuto)
+	jc.Session = session
+	if got, err := jc.GetSaml(); err != nil || got != srv.SAMLResponse() || !jc.LoggedIn() || srv.Logins() != 3 {
+		t.Errorf("GetSaml() got = %q, %v, logged in %v, %d logins, want login after the session expired", got, err, jc.LoggedIn(), srv.Logins())
+	}
+}
+
+func TestGetSaml_SessionOnly(t *testing.T) {
+	srv := newTestServer(t, []Factor{{Type: "totp", Status: "available"}}, "")
+
+	jc := newTestClient(t, srv, "123456", MFAMethodAuto)
+	if _, err := jc.GetSaml(); err != nil {
+		t.Fatalf("GetSaml() error = %v", err)
+	}
+	session := jc.Cookies()
+
+	jc.Session = session
+	jc.SessionOnly = true
+	if got, err := jc.GetSaml(); err != nil || got != srv.SAMLResponse() || jc.LoggedIn() {
+		t.Errorf("GetSaml() got = %q, %v, logged in %v, want the session reused", got, err, jc.LoggedIn())
+	}
+
+	// The used TOTP token isn't sent again when the session expired
+	srv.ExpireSessions()
+	if _, err := jc.GetSaml(); !errors.Is(err, ErrSessionExpired) || srv.Logins() != 1 {
+		t.Errorf("GetSaml() error = %v, %d logins, want ErrSessionExpired without login", err, srv.Logins())
+	}
+	jc.Session = nil
+	if _, err := jc.GetSaml(); !errors.Is(err, ErrSessionExpired) || srv.Logins() != 1 {
+		t.Errorf("GetSaml() error = %v, %d logins, want ErrSessionExpired without a session", err, srv.Logins())
+	}
+}
+
+func TestGetSaml_MFATokenFunc(t *testing.T) {
+	srv := jumpcloudtest.NewUnstartedServer()
+	srv.TOTP = "654321"
+	srv.ClockSkew = 2 * time.Minute
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	var calls []time.Duration
+	jc := newTestClient(t, srv, "", MFAMethodAuto)
+	jc.MFATokenFunc = func(skew time.Duration) (string, error) {
+		calls = append(calls, skew)
+		return "654321", nil
+	}
+	if _, err := jc.GetSaml(); err != nil {
+		t.Fatalf("GetSaml() error = %v", err)
+	}
+	if len(calls) != 1 || (calls[0]-2*time.Minute).Abs() > 2*time.Second {
+		t.Errorf("MFATokenFunc calls = %v, want one call with the 2m clock skew", calls)
+	}
+	if (jc.ClockSkew() - 2*time.Minute).Abs() > 2*time.Second {
+		t.Errorf("ClockSkew() = %s, want about 2m", jc.ClockSkew())
+	}
+
+	// The token isn't generated when the saved session is reused
+	session := jc.Cookies()
+	jc = newTestClient(t, srv, "", MFAMethodAuto)
+	jc.Session = session
+	jc.MFATokenFunc = func(time.Duration) (string, error) {
+		return "", errors.New("unexpected MFA token request")
+	}
+	if _, err := jc.GetSaml(); err != nil {
+		t.Errorf("GetSaml() with session error = %v", err)
+	}
+
+	// Errors of the generator stop the login
+	jc = newTestClient(t, srv, "", MFAMethodTOTP)
+	jc.MFATokenFunc = func(time.Duration) (string, error) {
+		return "", errors.New("code already used")
+	}
+	if _, err := jc.GetSaml(); err == nil || err.Error() != "code already used" {
+		t.Errorf("GetSaml() error = %v, want the generator error", err)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(200 * time.Millisecond)
+
+	tests := []struct {
+		name string
+		date string
+		want time.Duration
+	}{
+		{"in sync", "Thu, 01 Jan 2026 12:00:00 GMT", 0},
+		{"server ahead", "Thu, 01 Jan 2026 12:01:30 GMT", 90 * time.Second},
+		{"server behind", "Thu, 01 Jan 2026 11:58:00 GMT", -2 * time.Minute},
+		{"missing header", "", 0},
+		{"invalid header", "yesterday", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clockSkew(tt.date, start, end); got != tt.want {
+				t.Errorf("clockSkew() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSaml_SmallClockSkewIgnored(t *testing.T) {
+	srv := jumpcloudtest.NewUnstartedServer()
+	srv.TOTP = "654321"
+	srv.ClockSkew = 2 * time.Second
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	jc := newTestClient(t, srv, "", MFAMethodAuto)
+	jc.MFATokenFunc = func(skew time.Duration) (string, error) {
+		if skew != 0 {
+			t.Errorf("MFATokenFunc skew = %s, want 0 below MaxClockSkew", skew)
+		}
+		return "654321", nil
+	}
+	if _, err := jc.GetSaml(); err != nil {
+		t.Fatalf("GetSaml() error = %v", err)
+	}
+}
@@ -0,0 +1,533 @@
+// Package jumpcloudtest provides a fake JumpCloud user console and SSO
+// application (IDP) for offline tests, in the spirit of net/http/httptest.
+//
+//	jc := jumpcloudtest.NewUnstartedServer()
+//	jc.TOTP = "123456"
+//	jc.Start()
+//	defer jc.Close()
+//
+// Clients use jc.URL as the console URL and jc.IdpURL() as the IDP URL.
+// The server serves the Duo frame API too, clients use jc.URL as the Duo URL.
+package jumpcloudtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEmail and DefaultPassword valid credentials of a new server
+	DefaultEmail    = "user@example.com"
+	DefaultPassword = "password"
+
+	// App name of the default SSO application, see IdpURL
+	App = "aws"
+
+	// SessionCookie name of the session cookie set by the xsrf endpoint
+	SessionCookie = "jc_session"
+
+	// DuoApp APP part of the Duo requests signed by the server
+	DuoApp = "APP|jumpcloudtest"
+)
+
+// DefaultRole role of a new server
+var DefaultRole = Role{
+	RoleArn:      "arn:aws:iam::000000000000:role/jumpcloud-admin",
+	PrincipalArn: "arn:aws:iam::000000000000:saml-provider/jumpcloud",
+}
+
+// Push notification statuses
+const (
+	PushPending  = "pending"
+	PushAccepted = "accepted"
+	PushDenied   = "denied"
+	PushExpired  = "expired"
+)
+
+// Factor MFA factor reported in the "MFA required." response
+type Factor struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// Role AWS role in the SAML assertion
+type Role struct {
+	RoleArn      string
+	PrincipalArn string
+}
+
+// Server fake JumpCloud. Fields must be set before Start.
+type Server struct {
+	*httptest.Server
+
+	// Email and Password valid user credentials
+	Email    string
+	Password string
+	// TOTP valid TOTP code, MFA is required when it or Factors are set
+	TOTP string
+	// Factors reported when MFA is required, an available TOTP factor if empty
+	Factors []Factor
+	// PushStatus status of push notifications (JumpCloud Protect and Duo) after the first status check
+	PushStatus string
+	// Roles AWS roles in the SAML assertion
+	Roles []Role
+	// SessionDuration SessionDuration attribute of the SAML assertion, omitted if 0
+	SessionDuration int
+	// ClockSkew offset of the server clock (Date header of the xsrf endpoint) to the local clock
+	ClockSkew time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	pushes   map[string]int
+	// duoFrames Duo frame sessions by sid
+	duoFrames map[string]*duoFrame
+	// duoRequests Duo transactions (TX part of the request) and whether Duo approved them
+	duoRequests map[string]bool
+	logins      int
+	// idpRequests number of IDP requests by application
+	idpRequests map[string]int
+}
+
+// session state of a browser session
+type session struct {
+	xsrf          string
+	authenticated bool
+}
+
+// duoFrame state of a Duo frame session
+type duoFrame struct {
+	tx   string
+	push string
+}
+
+// NewServer start a new server with default credentials and role, without MFA
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer return a new server with default credentials and role, without MFA.
+// Start it with Start after changing its fields.
+func NewUnstartedServer() *Server {
+	s := &Server{
+		Email:    DefaultEmail,
+		Password: DefaultPassword,
+		Roles:    []Role{DefaultRole},
+		sessions: map[string]*session{},
+		pushes:   map[string]int{},
+
+		duoFrames:   map[string]*duoFrame{},
+		duoRequests: map[string]bool{},
+		idpRequests: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /userconsole/xsrf", s.handleXSRF)
+	mux.HandleFunc("POST /userconsole/auth", s.handleAuth)
+	mux.HandleFunc("POST /userconsole/auth/push", s.handlePush)
+	mux.HandleFunc("GET /userconsole/auth/push/{id}", s.handlePushStatus)
+	mux.HandleFunc("POST /userconsole/auth/push/{id}/login", s.handlePushLogin)
+	mux.HandleFunc("GET /userconsole/auth/duo", s.handleDuo)
+	mux.HandleFunc("POST /userconsole/auth/duo", s.handleDuoLogin)
+	mux.HandleFunc("POST /frame/web/v1/auth", s.handleDuoFrame)
+	mux.HandleFunc("POST /frame/prompt", s.handleDuoPrompt)
+	mux.HandleFunc("POST /frame/status", s.handleDuoStatus)
+	mux.HandleFunc("POST /frame/status/{txid}", s.handleDuoResult)
+	mux.HandleFunc("GET /saml2/{app}", s.handleIdp)
+
+	s.Server = httptest.NewUnstartedServer(mux)
+	return s
+}
+
+// IdpURL return URL of the default SSO application
+func (s *Server) IdpURL() string {
+	return s.AppURL(App)
+}
+
+// AppURL return URL of the SSO application, the server serves any application
+// with the same roles
+func (s *Server) AppURL(app string) string {
+	return s.URL + "/saml2/" + app
+}
+
+// SAMLResponse return base64 encoded SAMLResponse served by the IDP
+func (s *Server) SAMLResponse() string {
+	return base64.StdEncoding.EncodeToString([]byte(s.samlResponseXML()))
+}
+
+// Logins return number of successful logins
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// IdpRequests return number of requests to the SSO application
+func (s *Server) IdpRequests(app string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idpRequests[app]
+}
+
+// Pushes return number of sent push notifications, JumpCloud Protect and Duo
+func (s *Server) Pushes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pushes)
+}
+
+// ExpireSessions end all sessions, the IDP shows the login page until the user logs in again
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sessions)
+}
+
+func (s *Server) handleXSRF(w http.ResponseWriter, r *http.Request) {
+	id, xsrf := randomID(), randomID()
+
+	s.mu.Lock()
+	s.sessions[id] = &session{xsrf: xsrf}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: id, Path: "/", HttpOnly: true})
+	if s.ClockSkew != 0 {
+		w.Header().Set("Date", time.Now().Add(s.ClockSkew).UTC().Format(http.TimeFormat))
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"xsrf": xsrf})
+}
+
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	if sess == nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "Invalid XSRF token."})
+		return
+	}
+
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Otp      string `json:"otp"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid request."})
+		return
+	}
+
+	if req.Email != s.Email || req.Password != s.Password {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Authentication failed."})
+		return
+	}
+
+	if s.TOTP != "" || len(s.Factors) > 0 {
+		if req.Otp == "" {
+			factors := s.Factors
+			if len(factors) == 0 {
+				factors = []Factor{{Type: "totp", Status: "available"}}
+			}
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"message": "MFA required.", "factors": factors})
+			return
+		}
+		if s.TOTP == "" || req.Otp != s.TOTP {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Authentication failed."})
+			return
+		}
+	}
+
+	s.login(sess)
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if s.session(r) == nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "Invalid XSRF token."})
+		return
+	}
+	id := randomID()
+
+	s.mu.Lock()
+	s.pushes[id] = 0
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": PushPending})
+}
+
+func (s *Server) handlePushStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	status, ok := s.pushStatus(id, true)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Push notification not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": status})
+}
+
+func (s *Server) handlePushLogin(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	if sess == nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "Invalid XSRF token."})
+		return
+	}
+	if status, _ := s.pushStatus(r.PathValue("id"), false); status != PushAccepted {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Push notification was not accepted."})
+		return
+	}
+	s.login(sess)
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleDuo(w http.ResponseWriter, r *http.Request) {
+	if s.session(r) == nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "Invalid XSRF token."})
+		return
+	}
+	tx := "TX|" + randomID()
+
+	s.mu.Lock()
+	s.duoRequests[tx] = false
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{"api_host": r.Host, "sig_request": tx + ":" + DuoApp})
+}
+
+func (s *Server) handleDuoFrame(w http.ResponseWriter, r *http.Request) {
+	tx := r.URL.Query().Get("tx")
+	sid := randomID()
+
+	s.mu.Lock()
+	_, ok := s.duoRequests[tx]
+	if ok {
+		s.duoFrames[sid] = &duoFrame{tx: tx}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "Invalid request.", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html><body><form method="POST" action="/frame/prompt"><input type="hidden" name="sid" value="%s"></form></body></html>`, sid)
+}
+
+func (s *Server) handleDuoPrompt(w http.ResponseWriter, r *http.Request) {
+	_, sid, ok := s.duoFrame(r)
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]string{"stat": "FAIL", "message": "Invalid session."})
+		return
+	}
+	if r.PostFormValue("factor") != "Duo Push" {
+		writeJSON(w, http.StatusOK, map[string]string{"stat": "FAIL", "message": "Unsupported factor."})
+		return
+	}
+	id := randomID()
+
+	s.mu.Lock()
+	s.pushes[id] = 0
+	s.duoFrames[sid].push = id
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{"stat": "OK", "response": map[string]string{"txid": id}})
+}
+
+func (s *Server) handleDuoStatus(w http.ResponseWriter, r *http.Request) {
+	frame, _, ok := s.duoFrame(r)
+	if !ok || r.PostFormValue("txid") != frame.push {
+		writeJSON(w, http.StatusOK, map[string]string{"stat": "FAIL", "message": "Invalid session."})
+		return
+	}
+
+	status, _ := s.pushStatus(frame.push, true)
+	var response map[string]string
+	switch status {
+	case PushAccepted:
+		response = map[string]string{"status_code": "allow", "result": "SUCCESS", "result_url": "/frame/status/" + frame.push}
+	case PushDenied:
+		response = map[string]string{"status_code": "deny", "result": "FAILURE"}
+	case PushExpired:
+		response = map[string]string{"status_code": "timeout", "result": "FAILURE"}
+	default:
+		response = map[string]string{"status_code": "pushed"}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"stat": "OK", "response": response})
+}
+
+func (s *Server) handleDuoResult(w http.ResponseWriter, r *http.Request) {
+	frame, _, ok := s.duoFrame(r)
+	if !ok || r.PathValue("txid") != frame.push {
+		writeJSON(w, http.StatusOK, map[string]string{"stat": "FAIL", "message": "Invalid session."})
+		return
+	}
+	if status, _ := s.pushStatus(frame.push, false); status != PushAccepted {
+		writeJSON(w, http.StatusOK, map[string]string{"stat": "FAIL", "message": "Duo push was not approved."})
+		return
+	}
+
+	s.mu.Lock()
+	s.duoRequests[frame.tx] = true
+	s.mu.Unlock()
+
+	cookie := "AUTH|" + strings.TrimPrefix(frame.tx, "TX|")
+	writeJSON(w, http.StatusOK, map[string]any{"stat": "OK", "response": map[string]string{"cookie": cookie}})
+}
+
+func (s *Server) handleDuoLogin(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	if sess == nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "Invalid XSRF token."})
+		return
+	}
+	var req struct {
+		SigResponse string `json:"sig_response"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid request."})
+		return
+	}
+
+	// The response is "AUTH|...:APP|..." with the transaction signed by Duo
+	auth, app, _ := strings.Cut(req.SigResponse, ":")
+	tx := "TX|" + strings.TrimPrefix(auth, "AUTH|")
+	s.mu.Lock()
+	approved := strings.HasPrefix(auth, "AUTH|") && app == DuoApp && s.duoRequests[tx]
+	delete(s.duoRequests, tx)
+	s.mu.Unlock()
+
+	if !approved {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Duo authentication failed."})
+		return
+	}
+	s.login(sess)
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleIdp(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(SessionCookie)
+	s.mu.Lock()
+	authenticated := err == nil && s.sessions[c.Value] != nil && s.sessions[c.Value].authenticated
+	s.idpRequests[r.PathValue("app")]++
+	s.mu.Unlock()
+
+	if !authenticated {
+		// JumpCloud shows the login page without SAMLResponse
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><form action="/login"><input name="email"></form></body></html>`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html><body onload="document.forms[0].submit()">
+<form method="POST" action="https://signin.aws.amazon.com/saml">
+<input type="hidden" name="SAMLResponse" value="%s">
+<input type="hidden" name="RelayState" value="">
+</form></body></html>`, html.EscapeString(s.SAMLResponse()))
+}
+
+// session return the session of the request with a valid XSRF token
+func (s *Server) session(r *http.Request) *session {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[c.Value]
+	if sess == nil || r.Header.Get("X-Xsrftoken") != sess.xsrf {
+		return nil
+	}
+	return sess
+}
+
+// duoFrame return a copy of the Duo frame session of the request and its sid
+func (s *Server) duoFrame(r *http.Request) (duoFrame, string, bool) {
+	sid := r.PostFormValue("sid")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame, ok := s.duoFrames[sid]
+	if !ok {
+		return duoFrame{}, "", false
+	}
+	return *frame, sid, true
+}
+
+func (s *Server) login(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.authenticated = true
+	s.logins++
+}
+
+// pushStatus return status of the push notification, pending until the first status check
+func (s *Server) pushStatus(id string, check bool) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checks, ok := s.pushes[id]
+	if !ok {
+		return "", false
+	}
+	if check {
+		s.pushes[id] = checks + 1
+	}
+	if checks == 0 || s.PushStatus == "" {
+		return PushPending, true
+	}
+	return s.PushStatus, true
+}
+
+// samlResponseXML signed-looking SAML response with the AWS attributes.
+// The signature is not valid, AWS STS is expected to be faked too.
+func (s *Server) samlResponseXML() string {
+	now := time.Now().UTC()
+	digest := sha256.Sum256([]byte(s.Email))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_response" Version="2.0" IssueInstant="%s" Destination="https://signin.aws.amazon.com/saml">`, now.Format(time.RFC3339))
+	b.WriteString(`<saml:Issuer>JumpCloud</saml:Issuer>`)
+	b.WriteString(`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>`)
+	fmt.Fprintf(&b, `<saml:Assertion ID="_assertion" Version="2.0" IssueInstant="%s">`, now.Format(time.RFC3339))
+	b.WriteString(`<saml:Issuer>JumpCloud</saml:Issuer>`)
+	b.WriteString(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>`)
+	b.WriteString(`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>`)
+	b.WriteString(`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>`)
+	fmt.Fprintf(&b, `<ds:Reference URI="#_assertion"><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference>`,
+		base64.StdEncoding.EncodeToString(digest[:]))
+	fmt.Fprintf(&b, `</ds:SignedInfo><ds:SignatureValue>%s</ds:SignatureValue></ds:Signature>`,
+		base64.StdEncoding.EncodeToString([]byte(strings.Repeat(hex.EncodeToString(digest[:]), 4))))
+	fmt.Fprintf(&b, `<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">%s</saml:NameID></saml:Subject>`, html.EscapeString(s.Email))
+	fmt.Fprintf(&b, `<saml:Conditions NotBefore="%s" NotOnOrAfter="%s"><saml:AudienceRestriction><saml:Audience>urn:amazon:webservices</saml:Audience></saml:AudienceRestriction></saml:Conditions>`,
+		now.Add(-time.Minute).Format(time.RFC3339), now.Add(5*time.Minute).Format(time.RFC3339))
+	b.WriteString(`<saml:AttributeStatement>`)
+	b.WriteString(`<saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">`)
+	for _, r := range s.Roles {
+		fmt.Fprintf(&b, `<saml:AttributeValue>%s,%s</saml:AttributeValue>`, html.EscapeString(r.RoleArn), html.EscapeString(r.PrincipalArn))
+	}
+	b.WriteString(`</saml:Attribute>`)
+	fmt.Fprintf(&b, `<saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName"><saml:AttributeValue>%s</saml:AttributeValue></saml:Attribute>`, html.EscapeString(s.Email))
+	if s.SessionDuration > 0 {
+		fmt.Fprintf(&b, `<saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/SessionDuration"><saml:AttributeValue>%d</saml:AttributeValue></saml:Attribute>`, s.SessionDuration)
+	}
+	b.WriteString(`</saml:AttributeStatement></saml:Assertion></samlp:Response>`)
+	return b.String()
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
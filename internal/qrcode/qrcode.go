@@ -0,0 +1,47 @@
+// Package qrcode decodes QR codes of images, e.g. a screenshot of the
+// JumpCloud TOTP enrollment QR code holding the otpauth:// URI.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"io"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ErrNotFound is returned when the image doesn't contain a readable QR code
+var ErrNotFound = errors.New("no QR code found in the image")
+
+// Decode return the text of the QR code in the PNG, JPEG or GIF image
+func Decode(r io.Reader) (string, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	return DecodeImage(img)
+}
+
+// DecodeImage return the text of the QR code in the image,
+// light on dark QR codes (e.g. dark mode screenshots) are supported
+func DecodeImage(img image.Image) (string, error) {
+	hints := map[gozxing.DecodeHintType]any{gozxing.DecodeHintType_TRY_HARDER: true}
+
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	for _, src := range []gozxing.LuminanceSource{source, source.Invert()} {
+		bmp, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(src))
+		if err != nil {
+			return "", err
+		}
+		res, err := zxingqr.NewQRCodeReader().Decode(bmp, hints)
+		if err == nil {
+			return res.GetText(), nil
+		}
+	}
+	return "", ErrNotFound
+}
@@ -0,0 +1,83 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+)
+
+const testURI = "otpauth://totp/JumpCloud:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=JumpCloud"
+
+// qrImage QR code of the text on a white canvas larger than the code, like a screenshot
+func qrImage(t *testing.T, text string) *image.Gray {
+	t.Helper()
+	matrix, err := zxingqr.NewQRCodeWriter().EncodeWithoutHint(text, gozxing.BarcodeFormat_QR_CODE, 200, 200)
+	if err != nil {
+		t.Fatalf("encode QR code: %v", err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(120, 50, 320, 250), matrix, image.Point{}, draw.Src)
+	return img
+}
+
+func TestDecode(t *testing.T) {
+	img := qrImage(t, testURI)
+
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"png": pngData.Bytes(), "jpeg": jpegData.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			got, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != testURI {
+				t.Errorf("Decode() = %q, want %q", got, testURI)
+			}
+		})
+	}
+}
+
+func TestDecodeImage_Inverted(t *testing.T) {
+	img := qrImage(t, testURI)
+	for i := range img.Pix {
+		img.Pix[i] = 255 - img.Pix[i]
+	}
+
+	got, err := DecodeImage(img)
+	if err != nil || got != testURI {
+		t.Errorf("DecodeImage() = %q, %v, want the URI of the light on dark code", got, err)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	blank := image.NewGray(image.Rect(0, 0, 100, 100))
+	draw.Draw(blank, blank.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	var data bytes.Buffer
+	if err := png.Encode(&data, blank); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(&data); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Decode() of a blank image error = %v, want ErrNotFound", err)
+	}
+	if _, err := Decode(strings.NewReader("not an image")); err == nil || !strings.Contains(err.Error(), "failed to read image") {
+		t.Errorf("Decode() of invalid data error = %v", err)
+	}
+}
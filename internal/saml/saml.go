@@ -0,0 +1,189 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// AWS SAML attribute names
+const (
+	AttributeRole            = "https://aws.amazon.com/SAML/Attributes/Role"
+	AttributeRoleSessionName = "https://aws.amazon.com/SAML/Attributes/RoleSessionName"
+	AttributeSessionDuration = "https://aws.amazon.com/SAML/Attributes/SessionDuration"
+)
+
+// Role is a role/principal pair the user is entitled to assume
+type Role struct {
+	RoleArn      string
+	PrincipalArn string
+}
+
+// Name return the role name part of the role ARN
+// Ex: arn:aws:iam::000000000000:role/path/admin -> admin
+func (r Role) Name() string {
+	if idx := strings.LastIndex(r.RoleArn, "/"); idx >= 0 {
+		return r.RoleArn[idx+1:]
+	}
+	return r.RoleArn
+}
+
+// Assertion holds the AWS related data extracted from a SAMLResponse
+type Assertion struct {
+	Roles           []Role
+	RoleSessionName string
+	// SessionDuration in seconds, 0 if the attribute is not present
+	SessionDuration int
+}
+
+// Parse decode a base64 encoded SAMLResponse and extract AWS attributes
+func Parse(samlResponse string) (*Assertion, error) {
+	// Assertions may be wrapped across lines when copied from HTML forms
+	cleaned := strings.Join(strings.Fields(samlResponse), "")
+	raw, err := base64.StdEncoding.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("invalid saml response encoding: %w", err)
+	}
+
+	attributes, err := readAttributes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid saml response: %w", err)
+	}
+
+	a := &Assertion{}
+	for _, v := range attributes[AttributeRole] {
+		role, err := parseRoleValue(v)
+		if err != nil {
+			return nil, err
+		}
+		a.Roles = append(a.Roles, role)
+	}
+
+	if v := attributes[AttributeRoleSessionName]; len(v) > 0 {
+		a.RoleSessionName = v[0]
+	}
+
+	if v := attributes[AttributeSessionDuration]; len(v) > 0 {
+		a.SessionDuration, err = strconv.Atoi(v[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid session duration %q: %w", v[0], err)
+		}
+	}
+
+	return a, nil
+}
+
+// FindRole return the role with given role ARN
+func (a *Assertion) FindRole(roleArn string) (Role, error) {
+	for _, r := range a.Roles {
+		if r.RoleArn == roleArn {
+			return r, nil
+		}
+	}
+	return Role{}, fmt.Errorf("the role %s not found in saml assertion", roleArn)
+}
+
+// FindRoleByName return the role whose ARN ends with given role name
+func (a *Assertion) FindRoleByName(name string) (Role, error) {
+	var found []Role
+	for _, r := range a.Roles {
+		if r.Name() == name {
+			found = append(found, r)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Role{}, fmt.Errorf("the role %s not found in saml assertion", name)
+	case 1:
+		return found[0], nil
+	default:
+		return Role{}, fmt.Errorf("the role name %s is ambiguous, use role arn instead", name)
+	}
+}
+
+// readAttributes walk the XML document and collect values of all
+// <Attribute Name="..."><AttributeValue>...</AttributeValue></Attribute> elements.
+// Namespace prefixes are ignored, only local names are matched.
+func readAttributes(raw []byte) (map[string][]string, error) {
+	attributes := make(map[string][]string)
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+
+	var (
+		attrName string
+		inValue  bool
+		value    strings.Builder
+	)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Attribute":
+				attrName = ""
+				for _, a := range t.Attr {
+					if a.Name.Local == "Name" {
+						attrName = a.Value
+					}
+				}
+			case "AttributeValue":
+				inValue = attrName != ""
+				value.Reset()
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "Attribute":
+				attrName = ""
+			case "AttributeValue":
+				if inValue {
+					attributes[attrName] = append(attributes[attrName], strings.TrimSpace(value.String()))
+				}
+				inValue = false
+			}
+		}
+	}
+
+	return attributes, nil
+}
+
+// parseRoleValue split a Role attribute value into role and principal ARNs.
+// IdPs are free to put the pair in any order, so detect each part by resource type.
+func parseRoleValue(value string) (Role, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return Role{}, fmt.Errorf("invalid role attribute value %q", value)
+	}
+
+	var role Role
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		switch {
+		case strings.Contains(p, ":saml-provider/"):
+			role.PrincipalArn = p
+		case strings.Contains(p, ":role/"):
+			role.RoleArn = p
+		}
+	}
+
+	if role.RoleArn == "" || role.PrincipalArn == "" {
+		return Role{}, fmt.Errorf("invalid role attribute value %q", value)
+	}
+
+	return role, nil
+}
@@ -0,0 +1,178 @@
+package saml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildResponse returns a base64 encoded SAMLResponse with given attributes.
+func buildResponse(attrs map[string][]string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<saml2p:Response xmlns:saml2p="urn:oasis:names:tc:SAML:2.0:protocol">`)
+	b.WriteString(`<saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion">`)
+	b.WriteString(`<saml2:AttributeStatement>`)
+	for name, values := range attrs {
+		fmt.Fprintf(&b, `<saml2:Attribute Name="%s">`, name)
+		for _, v := range values {
+			fmt.Fprintf(&b, `<saml2:AttributeValue>%s</saml2:AttributeValue>`, v)
+		}
+		b.WriteString(`</saml2:Attribute>`)
+	}
+	b.WriteString(`</saml2:AttributeStatement></saml2:Assertion></saml2p:Response>`)
+	return base64.StdEncoding.EncodeToString([]byte(b.String()))
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     *Assertion
+		wantErr  bool
+	}{
+		{
+			name: "single role",
+			response: buildResponse(map[string][]string{
+				AttributeRole: {"arn:aws:iam::111:role/admin,arn:aws:iam::111:saml-provider/jumpcloud"},
+			}),
+			want: &Assertion{Roles: []Role{
+				{RoleArn: "arn:aws:iam::111:role/admin", PrincipalArn: "arn:aws:iam::111:saml-provider/jumpcloud"},
+			}},
+		},
+		{
+			name: "principal first and all attributes",
+			response: buildResponse(map[string][]string{
+				AttributeRole: {
+					"arn:aws:iam::111:saml-provider/jumpcloud,arn:aws:iam::111:role/admin",
+					"arn:aws:iam::222:role/read-only, arn:aws:iam::222:saml-provider/jumpcloud",
+				},
+				AttributeRoleSessionName: {"user@example.com"},
+				AttributeSessionDuration: {"7200"},
+			}),
+			want: &Assertion{
+				Roles: []Role{
+					{RoleArn: "arn:aws:iam::111:role/admin", PrincipalArn: "arn:aws:iam::111:saml-provider/jumpcloud"},
+					{RoleArn: "arn:aws:iam::222:role/read-only", PrincipalArn: "arn:aws:iam::222:saml-provider/jumpcloud"},
+				},
+				RoleSessionName: "user@example.com",
+				SessionDuration: 7200,
+			},
+		},
+		{
+			name:     "no attributes",
+			response: buildResponse(nil),
+			want:     &Assertion{},
+		},
+		{
+			name:     "invalid base64",
+			response: "not-base64!!",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid xml",
+			response: base64.StdEncoding.EncodeToString([]byte("<Response><Attribute>")),
+			wantErr:  true,
+		},
+		{
+			name: "invalid role value",
+			response: buildResponse(map[string][]string{
+				AttributeRole: {"arn:aws:iam::111:role/admin"},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "invalid session duration",
+			response: buildResponse(map[string][]string{
+				AttributeSessionDuration: {"one hour"},
+			}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWrappedResponse(t *testing.T) {
+	response := buildResponse(map[string][]string{
+		AttributeRole: {"arn:aws:iam::111:role/admin,arn:aws:iam::111:saml-provider/jumpcloud"},
+	})
+
+	// Split the response across lines like HTML forms sometimes do
+	var wrapped strings.Builder
+	for i := 0; i < len(response); i += 64 {
+		wrapped.WriteString(response[i:min(i+64, len(response))] + "\n")
+	}
+
+	got, err := Parse(wrapped.String())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got.Roles) != 1 {
+		t.Errorf("expected 1 role, got %d", len(got.Roles))
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	tests := []struct {
+		arn  string
+		want string
+	}{
+		{"arn:aws:iam::111:role/admin", "admin"},
+		{"arn:aws:iam::111:role/path/to/admin", "admin"},
+		{"admin", "admin"},
+	}
+	for _, tt := range tests {
+		if got := (Role{RoleArn: tt.arn}).Name(); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.arn, got, tt.want)
+		}
+	}
+}
+
+func TestFindRole(t *testing.T) {
+	a := &Assertion{Roles: []Role{
+		{RoleArn: "arn:aws:iam::111:role/admin", PrincipalArn: "arn:aws:iam::111:saml-provider/jc"},
+		{RoleArn: "arn:aws:iam::222:role/admin", PrincipalArn: "arn:aws:iam::222:saml-provider/jc"},
+		{RoleArn: "arn:aws:iam::222:role/read-only", PrincipalArn: "arn:aws:iam::222:saml-provider/jc"},
+	}}
+
+	role, err := a.FindRole("arn:aws:iam::222:role/admin")
+	if err != nil {
+		t.Fatalf("FindRole() error = %v", err)
+	}
+	if role.PrincipalArn != "arn:aws:iam::222:saml-provider/jc" {
+		t.Errorf("FindRole() principal = %q", role.PrincipalArn)
+	}
+
+	if _, err := a.FindRole("arn:aws:iam::333:role/admin"); err == nil {
+		t.Error("FindRole() expected error for unknown role")
+	}
+
+	role, err = a.FindRoleByName("read-only")
+	if err != nil {
+		t.Fatalf("FindRoleByName() error = %v", err)
+	}
+	if role.RoleArn != "arn:aws:iam::222:role/read-only" {
+		t.Errorf("FindRoleByName() role = %q", role.RoleArn)
+	}
+
+	if _, err := a.FindRoleByName("admin"); err == nil {
+		t.Error("FindRoleByName() expected error for ambiguous role name")
+	}
+
+	if _, err := a.FindRoleByName("missing"); err == nil {
+		t.Error("FindRoleByName() expected error for unknown role name")
+	}
+}
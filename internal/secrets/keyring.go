@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// DefaultKeyringService service name used when the keyring reference has no service
+const DefaultKeyringService = "jc2aws"
+
+// Keyring read access to an OS keyring (macOS Keychain, Secret Service, Windows Credential Manager)
+type Keyring interface {
+	Get(service, user string) (string, error)
+}
+
+// KeyringResolver resolve "keyring:<service>/<user>" or "keyring:<user>" (DefaultKeyringService) references
+type KeyringResolver struct {
+	Keyring Keyring
+}
+
+// Resolve return the secret stored in the keyring
+func (r KeyringResolver) Resolve(ref string) (string, error) {
+	service, user := parseKeyringRef(ref)
+	if user == "" {
+		return "", fmt.Errorf("keyring user is empty")
+	}
+
+	secret, err := r.Keyring.Get(service, user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("secret %s/%s not found in keyring", service, user)
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// parseKeyringRef split the reference into service and user
+func parseKeyringRef(ref string) (string, string) {
+	service, user, found := strings.Cut(ref, "/")
+	if !found {
+		return DefaultKeyringService, ref
+	}
+	return service, user
+}
+
+// systemKeyring OS keyring
+type systemKeyring struct{}
+
+func (systemKeyring) Get(service, user string) (string, error) {
+	return keyring.Get(service, user)
+}
@@ -0,0 +1,170 @@
+// Package secrets resolves secret references (e.g. "env:JC_PASSWORD") used
+// instead of plaintext passwords and MFA secrets in the config file.
+//
+// A reference has the form "<scheme>:<ref>". Values without a known scheme
+// are returned unchanged, so plaintext values keep working.
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+const (
+	SchemeCmd     = "cmd"
+	SchemeEnv     = "env"
+	SchemeFile    = "file"
+	SchemeKeyring = "keyring"
+	// SchemePlain marks a literal value, e.g. "plain:env:not-a-reference"
+	SchemePlain = "plain"
+)
+
+// Resolver return the secret value for a reference (the part after "<scheme>:")
+type Resolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// ResolverFunc adapter to use a function as a Resolver
+type ResolverFunc func(ref string) (string, error)
+
+// Resolve call f(ref)
+func (f ResolverFunc) Resolve(ref string) (string, error) { return f(ref) }
+
+// Registry resolvers by scheme
+type Registry struct {
+	resolvers map[string]Resolver
+}
+
+// NewRegistry Init new empty registry
+func NewRegistry() *Registry {
+	return &Registry{resolvers: map[string]Resolver{}}
+}
+
+// Register add or replace the resolver for the scheme
+func (r *Registry) Register(scheme string, resolver Resolver) {
+	r.resolvers[scheme] = resolver
+}
+
+// Schemes return sorted list of registered schemes
+func (r *Registry) Schemes() []string {
+	var schemes []string
+	for s := range r.resolvers {
+		schemes = append(schemes, s)
+	}
+	slices.Sort(schemes)
+	return schemes
+}
+
+// IsReference report whether the value refers to a registered scheme
+func (r *Registry) IsReference(value string) bool {
+	_, _, ok := r.split(value)
+	return ok
+}
+
+// Resolve return the secret value for a reference,
+// or the value itself if it doesn't start with a registered scheme
+func (r *Registry) Resolve(value string) (string, error) {
+	scheme, ref, ok := r.split(value)
+	if !ok {
+		return value, nil
+	}
+	secret, err := r.resolvers[scheme].Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s secret: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// split return scheme and reference if the value starts with a registered scheme
+func (r *Registry) split(value string) (string, string, bool) {
+	scheme, ref, found := strings.Cut(value, ":")
+	if !found {
+		return "", "", false
+	}
+	if _, ok := r.resolvers[scheme]; !ok {
+		return "", "", false
+	}
+	return scheme, ref, true
+}
+
+// DefaultRegistry registry with all built-in resolvers
+var DefaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(SchemeCmd, ResolverFunc(resolveCmd))
+	r.Register(SchemeEnv, ResolverFunc(resolveEnv))
+	r.Register(SchemeFile, ResolverFunc(resolveFile))
+	r.Register(SchemeKeyring, KeyringResolver{Keyring: systemKeyring{}})
+	r.Register(SchemePlain, ResolverFunc(resolvePlain))
+	return r
+}
+
+// Resolve resolve the value with DefaultRegistry
+func Resolve(value string) (string, error) { return DefaultRegistry.Resolve(value) }
+
+// IsReference report whether the value is a reference in DefaultRegistry
+func IsReference(value string) bool { return DefaultRegistry.IsReference(value) }
+
+// resolveCmd run the command with the system shell and return its output without trailing newlines
+func resolveCmd(ref string) (string, error) {
+	if strings.TrimSpace(ref) == "" {
+		return "", fmt.Errorf("command is empty")
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", ref)
+	} else {
+		cmd = exec.Command("sh", "-c", ref)
+	}
+	// Allow password managers to ask for a passphrase
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("command %q failed: %w", ref, err)
+	}
+	return trimNewline(string(out)), nil
+}
+
+// resolveEnv return value of the environment variable
+func resolveEnv(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// resolveFile return the file content without trailing newlines, "~/" is expanded to the home directory
+func resolveFile(ref string) (string, error) {
+	path := ref
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(homeDir, rest)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return trimNewline(string(data)), nil
+}
+
+// resolvePlain return the reference as is
+func resolvePlain(ref string) (string, error) { return ref, nil }
+
+// trimNewline remove trailing newlines (password managers end the output with a newline)
+func trimNewline(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
@@ -0,0 +1,157 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// fakeKeyring in-memory keyring keyed by "service/user"
+type fakeKeyring map[string]string
+
+func (k fakeKeyring) Get(service, user string) (string, error) {
+	secret, ok := k[service+"/"+user]
+	if !ok {
+		return "", keyring.ErrNotFound
+	}
+	return secret, nil
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+	r.Register("test", ResolverFunc(func(ref string) (string, error) {
+		if ref == "fail" {
+			return "", errors.New("failed")
+		}
+		return "secret-" + ref, nil
+	}))
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "reference", value: "test:password", want: "secret-password"},
+		{name: "plaintext", value: "password", want: "password"},
+		{name: "unknown scheme", value: "unknown:password", want: "unknown:password"},
+		{name: "empty", value: "", want: ""},
+		{name: "resolver error", value: "test:fail", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRegistrySchemes(t *testing.T) {
+	want := []string{SchemeCmd, SchemeEnv, SchemeFile, SchemeKeyring, SchemePlain}
+	got := DefaultRegistry.Schemes()
+	if len(got) != len(want) {
+		t.Fatalf("Schemes() got = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Schemes() got = %v, want %v", got, want)
+		}
+	}
+
+	if !IsReference("env:HOME") || IsReference("MyVeryCoolPassword") {
+		t.Error("IsReference() returned unexpected result")
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	t.Setenv("J2A_TEST_SECRET", "from-env")
+
+	got, err := Resolve("env:J2A_TEST_SECRET")
+	if err != nil || got != "from-env" {
+		t.Errorf("Resolve() got = %q, err = %v", got, err)
+	}
+
+	if _, err := Resolve("env:J2A_TEST_SECRET_MISSING"); err == nil {
+		t.Error("Resolve() expected error for missing variable")
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Resolve("file:" + path)
+	if err != nil || got != "from-file" {
+		t.Errorf("Resolve() got = %q, err = %v", got, err)
+	}
+
+	if _, err := Resolve("file:" + path + ".missing"); err == nil {
+		t.Error("Resolve() expected error for missing file")
+	}
+}
+
+func TestResolveCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell")
+	}
+
+	got, err := Resolve("cmd:echo from-cmd")
+	if err != nil || got != "from-cmd" {
+		t.Errorf("Resolve() got = %q, err = %v", got, err)
+	}
+
+	if _, err := Resolve("cmd:exit 1"); err == nil {
+		t.Error("Resolve() expected error for failed command")
+	}
+
+	if _, err := Resolve("cmd:"); err == nil {
+		t.Error("Resolve() expected error for empty command")
+	}
+}
+
+func TestResolvePlain(t *testing.T) {
+	got, err := Resolve("plain:env:HOME")
+	if err != nil || got != "env:HOME" {
+		t.Errorf("Resolve() got = %q, err = %v", got, err)
+	}
+}
+
+func TestKeyringResolver(t *testing.T) {
+	r := KeyringResolver{Keyring: fakeKeyring{
+		"jc2aws/my-user@example.com": "default-service",
+		"jumpcloud/password":         "custom-service",
+	}}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "my-user@example.com", want: "default-service"},
+		{ref: "jumpcloud/password", want: "custom-service"},
+		{ref: "jumpcloud/missing", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := r.Resolve(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
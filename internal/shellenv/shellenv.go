@@ -0,0 +1,142 @@
+// Package shellenv renders environment variables as statements of a shell,
+// so the output can be evaluated by the calling shell (eval "$(jc2aws -f export)").
+package shellenv
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const (
+	// SyntaxAuto detect the syntax from $SHELL
+	SyntaxAuto = "auto"
+	// SyntaxPOSIX sh, bash, zsh and other POSIX shells
+	SyntaxPOSIX      = "posix"
+	SyntaxFish       = "fish"
+	SyntaxPowerShell = "powershell"
+	SyntaxNushell    = "nushell"
+)
+
+// Syntaxes list of supported shell syntaxes
+var Syntaxes = []string{SyntaxAuto, SyntaxPOSIX, SyntaxFish, SyntaxPowerShell, SyntaxNushell}
+
+// Var environment variable
+type Var struct {
+	Name  string
+	Value string
+}
+
+// ParseEnv convert KEY=value pairs to variables, pairs without "=" are skipped
+func ParseEnv(env []string) []Var {
+	vars := make([]Var, 0, len(env))
+	for _, kv := range env {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			vars = append(vars, Var{Name: name, Value: value})
+		}
+	}
+	return vars
+}
+
+// Detect return the syntax of the shell path (usually $SHELL),
+// PowerShell on Windows without $SHELL, POSIX otherwise
+func Detect(shell, goos string) string {
+	if shell == "" && goos == "windows" {
+		return SyntaxPowerShell
+	}
+
+	// Split on both separators, Windows paths are not split by filepath on other platforms
+	name := shell[strings.LastIndexAny(shell, `/\`)+1:]
+	switch strings.ToLower(strings.TrimSuffix(name, ".exe")) {
+	case "fish":
+		return SyntaxFish
+	case "pwsh", "powershell":
+		return SyntaxPowerShell
+	case "nu", "nushell":
+		return SyntaxNushell
+	default:
+		return SyntaxPOSIX
+	}
+}
+
+// Resolve validate the syntax, auto is replaced by the syntax of $SHELL
+func Resolve(syntax string) (string, error) {
+	switch syntax {
+	case SyntaxAuto, "":
+		return Detect(os.Getenv("SHELL"), runtime.GOOS), nil
+	case SyntaxPOSIX, SyntaxFish, SyntaxPowerShell, SyntaxNushell:
+		return syntax, nil
+	default:
+		return "", fmt.Errorf("unsupported shell syntax %q, use one of: %s", syntax, strings.Join(Syntaxes, ", "))
+	}
+}
+
+// Export render statements setting the variables
+func Export(syntax string, vars []Var) (string, error) {
+	syntax, err := Resolve(syntax)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		switch syntax {
+		case SyntaxPOSIX:
+			fmt.Fprintf(&b, "export %s=%s\n", v.Name, quotePOSIX(v.Value))
+		case SyntaxFish:
+			fmt.Fprintf(&b, "set -gx %s %s\n", v.Name, quoteFish(v.Value))
+		case SyntaxPowerShell:
+			fmt.Fprintf(&b, "$Env:%s = %s\n", v.Name, quotePowerShell(v.Value))
+		case SyntaxNushell:
+			fmt.Fprintf(&b, "$env.%s = %s\n", v.Name, quoteNushell(v.Value))
+		}
+	}
+	return b.String(), nil
+}
+
+// Unset render statements removing the variables
+func Unset(syntax string, names []string) (string, error) {
+	syntax, err := Resolve(syntax)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	switch syntax {
+	case SyntaxFish:
+		return "set -e " + strings.Join(names, " ") + "\n", nil
+	case SyntaxPowerShell:
+		var b strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&b, "Remove-Item -Path Env:%s -ErrorAction SilentlyContinue\n", name)
+		}
+		return b.String(), nil
+	case SyntaxNushell:
+		return "hide-env -i " + strings.Join(names, " ") + "\n", nil
+	default:
+		return "unset " + strings.Join(names, " ") + "\n", nil
+	}
+}
+
+// quotePOSIX single-quote the value, a quote is closed, escaped and reopened
+func quotePOSIX(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteFish single-quote the value, only backslash and quote are escaped in fish
+func quoteFish(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// quotePowerShell single-quote the value, a quote is doubled
+func quotePowerShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// quoteNushell double-quote the value, nushell single quotes can't contain a quote
+func quoteNushell(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
@@ -0,0 +1,105 @@
+package shellenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testVars = []Var{
+	{Name: "AWS_ACCESS_KEY_ID", Value: "AKIA"},
+	{Name: "AWS_SESSION_TOKEN", Value: `it's "quoted" \ $HOME`},
+}
+
+func TestParseEnv(t *testing.T) {
+	got := ParseEnv([]string{"A=1", "B=x=y", "C=", "invalid"})
+	want := []Var{{"A", "1"}, {"B", "x=y"}, {"C", ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseEnv() got = %v, want %v", got, want)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		shell string
+		goos  string
+		want  string
+	}{
+		{"/bin/bash", "linux", SyntaxPOSIX},
+		{"/usr/bin/zsh", "darwin", SyntaxPOSIX},
+		{"/usr/local/bin/fish", "darwin", SyntaxFish},
+		{"/usr/bin/nu", "linux", SyntaxNushell},
+		{"/usr/bin/pwsh", "linux", SyntaxPowerShell},
+		{`C:\Program Files\PowerShell\7\pwsh.exe`, "windows", SyntaxPowerShell},
+		{`C:\Program Files\Git\usr\bin\bash.exe`, "windows", SyntaxPOSIX},
+		{"", "windows", SyntaxPowerShell},
+		{"", "linux", SyntaxPOSIX},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.shell, tt.goos); got != tt.want {
+			t.Errorf("Detect(%q, %q) got = %q, want %q", tt.shell, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/fish")
+	if got, err := Resolve(SyntaxAuto); err != nil || got != SyntaxFish {
+		t.Errorf("Resolve(auto) got = %q, %v, want fish", got, err)
+	}
+	if got, err := Resolve(SyntaxNushell); err != nil || got != SyntaxNushell {
+		t.Errorf("Resolve(nushell) got = %q, %v, want nushell", got, err)
+	}
+	if _, err := Resolve("cmd"); err == nil {
+		t.Error("Resolve(cmd) expected error")
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		syntax string
+		want   string
+	}{
+		{SyntaxPOSIX, "export AWS_ACCESS_KEY_ID='AKIA'\n" +
+			`export AWS_SESSION_TOKEN='it'\''s "quoted" \ $HOME'` + "\n"},
+		{SyntaxFish, "set -gx AWS_ACCESS_KEY_ID 'AKIA'\n" +
+			`set -gx AWS_SESSION_TOKEN 'it\'s "quoted" \\ $HOME'` + "\n"},
+		{SyntaxPowerShell, "$Env:AWS_ACCESS_KEY_ID = 'AKIA'\n" +
+			`$Env:AWS_SESSION_TOKEN = 'it''s "quoted" \ $HOME'` + "\n"},
+		{SyntaxNushell, "$env.AWS_ACCESS_KEY_ID = \"AKIA\"\n" +
+			`$env.AWS_SESSION_TOKEN = "it's \"quoted\" \\ $HOME"` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.syntax, func(t *testing.T) {
+			got, err := Export(tt.syntax, testVars)
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Export() got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Export("cmd", testVars); err == nil {
+		t.Error("Export() expected error for unsupported syntax")
+	}
+}
+
+func TestUnset(t *testing.T) {
+	names := []string{"AWS_ACCESS_KEY_ID", "AWS_SESSION_TOKEN"}
+	tests := []struct {
+		syntax string
+		want   string
+	}{
+		{SyntaxPOSIX, "unset AWS_ACCESS_KEY_ID AWS_SESSION_TOKEN\n"},
+		{SyntaxFish, "set -e AWS_ACCESS_KEY_ID AWS_SESSION_TOKEN\n"},
+		{SyntaxPowerShell, "Remove-Item -Path Env:AWS_ACCESS_KEY_ID -ErrorAction SilentlyContinue\n" +
+			"Remove-Item -Path Env:AWS_SESSION_TOKEN -ErrorAction SilentlyContinue\n"},
+		{SyntaxNushell, "hide-env -i AWS_ACCESS_KEY_ID AWS_SESSION_TOKEN\n"},
+	}
+	for _, tt := range tests {
+		if got, err := Unset(tt.syntax, names); err != nil || got != tt.want {
+			t.Errorf("Unset(%q) got = %q, %v, want %q", tt.syntax, got, err, tt.want)
+		}
+	}
+}
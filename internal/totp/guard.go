@@ -0,0 +1,149 @@
+package totp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yousysadmin/jc2aws/internal/filelock"
+)
+
+// CodeUsedError is returned by Guard.Code with NoWait when the code
+// of the current time step was already used
+type CodeUsedError struct {
+	// Wait time until the next unused time step
+	Wait time.Duration
+}
+
+func (e *CodeUsedError) Error() string {
+	return fmt.Sprintf("TOTP code of the current time window was already used, the next code is available in %s",
+		e.Wait.Round(time.Second))
+}
+
+// Guard records the last time step used per secret in a directory, so concurrent and
+// back-to-back logins with the same secret never send the same code twice
+type Guard struct {
+	Dir string
+	// NoWait return CodeUsedError instead of waiting for the next time step
+	NoWait bool
+	// OnWait is called every second while waiting for the next time step with
+	// the remaining time, and with 0 when the wait is over (optional)
+	OnWait func(remaining time.Duration)
+	// Clock returns current time codes are generated for (time.Now if nil),
+	// e.g. the local time corrected by the clock skew to the server
+	Clock func() time.Time
+
+	// sleep waits, replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewGuard Init new guard storing time steps in the directory
+func NewGuard(dir string) *Guard {
+	return &Guard{Dir: dir, sleep: sleep}
+}
+
+// now return current time of the clock
+func (g *Guard) now() time.Time {
+	if g.Clock == nil {
+		return time.Now()
+	}
+	return g.Clock()
+}
+
+// Code return the code of the key for a time step no other login used,
+// waiting for the next time step if the current one was already used
+func (g *Guard) Code(ctx context.Context, key Key) (string, error) {
+	step, err := g.reserve(key)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Unix(int64(step)*int64(key.period()), 0)
+	if remaining := start.Sub(g.now()); remaining > 0 {
+		for ; remaining > 0; remaining = start.Sub(g.now()) {
+			if g.OnWait != nil {
+				g.OnWait(remaining)
+			}
+			if err := g.sleep(ctx, min(remaining, time.Second)); err != nil {
+				return "", err
+			}
+		}
+		if g.OnWait != nil {
+			g.OnWait(0)
+		}
+	}
+	return key.Generate(start)
+}
+
+// reserve record and return the first time step of the key not used before,
+// the state file is locked, so concurrent processes reserve different steps
+func (g *Guard) reserve(key Key) (uint64, error) {
+	path := filepath.Join(g.Dir, keyID(key))
+	lock, err := filelock.Acquire(path + ".lock")
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Unlock()
+
+	now := g.now()
+	step := key.Counter(now)
+	last, err := readStep(path)
+	if err != nil {
+		return 0, err
+	}
+	if last >= step {
+		step = last + 1
+		if g.NoWait {
+			start := time.Unix(int64(step)*int64(key.period()), 0)
+			return 0, &CodeUsedError{Wait: start.Sub(now)}
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(strconv.FormatUint(step, 10)+"\n"), 0600); err != nil {
+		return 0, fmt.Errorf("failed to save TOTP state: %w", err)
+	}
+	return step, nil
+}
+
+// readStep read the last used time step, 0 if the state file doesn't exist
+func readStep(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read TOTP state: %w", err)
+	}
+	step, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		// A corrupted state doesn't block logins, it is overwritten
+		return 0, nil
+	}
+	return step, nil
+}
+
+// keyID state file name of the key, the secret itself is never written
+func keyID(key Key) string {
+	sum := sha256.Sum256(key.Secret)
+	return hex.EncodeToString(sum[:16])
+}
+
+// sleep wait for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package totp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestGuard guard with a fake clock, sleep advances the clock
+func newTestGuard(t *testing.T, dir string, now *time.Time) *Guard {
+	t.Helper()
+	g := NewGuard(dir)
+	g.Clock = func() time.Time { return *now }
+	g.sleep = func(_ context.Context, d time.Duration) error {
+		*now = now.Add(d)
+		return nil
+	}
+	return g
+}
+
+func testKey(t *testing.T) Key {
+	t.Helper()
+	key, err := ParseKey("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestGuardCode_WaitsForNextStep(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1_000_000_040, 0) // 10 seconds before the next 30 seconds step
+	key := testKey(t)
+
+	g := newTestGuard(t, dir, &now)
+	first, err := g.Code(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	if want, _ := key.Generate(now); first != want {
+		t.Errorf("first code = %s, want %s", first, want)
+	}
+
+	var waits []time.Duration
+	g = newTestGuard(t, dir, &now)
+	g.OnWait = func(remaining time.Duration) { waits = append(waits, remaining) }
+	second, err := g.Code(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	if !now.Equal(time.Unix(1_000_000_050, 0)) {
+		t.Errorf("waited until %v, want the next step", now.Unix())
+	}
+	if want, _ := key.Generate(now); second != want || second == first {
+		t.Errorf("second code = %s, want %s (first %s)", second, want, first)
+	}
+	if len(waits) != 11 || waits[0] != 10*time.Second || waits[len(waits)-1] != 0 {
+		t.Errorf("OnWait calls = %v, want a countdown from 10s to 0", waits)
+	}
+}
+
+func TestGuardCode_NoWait(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1_000_000_025, 0)
+	key := testKey(t)
+
+	if _, err := newTestGuard(t, dir, &now).Code(context.Background(), key); err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	g := newTestGuard(t, dir, &now)
+	g.NoWait = true
+	_, err := g.Code(context.Background(), key)
+	usedErr, ok := errors.AsType[*CodeUsedError](err)
+	if !ok {
+		t.Fatalf("Code: want CodeUsedError, got %v", err)
+	}
+	if usedErr.Wait != 25*time.Second {
+		t.Errorf("Wait = %s, want 25s", usedErr.Wait)
+	}
+
+	// The failed attempt doesn't reserve a step
+	now = now.Add(25 * time.Second)
+	if _, err := g.Code(context.Background(), key); err != nil {
+		t.Errorf("Code in the next step: %v", err)
+	}
+}
+
+func TestGuardCode_SecretsAreIndependent(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1_000_000_025, 0)
+
+	other, err := ParseKey("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []Key{testKey(t), other} {
+		g := newTestGuard(t, dir, &now)
+		g.NoWait = true
+		if _, err := g.Code(context.Background(), key); err != nil {
+			t.Errorf("Code: %v", err)
+		}
+	}
+}
+
+func TestGuardCode_ContextCanceled(t *testing.T) {
+	dir := t.TempDir()
+	key := testKey(t)
+	g := NewGuard(dir)
+	if _, err := g.Code(context.Background(), key); err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Code(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Errorf("Code: want context.Canceled, got %v", err)
+	}
+}
+
+func TestGuardReserve_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	key := testKey(t)
+
+	const n = 5
+	steps := make([]uint64, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			steps[i], errs[i] = NewGuard(dir).reserve(key)
+		})
+	}
+	wg.Wait()
+
+	seen := map[uint64]bool{}
+	for i, step := range steps {
+		if errs[i] != nil {
+			t.Fatalf("reserve: %v", errs[i])
+		}
+		if seen[step] {
+			t.Errorf("step %d reserved twice: %v", step, steps)
+		}
+		seen[step] = true
+	}
+}
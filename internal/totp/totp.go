@@ -1,57 +1,230 @@
+// Package totp generates RFC 6238 time-based one-time passwords from a base32
+// secret or an otpauth://totp/ URI (SHA-1, SHA-256 or SHA-512, 6 to 8 digits).
 package totp
 
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base32"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Algorithm HMAC hash function of the TOTP
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+const (
+	// DefaultDigits number of digits of a code without the digits parameter
+	DefaultDigits = 6
+	// DefaultPeriod seconds a code is valid without the period parameter
+	DefaultPeriod = 30
+
+	minDigits = 6
+	maxDigits = 8
+
+	uriScheme = "otpauth://"
+)
+
+// Key TOTP secret with the parameters of its codes
+type Key struct {
+	Secret    []byte
+	Algorithm Algorithm
+	Digits    int
+	Period    int
+	// Issuer and Account labels of an otpauth:// URI
+	Issuer  string
+	Account string
+}
+
+// IsCode report whether the MFA value is a one-time code (6 to 8 digits) and not a secret
+func IsCode(s string) bool {
+	if len(s) < minDigits || len(s) > maxDigits {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsURI report whether the value is an otpauth:// URI
+func IsURI(s string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), uriScheme)
+}
+
+// ParseKey parse a base32 secret or an otpauth://totp/ URI,
+// a base32 secret uses SHA-1, 6 digits and a 30 seconds period
+func ParseKey(s string) (Key, error) {
+	if IsURI(s) {
+		return parseURI(strings.TrimSpace(s))
+	}
+	secret, err := decodeSecret(s)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}, nil
+}
+
+// parseURI parse otpauth://totp/Issuer:account?secret=...&algorithm=...&digits=...&period=...&issuer=...
+func parseURI(s string) (Key, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return Key{}, fmt.Errorf("unsupported otpauth type %q, only totp is supported", u.Host)
+	}
+
+	q := u.Query()
+	if q.Get("secret") == "" {
+		return Key{}, errors.New("otpauth URI has no secret")
+	}
+	secret, err := decodeSecret(q.Get("secret"))
+	if err != nil {
+		return Key{}, err
+	}
+	key := Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}
+
+	if v := q.Get("algorithm"); v != "" {
+		key.Algorithm = Algorithm(strings.ToUpper(v))
+		if _, err := key.Algorithm.hash(); err != nil {
+			return Key{}, err
+		}
+	}
+	if v := q.Get("digits"); v != "" {
+		if key.Digits, err = strconv.Atoi(v); err != nil || key.Digits < minDigits || key.Digits > maxDigits {
+			return Key{}, fmt.Errorf("invalid digits %q, must be %d to %d", v, minDigits, maxDigits)
+		}
+	}
+	if v := q.Get("period"); v != "" {
+		if key.Period, err = strconv.Atoi(v); err != nil || key.Period <= 0 {
+			return Key{}, fmt.Errorf("invalid period %q", v)
+		}
+	}
+
+	// Label is "Issuer:account" or "account", the issuer parameter wins
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer, key.Account = issuer, strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+	if v := q.Get("issuer"); v != "" {
+		key.Issuer = v
+	}
+	return key, nil
+}
+
+// decodeSecret decode the base32 secret, spaces and case are ignored
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base32 secret: %w", err)
+	}
+	return secret, nil
+}
+
+// hash return the hash function of the algorithm
+func (a Algorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case SHA1, "":
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q, use one of: %s, %s, %s", a, SHA1, SHA256, SHA512)
+}
+
+// Counter return the time step of the time, codes of the same step are equal
+func (k Key) Counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(k.period())
+}
+
+// Remaining return the time the code of the key at the time remains valid
+func (k Key) Remaining(t time.Time) time.Duration {
+	end := time.Unix(int64(k.Counter(t)+1)*int64(k.period()), 0)
+	return end.Sub(t)
+}
+
+// Generate return the code of the key at the time
+func (k Key) Generate(t time.Time) (string, error) {
+	h, err := k.Algorithm.hash()
+	if err != nil {
+		return "", err
+	}
+	digits := k.Digits
+	if digits == 0 {
+		digits = DefaultDigits
+	}
+	code := hotp(h, k.Secret, k.Counter(t), digits)
+	return fmt.Sprintf("%0*d", digits, code), nil
+}
+
+// period return the period of the key, DefaultPeriod if not set
+func (k Key) period() int {
+	if k.Period <= 0 {
+		return DefaultPeriod
+	}
+	return k.Period
+}
+
 // GetToken
-// Generate token from input MFA Secret key
+// Generate token from input MFA Secret key (base32 or otpauth:// URI)
 func GetToken(secretKey string) (string, error) {
-	now := time.Now().UTC().Unix()
-	code, err := generateTOTP(secretKey, now)
+	key, err := ParseKey(secretKey)
 	if err != nil {
 		return "", err
 	}
-	// Zero-pad to always return 6 digits
-	return fmt.Sprintf("%06d", code), nil
+	return key.Generate(time.Now())
 }
 
 // generateTOTP function
+// Generate a 6-digit SHA-1 code of the base32 secret at the unix timestamp
 func generateTOTP(secretKey string, timestamp int64) (uint32, error) {
-
-	// The base32 encoded secret key string is decoded to a byte slice
-	base32Decoder := base32.StdEncoding.WithPadding(base32.NoPadding)
-	secretKey = strings.ToUpper(strings.TrimSpace(secretKey)) // preprocess
-	secretBytes, err := base32Decoder.DecodeString(secretKey) // decode
+	secret, err := decodeSecret(secretKey)
 	if err != nil {
-		return 0, fmt.Errorf("invalid base32 secret: %w", err)
+		return 0, err
 	}
+	return hotp(sha1.New, secret, uint64(timestamp)/DefaultPeriod, DefaultDigits), nil
+}
 
-	// The truncated timestamp / 30 is converted to an 8-byte big-endian
-	// unsigned integer slice
-	timeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(timeBytes, uint64(timestamp)/30)
-
-	// The timestamp bytes are concatenated with the decoded secret key
-	// bytes. Then a 20-byte SHA-1 hash is calculated from the byte slice
-	hash := hmac.New(sha1.New, secretBytes)
-	hash.Write(timeBytes) // Concat the timestamp byte slice
-	h := hash.Sum(nil)    // Calculate 20-byte SHA-1 digest
-
-	// AND the SHA-1 with 0x0F (15) to get a single-digit offset
-	offset := h[len(h)-1] & 0x0F
+// hotp RFC 4226 code of the counter
+func hotp(h func() hash.Hash, secret []byte, counter uint64, digits int) uint32 {
+	// The counter is converted to an 8-byte big-endian unsigned integer
+	// and signed with HMAC
+	counterBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(counterBytes, counter)
+	mac := hmac.New(h, secret)
+	mac.Write(counterBytes)
+	sum := mac.Sum(nil)
 
-	// Truncate the SHA-1 by the offset and convert it into a 32-bit
-	// unsigned int. AND the 32-bit int with 0x7FFFFFFF (2147483647)
-	// to get a 31-bit unsigned int.
-	truncatedHash := binary.BigEndian.Uint32(h[offset:offset+4]) & 0x7FFFFFFF
+	// The last 4 bits of the digest are the offset of the dynamically
+	// truncated 31-bit unsigned int
+	offset := sum[len(sum)-1] & 0x0F
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
 
-	// Take modulo 1_000_000 to get a 6-digit code
-	return truncatedHash % 1_000_000, nil
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+	return truncated % mod
 }
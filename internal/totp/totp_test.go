@@ -2,6 +2,7 @@ package totp
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -248,3 +249,155 @@ func TestBase32DecodingEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyGenerate_RFC6238(t *testing.T) {
+	// RFC 6238 Appendix B reference vectors (8 digits, 30 seconds period)
+	seeds := map[Algorithm][]byte{
+		SHA1:   []byte("12345678901234567890"),
+		SHA256: []byte("12345678901234567890123456789012"),
+		SHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	tests := []struct {
+		time int64
+		want map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+	}
+
+	for _, tt := range tests {
+		for alg, want := range tt.want {
+			t.Run(fmt.Sprintf("%s/%d", alg, tt.time), func(t *testing.T) {
+				key := Key{Secret: seeds[alg], Algorithm: alg, Digits: 8, Period: 30}
+				got, err := key.Generate(time.Unix(tt.time, 0))
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				if got != want {
+					t.Errorf("Generate() = %s, want %s", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	// base32 of the RFC 6238 SHA-1 seed "12345678901234567890"
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		name    string
+		input   string
+		want    Key
+		wantErr bool
+	}{
+		{
+			name:  "base32 secret",
+			input: secret,
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30},
+		},
+		{
+			name:  "grouped lowercase secret",
+			input: "gezd gnbv gy3t qojq gezd gnbv gy3t qojq",
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30},
+		},
+		{
+			name:  "minimal uri",
+			input: "otpauth://totp/alice@example.com?secret=" + secret,
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30, Account: "alice@example.com"},
+		},
+		{
+			name:  "full uri",
+			input: "otpauth://totp/JumpCloud:alice@example.com?secret=" + secret + "&algorithm=SHA256&digits=8&period=60&issuer=JumpCloud%20Inc",
+			want:  Key{Algorithm: SHA256, Digits: 8, Period: 60, Issuer: "JumpCloud Inc", Account: "alice@example.com"},
+		},
+		{
+			name:  "issuer from label",
+			input: "OTPAUTH://TOTP/JumpCloud:%20alice?secret=" + secret + "&algorithm=sha512",
+			want:  Key{Algorithm: SHA512, Digits: 6, Period: 30, Issuer: "JumpCloud", Account: "alice"},
+		},
+		{name: "invalid secret", input: "INVALID@SECRET", wantErr: true},
+		{name: "hotp uri", input: "otpauth://hotp/alice?secret=" + secret + "&counter=1", wantErr: true},
+		{name: "uri without secret", input: "otpauth://totp/alice", wantErr: true},
+		{name: "unsupported algorithm", input: "otpauth://totp/alice?secret=" + secret + "&algorithm=MD5", wantErr: true},
+		{name: "invalid digits", input: "otpauth://totp/alice?secret=" + secret + "&digits=10", wantErr: true},
+		{name: "invalid period", input: "otpauth://totp/alice?secret=" + secret + "&period=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKey(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(got.Secret) != "12345678901234567890" {
+				t.Errorf("Secret = %q", got.Secret)
+			}
+			got.Secret = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKey() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetToken_URI(t *testing.T) {
+	token, err := GetToken("otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=8&algorithm=SHA256")
+	if err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if len(token) != 8 || !IsCode(token) {
+		t.Errorf("GetToken() = %q, want an 8-digit code", token)
+	}
+}
+
+func TestIsCode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"123456", true},
+		{"12345678", true},
+		{"012345", true},
+		{"12345", false},
+		{"123456789", false},
+		{"12345a", false},
+		{"", false},
+		{"JBSWY3DPEHPK3PXP", false},
+		// A numeric-looking secret longer than 8 characters is a secret
+		{"234567234567", false},
+		{"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCode(tt.input); got != tt.want {
+			t.Errorf("IsCode(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestKeyRemaining(t *testing.T) {
+	tests := []struct {
+		period int
+		time   time.Time
+		want   time.Duration
+	}{
+		{30, time.Unix(1_000_000_020, 0), 30 * time.Second},
+		{30, time.Unix(1_000_000_041, 500_000_000), 8500 * time.Millisecond},
+		{60, time.Unix(1_000_000_040, 0), 40 * time.Second},
+		{0, time.Unix(1_000_000_049, 0), time.Second},
+	}
+	for _, tt := range tests {
+		key := Key{Period: tt.period}
+		if got := key.Remaining(tt.time); got != tt.want {
+			t.Errorf("Remaining(%v) with period %d = %s, want %s", tt.time.Unix(), tt.period, got, tt.want)
+		}
+	}
+}
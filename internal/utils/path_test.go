@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("J2A_TEST_DIR", "/mnt/aws")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "", want: ""},
+		{path: "/etc/aws/config", want: "/etc/aws/config"},
+		{path: "~", want: home},
+		{path: "~/aws/config", want: filepath.Join(home, "aws", "config")},
+		{path: "$J2A_TEST_DIR/config", want: "/mnt/aws/config"},
+		{path: "${J2A_TEST_DIR}/credentials", want: "/mnt/aws/credentials"},
+		{path: "$HOME/.aws/config", want: home + "/.aws/config"},
+		{path: "~user/config", want: "~user/config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ExpandPath(tt.path)
+			if err != nil {
+				t.Fatalf("ExpandPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandPath() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
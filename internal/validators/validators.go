@@ -5,9 +5,12 @@ import (
 	"net/mail"
 	"net/url"
 	"slices"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/yousysadmin/jc2aws/internal/aws"
+	"github.com/yousysadmin/jc2aws/internal/jumpcloud"
+	"github.com/yousysadmin/jc2aws/internal/totp"
 )
 
 // Map contains named validator functions for input parameters.
@@ -54,21 +57,47 @@ var Map = map[string]func(input string) error{
 		return nil
 	},
 	"mfa": func(input string) error {
-		if len(input) < 6 {
-			return errors.New("mfa must be a 6-digit totp code or mfa secret string.")
+		if totp.IsCode(input) {
+			return nil
+		}
+		if _, err := totp.ParseKey(input); err != nil || input == "" {
+			return errors.New("mfa must be a 6 to 8 digit totp code, a base32 mfa secret or an otpauth:// URI")
+		}
+		return nil
+	},
+	"mfa-method": func(input string) error {
+		if !slices.Contains(jumpcloud.MFAMethods, input) {
+			return errors.New("invalid MFA method")
 		}
 		return nil
 	},
 	"output-format": func(input string) error {
-		formats := []string{"cli", "env", "cli-stdout", "env-stdout", "shell"}
+		formats := []string{"cli", "env", "cli-stdout", "env-stdout", "json", "json-stdout", "export", "shell", "credential-process", "console"}
 		if !slices.Contains(formats, input) {
 			return errors.New("invalid output format")
 		}
 		return nil
 	},
+	"duration": func(input string) error {
+		seconds, err := strconv.Atoi(input)
+		if err != nil || seconds < 900 || seconds > 43200 {
+			return errors.New("session duration must be 900 to 43200 seconds")
+		}
+		return nil
+	},
 }
 
 // Get returns the validator function for the given key, or nil if not found.
 func Get(key string) func(string) error {
 	return Map[key]
 }
+
+// Optional wraps a validator so that empty input is accepted.
+func Optional(validator func(string) error) func(string) error {
+	return func(input string) error {
+		if input == "" || validator == nil {
+			return nil
+		}
+		return validator(input)
+	}
+}
@@ -7,7 +7,7 @@ import (
 func TestMapContainsAllKeys(t *testing.T) {
 	expectedKeys := []string{
 		"skip", "email", "password", "idp-url",
-		"role-arn", "principal-arn", "region", "mfa", "output-format",
+		"role-arn", "principal-arn", "region", "mfa", "mfa-method", "output-format", "duration",
 	}
 	for _, key := range expectedKeys {
 		if _, ok := Map[key]; !ok {
@@ -164,6 +164,18 @@ func TestMFAValidator(t *testing.T) {
 	if err := fn("JBSWY3DPEHPK3PXP"); err != nil {
 		t.Errorf("mfa validator rejected TOTP secret: %v", err)
 	}
+	if err := fn("12345678"); err != nil {
+		t.Errorf("mfa validator rejected 8-digit code: %v", err)
+	}
+	if err := fn("otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=8"); err != nil {
+		t.Errorf("mfa validator rejected otpauth URI: %v", err)
+	}
+	if err := fn("otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=MD5"); err == nil {
+		t.Error("mfa validator accepted otpauth URI with unsupported algorithm")
+	}
+	if err := fn("not-a-secret!"); err == nil {
+		t.Error("mfa validator accepted invalid base32 secret")
+	}
 	if err := fn("12345"); err == nil {
 		t.Error("mfa validator accepted <6 char string")
 	}
@@ -172,20 +184,67 @@ func TestMFAValidator(t *testing.T) {
 	}
 }
 
+func TestMFAMethodValidator(t *testing.T) {
+	fn := Get("mfa-method")
+
+	for _, v := range []string{"auto", "totp", "push", "duo"} {
+		if err := fn(v); err != nil {
+			t.Errorf("mfa-method validator rejected valid method %q: %v", v, err)
+		}
+	}
+	for _, v := range []string{"", "sms", "PUSH"} {
+		if err := fn(v); err == nil {
+			t.Errorf("mfa-method validator accepted invalid method %q", v)
+		}
+	}
+}
+
 func TestOutputFormatValidator(t *testing.T) {
 	fn := Get("output-format")
 
-	valid := []string{"cli", "env", "cli-stdout", "env-stdout", "shell"}
+	valid := []string{"cli", "env", "cli-stdout", "env-stdout", "json", "json-stdout", "export", "shell", "credential-process", "console"}
 	for _, v := range valid {
 		if err := fn(v); err != nil {
 			t.Errorf("output-format validator rejected valid format %q: %v", v, err)
 		}
 	}
 
-	invalid := []string{"", "json", "yaml", "CLI"}
+	invalid := []string{"", "yaml", "JSON", "CLI"}
 	for _, v := range invalid {
 		if err := fn(v); err == nil {
 			t.Errorf("output-format validator accepted invalid format %q", v)
 		}
 	}
 }
+
+func TestDurationValidator(t *testing.T) {
+	fn := Get("duration")
+
+	for _, v := range []string{"900", "3600", "43200"} {
+		if err := fn(v); err != nil {
+			t.Errorf("duration validator rejected valid duration %q: %v", v, err)
+		}
+	}
+	for _, v := range []string{"", "899", "43201", "1h", "-3600"} {
+		if err := fn(v); err == nil {
+			t.Errorf("duration validator accepted invalid duration %q", v)
+		}
+	}
+}
+
+func TestOptionalValidator(t *testing.T) {
+	fn := Optional(Get("role-arn"))
+
+	if err := fn(""); err != nil {
+		t.Errorf("optional validator should accept empty string, got: %v", err)
+	}
+	if err := fn("arn:aws:iam::111:role/admin"); err != nil {
+		t.Errorf("optional validator rejected valid value: %v", err)
+	}
+	if err := fn("not-an-arn"); err == nil {
+		t.Error("optional validator should reject invalid non-empty value")
+	}
+	if err := Optional(nil)("anything"); err != nil {
+		t.Errorf("optional nil validator should accept any value, got: %v", err)
+	}
+}